@@ -0,0 +1,52 @@
+// This example embeds the ENEMETER processing in another program: it prints
+// the energy and average power of a capture, first with the one-call API and
+// then with the parser and metrics packages directly.
+//
+//	go run ./_examples/embed path/to/capture.csv
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"enemeter-data-processing/pkg/enemeter"
+	"enemeter-data-processing/pkg/metrics"
+	"enemeter-data-processing/pkg/parser"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatalf("usage: %s <capture.csv>", os.Args[0])
+	}
+	path := os.Args[1]
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// The common case: one call, only records above 3.0 V
+	result, err := enemeter.Process(path, start, enemeter.Options{
+		Filter: parser.FilterOptions{VoltageRange: &[2]int64{3000000, 5000000}},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Total energy:  %.4f J\n", result.TotalJoules)
+	fmt.Printf("Average power: %.4f W\n", result.AveragePowerWatts)
+
+	// The same building blocks the CLI uses, here with the records in memory
+	csvParser := parser.NewCSVParser(path).WithFilterOptions(parser.FilterOptions{
+		StartTime:  &start,
+		SampleRate: 1,
+	})
+	records, err := csvParser.Parse()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	calculator := metrics.NewEnergyCalculator(records).WithOptions(metrics.MetricsOptions{
+		ExactPercentiles: true,
+	})
+	energyMetrics := calculator.CalculateMetrics()
+	fmt.Printf("Median current: %.6f A over %d records\n",
+		energyMetrics.CurrentStats.ExactPercentiles.P50, energyMetrics.DataPoints)
+}
@@ -1,16 +1,20 @@
 package main
 
 import (
+	"bufio"
 	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"strconv"
+	"strings"
 )
 
 func main() {
-	inputFile := flag.String("input", "", "Path to the CSV file to analyze")
+	inputFile := flag.String("input", "", "Path to the CSV or JSONL (.jsonl) file to analyze")
 	sampleSize := flag.Int("samples", 10, "Number of sample rows to display")
 	flag.Parse()
 
@@ -30,7 +34,10 @@ func main() {
 		}
 	}()
 
-	reader := csv.NewReader(file)
+	nextRow := csv.NewReader(file).Read
+	if strings.HasSuffix(strings.ToLower(*inputFile), ".jsonl") {
+		nextRow = jsonlRows(file)
+	}
 
 	fmt.Printf("Analyzing file: %s\n", *inputFile)
 	fmt.Printf("Showing %d sample rows:\n\n", *sampleSize)
@@ -46,7 +53,7 @@ func main() {
 	fmt.Println("---------------------------------------------------------------")
 
 	for i := 0; i < *sampleSize; i++ {
-		row, err := reader.Read()
+		row, err := nextRow()
 		if err != nil {
 			break
 		}
@@ -103,6 +110,41 @@ func main() {
 	fmt.Printf("Current:     Values are in nanoamperes (A = value / 1000000000)\n")
 }
 
+// jsonlRows returns the fields of each JSON line in the CSV column order, so
+// that they can be checked like CSV rows
+func jsonlRows(r io.Reader) func() ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	columns := []string{"time_delta_ms", "voltage_uv", "current_na", "temp_mc"}
+
+	return func() ([]string, error) {
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+
+			var fields map[string]json.Number
+			decoder := json.NewDecoder(strings.NewReader(line))
+			decoder.UseNumber()
+			if err := decoder.Decode(&fields); err != nil {
+				return nil, err
+			}
+
+			var row []string
+			for _, column := range columns {
+				if value, ok := fields[column]; ok {
+					row = append(row, value.String())
+				}
+			}
+			return row, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
+
 func findMinMax(values []int64) (int64, int64) {
 	if len(values) == 0 {
 		return 0, 0
@@ -125,17 +167,23 @@ func findMinMax(values []int64) (int64, int64) {
 
 func suggestUnits(_, maxTemp, minVoltage, maxVoltage, minCurrent, maxCurrent int64) {
 	// Suggest temperature units
+	// The flags convert into the units process expects: m°C, µV and nA
+	var flags []string
+
 	if maxTemp > 100000 {
 		fmt.Println("Temperature: Values appear to be in raw ADC format")
 		fmt.Println("             Consider using raw_value / 10 as °C")
+		flags = append(flags, "--temp-scale=100")
 	} else if maxTemp > 10000 {
 		fmt.Println("Temperature: Values appear to be in millicelsius")
 		fmt.Println("             Consider using raw_value / 1000 as °C")
 	} else if maxTemp > 1000 {
 		fmt.Println("Temperature: Values appear to be in centicelsius")
 		fmt.Println("             Consider using raw_value / 100 as °C")
+		flags = append(flags, "--temp-scale=10")
 	} else {
 		fmt.Println("Temperature: Values appear to be direct celsius readings")
+		flags = append(flags, "--temp-scale=1000")
 	}
 
 	// Suggest voltage units
@@ -145,8 +193,10 @@ func suggestUnits(_, maxTemp, minVoltage, maxVoltage, minCurrent, maxCurrent int
 	} else if math.Abs(float64(minVoltage)) > 1000 || math.Abs(float64(maxVoltage)) > 1000 {
 		fmt.Println("Voltage:     Values appear to be in millivolts")
 		fmt.Println("             Consider using raw_value / 1000 as V")
+		flags = append(flags, "--volt-scale=1000")
 	} else {
 		fmt.Println("Voltage:     Values appear to be direct voltage readings (V)")
+		flags = append(flags, "--volt-scale=1000000")
 	}
 
 	// Suggest current units
@@ -156,8 +206,17 @@ func suggestUnits(_, maxTemp, minVoltage, maxVoltage, minCurrent, maxCurrent int
 	} else if maxCurrent > 1000 || minCurrent < -1000 {
 		fmt.Println("Current:     Values appear to be in microamperes")
 		fmt.Println("             Consider using raw_value / 1000000 as A")
+		flags = append(flags, "--curr-scale=1000")
 	} else {
 		fmt.Println("Current:     Values appear to be in milliamperes")
 		fmt.Println("             Consider using raw_value / 1000 as A")
+		flags = append(flags, "--curr-scale=1000000")
+	}
+
+	if len(flags) == 0 {
+		fmt.Println("\nThe units match what the process command expects, no scale flags needed")
+	} else {
+		fmt.Printf("\nSuggested process flags: %s\n", strings.Join(flags, " "))
 	}
+	fmt.Println()
 }
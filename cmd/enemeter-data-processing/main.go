@@ -2,8 +2,14 @@ package main
 
 import (
 	"enemeter-data-processing/internal/commands"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+
+	// Embed the time zone database for --timezone on systems without one,
+	// such as Windows
+	_ "time/tzdata"
 )
 
 func main() {
@@ -25,10 +31,83 @@ func main() {
 
 		options := commands.ParseCommandLineOptions(processCmd)
 		if err := commands.ProcessCommand(options); err != nil {
+			var budgetErr *commands.BudgetExceededError
+			if errors.As(err, &budgetErr) {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(commands.BudgetExitCode)
+			}
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 
+	case "diff":
+		diffCmd := commands.SetupDiffCommand()
+		if err := diffCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+			diffCmd.Usage()
+			os.Exit(1)
+		}
+
+		options := commands.ParseDiffOptions(diffCmd)
+		if err := commands.DiffCommand(options); err != nil {
+			var regressionErr *commands.RegressionError
+			if errors.As(err, &regressionErr) {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(commands.RegressionExitCode)
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "export":
+		exportCmd := commands.SetupExportCommand()
+		if err := exportCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+			exportCmd.Usage()
+			os.Exit(1)
+		}
+
+		options := commands.ParseExportOptions(exportCmd)
+		if err := commands.ExportCommand(options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "watch":
+		watchCmd := commands.SetupWatchCommand()
+		if err := watchCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+			watchCmd.Usage()
+			os.Exit(1)
+		}
+
+		options := commands.ParseWatchOptions(watchCmd)
+		if err := commands.WatchCommand(options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "validate":
+		validateCmd := commands.SetupValidateCommand()
+		if err := validateCmd.Parse(os.Args[2:]); err != nil {
+			// The flag package has printed the error and the usage
+			if errors.Is(err, flag.ErrHelp) {
+				os.Exit(0)
+			}
+			os.Exit(commands.ValidationFailedExitCode)
+		}
+
+		options := commands.ParseValidateOptions(validateCmd)
+		if err := commands.ValidateCommand(options); err != nil {
+			var validationErr *commands.ValidationError
+			if errors.As(err, &validationErr) {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			os.Exit(commands.ValidateExitCode(err))
+		}
+
 	case "version":
 		fmt.Printf("%s\n", commands.CurrentVersion)
 
@@ -48,6 +127,10 @@ func printUsage() {
 	fmt.Println("  enemeter-data-processing <command> [options]")
 	fmt.Println("\nAvailable Commands:")
 	fmt.Println("  process     Process ENEMETER data files")
+	fmt.Println("  diff        Compare the metrics of a baseline and a candidate capture")
+	fmt.Println("  export      Write filtered ENEMETER records to a CSV file")
+	fmt.Println("  watch       Display running metrics for live data from a file or stdin")
+	fmt.Println("  validate    Check a CSV file for data quality issues")
 	fmt.Println("  version     Show version information")
 	fmt.Println("  help        Show help information")
 	fmt.Println("\nFor command-specific help:")
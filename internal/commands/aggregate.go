@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"encoding/json"
+	"enemeter-data-processing/pkg/metrics"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// aggregateByFile is the --aggregate-by value that reports every input file
+// separately
+const aggregateByFile = "file"
+
+// parseAggregateWindow converts --aggregate-by into the window length: day,
+// hour or a Go duration such as 6h
+func parseAggregateWindow(value string) (time.Duration, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return 0, nil
+	case "day":
+		return 24 * time.Hour, nil
+	case "hour":
+		return time.Hour, nil
+	}
+
+	window, err := time.ParseDuration(value)
+	if err != nil || window < time.Second {
+		return 0, fmt.Errorf("invalid aggregation window: %s (use day, hour, file or a duration of at least 1s)", value)
+	}
+	return window, nil
+}
+
+// generateAggregateOutput renders the metrics of every window: a table in
+// text format, an array in JSON and one row per window in CSV
+func generateAggregateOutput(windows []metrics.EnergyMetrics, window time.Duration, options CommandLineOptions) (string, error) {
+	switch options.Format {
+	case FormatJSON:
+		if windows == nil {
+			windows = []metrics.EnergyMetrics{}
+		}
+		jsonData, err := json.MarshalIndent(windows, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return string(jsonData), nil
+
+	case FormatCSV:
+		return generateAggregateCSV(windows, window), nil
+
+	default: // Text format
+		return generateAggregateReport(windows, window), nil
+	}
+}
+
+// generateAggregateReport renders one table row per window
+func generateAggregateReport(windows []metrics.EnergyMetrics, window time.Duration) string {
+	var sb strings.Builder
+
+	sb.WriteString("========== ENEMETER AGGREGATED REPORT ==========\n")
+	sb.WriteString(fmt.Sprintf("Window: %s\n", window))
+	sb.WriteString(fmt.Sprintf("Windows: %d\n\n", len(windows)))
+
+	sb.WriteString(fmt.Sprintf("%-19s  %-19s %10s %16s %12s %12s %10s %10s\n",
+		"Window Start", "Window End", "Points", "Energy (J)", "Avg (W)", "Peak (W)", "Min (V)", "Avg (°C)"))
+	sb.WriteString(strings.Repeat("-", 116) + "\n")
+
+	var totalJoules float64
+	for _, m := range windows {
+		start := metrics.WindowStart(m.TimeRange.StartTime, window)
+		sb.WriteString(fmt.Sprintf("%-19s  %-19s %10d %16.4f %12.6f %12.6f %10.6f %10.2f\n",
+			start.Format("2006-01-02 15:04:05"), start.Add(window).Format("2006-01-02 15:04:05"),
+			m.DataPoints, m.TotalJoules, m.AveragePowerWatts, m.PeakPowerWatts,
+			m.VoltageStats.MinVoltage, m.TemperatureStats.AvgTempCelsius))
+		totalJoules += m.TotalJoules
+	}
+
+	sb.WriteString(fmt.Sprintf("\nTotal Energy: %.4f joules\n", totalJoules))
+	return sb.String()
+}
+
+// generateAggregateCSV renders one row per window, starting with its bounds
+func generateAggregateCSV(windows []metrics.EnergyMetrics, window time.Duration) string {
+	var sb strings.Builder
+
+	sb.WriteString("window_start,window_end,data_points,total_joules,average_power_watts,peak_power_watts," +
+		"min_voltage,max_voltage,avg_current,avg_temp_celsius,data_completeness\n")
+	for _, m := range windows {
+		start := metrics.WindowStart(m.TimeRange.StartTime, window)
+		sb.WriteString(fmt.Sprintf("%s,%s,%d,%.6f,%.6f,%.6f,%.6f,%.6f,%.9f,%.2f,%.2f\n",
+			start.Format(time.RFC3339), start.Add(window).Format(time.RFC3339),
+			m.DataPoints, m.TotalJoules, m.AveragePowerWatts, m.PeakPowerWatts,
+			m.VoltageStats.MinVoltage, m.VoltageStats.MaxVoltage, m.CurrentStats.AvgCurrent,
+			m.TemperatureStats.AvgTempCelsius, m.DataCompletenessScore))
+	}
+
+	return sb.String()
+}
+
+// fileReport is the JSON form of the metrics of one input file
+type fileReport struct {
+	File    string
+	Metrics metrics.EnergyMetrics
+}
+
+// generateFileOutput renders the metrics of every input file, in the same
+// layouts as generateAggregateOutput with the file name in place of the
+// window bounds
+func generateFileOutput(inputFiles []string, fileMetrics []metrics.EnergyMetrics, options CommandLineOptions) (string, error) {
+	switch options.Format {
+	case FormatJSON:
+		reports := make([]fileReport, len(fileMetrics))
+		for i, m := range fileMetrics {
+			reports[i] = fileReport{File: inputFiles[i], Metrics: m}
+		}
+		jsonData, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return string(jsonData), nil
+
+	case FormatCSV:
+		var sb strings.Builder
+		sb.WriteString("file,start_time,end_time,data_points,total_joules,average_power_watts,peak_power_watts," +
+			"min_voltage,max_voltage,avg_current,avg_temp_celsius,data_completeness\n")
+		for i, m := range fileMetrics {
+			sb.WriteString(fmt.Sprintf("%s,%s,%s,%d,%.6f,%.6f,%.6f,%.6f,%.6f,%.9f,%.2f,%.2f\n",
+				inputFiles[i], m.TimeRange.StartTime.Format(time.RFC3339), m.TimeRange.EndTime.Format(time.RFC3339),
+				m.DataPoints, m.TotalJoules, m.AveragePowerWatts, m.PeakPowerWatts,
+				m.VoltageStats.MinVoltage, m.VoltageStats.MaxVoltage, m.CurrentStats.AvgCurrent,
+				m.TemperatureStats.AvgTempCelsius, m.DataCompletenessScore))
+		}
+		return sb.String(), nil
+
+	default: // Text format
+		var sb strings.Builder
+		sb.WriteString("========== ENEMETER PER-FILE REPORT ==========\n")
+		sb.WriteString(fmt.Sprintf("Files: %d\n\n", len(fileMetrics)))
+
+		sb.WriteString(fmt.Sprintf("%-40s %10s %16s %12s %12s %10s %10s\n",
+			"File", "Points", "Energy (J)", "Avg (W)", "Peak (W)", "Min (V)", "Avg (°C)"))
+		sb.WriteString(strings.Repeat("-", 116) + "\n")
+
+		var totalJoules float64
+		for i, m := range fileMetrics {
+			sb.WriteString(fmt.Sprintf("%-40s %10d %16.4f %12.6f %12.6f %10.6f %10.2f\n",
+				inputFiles[i], m.DataPoints, m.TotalJoules, m.AveragePowerWatts, m.PeakPowerWatts,
+				m.VoltageStats.MinVoltage, m.TemperatureStats.AvgTempCelsius))
+			totalJoules += m.TotalJoules
+		}
+
+		sb.WriteString(fmt.Sprintf("\nTotal Energy: %.4f joules\n", totalJoules))
+		return sb.String(), nil
+	}
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"enemeter-data-processing/pkg/metrics"
+	"fmt"
+	"strings"
+)
+
+// BudgetExitCode is the exit code of a run that breached a power budget,
+// distinct from the exit code 1 of errors
+const BudgetExitCode = 2
+
+// BudgetViolation is one metric that exceeded its --budget-* limit
+type BudgetViolation struct {
+	Metric   string
+	Measured float64
+	Limit    float64
+	Unit     string
+}
+
+// BudgetExceededError is returned by ProcessCommand after the report has
+// been written when at least one budget was breached
+type BudgetExceededError struct {
+	Violations []BudgetViolation
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("power budget exceeded: %d limit(s) breached", len(e.Violations))
+}
+
+// hasBudget reports whether any --budget-* limit was given
+func hasBudget(options CommandLineOptions) bool {
+	return options.BudgetJoules > 0 || options.BudgetAvgW > 0 || options.BudgetPeakW > 0 || options.BudgetMaxTempC != 0
+}
+
+// checkBudget compares the metrics against the --budget-* limits that are
+// set and returns the breached ones in a fixed order
+func checkBudget(energyMetrics metrics.EnergyMetrics, options CommandLineOptions) []BudgetViolation {
+	limits := []struct {
+		enabled  bool
+		metric   string
+		measured float64
+		limit    float64
+		unit     string
+	}{
+		{options.BudgetJoules > 0, "total_energy", energyMetrics.TotalJoules, options.BudgetJoules, "J"},
+		{options.BudgetAvgW > 0, "average_power", energyMetrics.AveragePowerWatts, options.BudgetAvgW, "W"},
+		{options.BudgetPeakW > 0, "peak_power", energyMetrics.PeakPowerWatts, options.BudgetPeakW, "W"},
+		{options.BudgetMaxTempC != 0, "max_temperature", energyMetrics.TemperatureStats.MaxTempCelsius, options.BudgetMaxTempC, "°C"},
+	}
+
+	var violations []BudgetViolation
+	for _, l := range limits {
+		if l.enabled && l.measured > l.limit {
+			violations = append(violations, BudgetViolation{
+				Metric:   l.metric,
+				Measured: l.measured,
+				Limit:    l.limit,
+				Unit:     l.unit,
+			})
+		}
+	}
+	return violations
+}
+
+// formatBudgetViolations renders one line per breached limit
+func formatBudgetViolations(violations []BudgetViolation) string {
+	if len(violations) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\nBUDGET VIOLATIONS\n")
+	sb.WriteString("-----------------\n")
+	for _, v := range violations {
+		sb.WriteString(fmt.Sprintf("%s: measured %.4f %s, limit %.4f %s\n", v.Metric, v.Measured, v.Unit, v.Limit, v.Unit))
+	}
+	return sb.String()
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"encoding/json"
+	"enemeter-data-processing/pkg/metrics"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// exchangeRateAPIURL is the endpoint used by --fetch-exchange-rate; the base
+// currency code is appended to it
+var exchangeRateAPIURL = "https://api.exchangerate-api.com/v4/latest/"
+
+const exchangeRateTimeout = 10 * time.Second
+
+// fetchExchangeRate looks up how many units of target one unit of base buys
+func fetchExchangeRate(client *http.Client, base, target string) (float64, error) {
+	resp, err := client.Get(exchangeRateAPIURL + url.PathEscape(strings.ToUpper(base)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch exchange rate: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Printf("Warning: Error closing response body: %v", closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("exchange rate service returned %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("failed to decode exchange rates: %w", err)
+	}
+
+	rate, ok := body.Rates[strings.ToUpper(target)]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate from %s to %s", base, target)
+	}
+	return rate, nil
+}
+
+// buildCostAnalysis prices the energy at the configured rate and converts it
+// into --currency when that differs from the rate schedule currency
+func buildCostAnalysis(energyMetrics metrics.EnergyMetrics, options CommandLineOptions) (metrics.CostAnalysis, error) {
+	cost := metrics.CalculateCost(energyMetrics, options.EnergyRate, options.RateCurrency)
+
+	if options.Currency == "" || strings.EqualFold(options.Currency, options.RateCurrency) {
+		return cost, nil
+	}
+
+	exchangeRate := options.ExchangeRate
+	if options.FetchExchangeRate {
+		client := &http.Client{Timeout: exchangeRateTimeout}
+		rate, err := fetchExchangeRate(client, options.RateCurrency, options.Currency)
+		if err != nil {
+			return cost, err
+		}
+		exchangeRate = rate
+	}
+
+	if exchangeRate <= 0 {
+		return cost, fmt.Errorf("converting %s to %s requires --exchange-rate or --fetch-exchange-rate",
+			options.RateCurrency, options.Currency)
+	}
+
+	return cost.ConvertTo(options.Currency, exchangeRate), nil
+}
@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"enemeter-data-processing/pkg/metrics"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildCostAnalysis(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"base":"EUR","rates":{"EUR":1,"USD":1.1,"GBP":0.85}}`))
+	}))
+	defer server.Close()
+
+	defaultURL := exchangeRateAPIURL
+	exchangeRateAPIURL = server.URL + "/"
+	defer func() { exchangeRateAPIURL = defaultURL }()
+
+	// One kWh at 0.30 EUR
+	energyMetrics := metrics.EnergyMetrics{TotalJoules: 3600000}
+
+	tests := []struct {
+		name          string
+		options       CommandLineOptions
+		wantCurrency  string
+		wantConverted float64
+		wantRequest   bool
+		wantErr       bool
+	}{
+		{"base currency", CommandLineOptions{RateCurrency: "EUR"}, "EUR", 0.30, false, false},
+		{"same currency", CommandLineOptions{RateCurrency: "EUR", Currency: "eur", ExchangeRate: 2}, "EUR", 0.30, false, false},
+		{"given rate", CommandLineOptions{RateCurrency: "EUR", Currency: "USD", ExchangeRate: 1.2}, "USD", 0.36, false, false},
+		{"fetched rate", CommandLineOptions{RateCurrency: "EUR", Currency: "USD", FetchExchangeRate: true}, "USD", 0.33, true, false},
+		{"fetched rate wins", CommandLineOptions{RateCurrency: "EUR", Currency: "GBP", ExchangeRate: 2, FetchExchangeRate: true}, "GBP", 0.255, true, false},
+		{"unknown currency", CommandLineOptions{RateCurrency: "EUR", Currency: "XYZ", FetchExchangeRate: true}, "", 0, true, true},
+		{"no rate", CommandLineOptions{RateCurrency: "EUR", Currency: "USD"}, "", 0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requested = ""
+			tt.options.EnergyRate = 0.30
+
+			cost, err := buildCostAnalysis(energyMetrics, tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildCostAnalysis() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (requested != "") != tt.wantRequest {
+				t.Errorf("requested %q, want a request: %v", requested, tt.wantRequest)
+			}
+			if tt.wantRequest && requested != "/EUR" {
+				t.Errorf("requested %q, want /EUR", requested)
+			}
+			if err != nil {
+				return
+			}
+
+			if math.Abs(cost.TotalCostBase-0.30) > 1e-9 {
+				t.Errorf("TotalCostBase = %v, want 0.30", cost.TotalCostBase)
+			}
+			if cost.TargetCurrency != tt.wantCurrency {
+				t.Errorf("TargetCurrency = %q, want %q", cost.TargetCurrency, tt.wantCurrency)
+			}
+			if math.Abs(cost.TotalCostConverted-tt.wantConverted) > 1e-9 {
+				t.Errorf("TotalCostConverted = %v, want %v", cost.TotalCostConverted, tt.wantConverted)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package commands
+
+import (
+	"encoding/json"
+	"enemeter-data-processing/pkg/enemeter"
+	"enemeter-data-processing/pkg/metrics"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RegressionExitCode is the exit code of a diff that found regressions
+const RegressionExitCode = 2
+
+// DefaultRegressionThreshold is the change in percent that the diff command
+// tolerates before it calls a metric a regression
+const DefaultRegressionThreshold = 5.0
+
+// DiffOptions holds the options of the diff command
+type DiffOptions struct {
+	BaselineFile   string
+	CandidateFile  string
+	InputFormat    string
+	StartTime      string
+	CandidateStart string // defaults to StartTime
+	Format         OutputFormat
+	OutputFile     string
+
+	RegressionThreshold float64 // percent
+}
+
+// RegressionError is returned by DiffCommand after the report has been
+// written when at least one metric regressed
+type RegressionError struct {
+	Regressions int
+}
+
+func (e *RegressionError) Error() string {
+	return fmt.Sprintf("%d metric(s) regressed by more than the threshold", e.Regressions)
+}
+
+// diffReport is the JSON form of the diff command output
+type diffReport struct {
+	Baseline  metrics.EnergyMetrics `json:"baseline"`
+	Candidate metrics.EnergyMetrics `json:"candidate"`
+	Delta     metrics.DeltaMetrics  `json:"delta"`
+}
+
+// SetupDiffCommand configures the diff command with all its flags
+func SetupDiffCommand() *flag.FlagSet {
+	diffCmd := flag.NewFlagSet("diff", flag.ExitOnError)
+
+	diffCmd.String("baseline", "", "Path to the baseline input file - REQUIRED")
+	diffCmd.String("candidate", "", "Path to the candidate input file - REQUIRED")
+	diffCmd.String("input-format", "", "Input format of both files: csv or jsonl (default: jsonl for .jsonl files, csv otherwise)")
+	diffCmd.String("start", "", "Start time of the baseline measurements (format: YYYY-MM-DD HH:MM:SS) - REQUIRED")
+	diffCmd.String("candidate-start", "", "Start time of the candidate measurements (default: --start)")
+	diffCmd.String("format", "text", "Output format: text or json")
+	diffCmd.String("output", "", "Path to save the diff report (optional)")
+	diffCmd.Float64("regression-threshold", DefaultRegressionThreshold, "Change in percent for the worse above which a metric counts as a regression")
+
+	diffCmd.Usage = func() {
+		fmt.Println(AppName + " - Compare the metrics of two ENEMETER captures")
+		fmt.Println("\nUsage:")
+		fmt.Println("  enemeter-data-processing diff [options]")
+		fmt.Println("\nExamples:")
+		fmt.Println("  Compare a new firmware build against the baseline")
+		fmt.Println("  enemeter-data-processing diff --baseline=v1.csv --candidate=v2.csv --start=\"2023-04-01 12:00:00\"")
+		fmt.Println("\n  Fail on any change for the worse above 2%")
+		fmt.Println("  enemeter-data-processing diff --baseline=v1.csv --candidate=v2.csv --start=\"2023-04-01 12:00:00\" --regression-threshold=2")
+		fmt.Println("\nThe exit code is 2 when a metric regressed and 1 on errors.")
+		fmt.Println("\nOptions:")
+		diffCmd.PrintDefaults()
+	}
+
+	return diffCmd
+}
+
+// ParseDiffOptions parses command line flags into a structured options object
+func ParseDiffOptions(cmd *flag.FlagSet) DiffOptions {
+	return DiffOptions{
+		BaselineFile:        cmd.Lookup("baseline").Value.String(),
+		CandidateFile:       cmd.Lookup("candidate").Value.String(),
+		InputFormat:         cmd.Lookup("input-format").Value.String(),
+		StartTime:           cmd.Lookup("start").Value.String(),
+		CandidateStart:      cmd.Lookup("candidate-start").Value.String(),
+		Format:              OutputFormat(strings.ToLower(cmd.Lookup("format").Value.String())),
+		OutputFile:          cmd.Lookup("output").Value.String(),
+		RegressionThreshold: cmd.Lookup("regression-threshold").Value.(flag.Getter).Get().(float64),
+	}
+}
+
+// DiffCommand calculates the metrics of both files and reports the change
+// of every scalar metric. It returns a RegressionError when a metric got
+// worse by more than the regression threshold.
+func DiffCommand(options DiffOptions) error {
+	if options.BaselineFile == "" || options.CandidateFile == "" {
+		return fmt.Errorf("both --baseline and --candidate are required")
+	}
+	if options.StartTime == "" {
+		return fmt.Errorf("start time is required (--start)")
+	}
+	if options.Format != FormatText && options.Format != FormatJSON {
+		return fmt.Errorf("unsupported diff format: %s (use text or json)", options.Format)
+	}
+	if options.RegressionThreshold < 0 {
+		return fmt.Errorf("--regression-threshold must not be negative")
+	}
+
+	baselineStart, err := parseTimeString(options.StartTime, time.UTC)
+	if err != nil {
+		return fmt.Errorf("invalid start time: %w", err)
+	}
+	candidateStart := baselineStart
+	if options.CandidateStart != "" {
+		candidateStart, err = parseTimeString(options.CandidateStart, time.UTC)
+		if err != nil {
+			return fmt.Errorf("invalid candidate start time: %w", err)
+		}
+	}
+
+	baseline, err := diffMetrics(options.BaselineFile, baselineStart, options)
+	if err != nil {
+		return fmt.Errorf("baseline: %w", err)
+	}
+	candidate, err := diffMetrics(options.CandidateFile, candidateStart, options)
+	if err != nil {
+		return fmt.Errorf("candidate: %w", err)
+	}
+
+	delta := metrics.CompareMetrics(baseline, candidate, options.RegressionThreshold)
+
+	var output string
+	if options.Format == FormatJSON {
+		jsonData, err := json.MarshalIndent(diffReport{Baseline: baseline, Candidate: candidate, Delta: delta}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		output = string(jsonData)
+	} else {
+		output = generateDiffReport(delta, options)
+	}
+
+	if options.OutputFile == "" {
+		fmt.Println(output)
+	} else {
+		if err := os.WriteFile(options.OutputFile, []byte(output), 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %v", err)
+		}
+		fmt.Printf("Results saved to %s\n", options.OutputFile)
+	}
+
+	if delta.Regressions > 0 {
+		return &RegressionError{Regressions: delta.Regressions}
+	}
+	return nil
+}
+
+// diffMetrics calculates the metrics of one side of the diff
+func diffMetrics(inputFile string, startTime time.Time, options DiffOptions) (metrics.EnergyMetrics, error) {
+	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
+		return metrics.EnergyMetrics{}, fmt.Errorf("input file does not exist: %s", inputFile)
+	}
+
+	fmt.Printf("Processing data from %s...\n", inputFile)
+	return enemeter.Process(inputFile, startTime, enemeter.Options{
+		InputFormat: options.InputFormat,
+		Metrics:     metrics.MetricsOptions{ReservoirSize: metrics.DefaultReservoirSize},
+	})
+}
+
+// generateDiffReport renders the delta as a table with the regressions
+// marked
+func generateDiffReport(delta metrics.DeltaMetrics, options DiffOptions) string {
+	var sb strings.Builder
+
+	sb.WriteString("========== ENEMETER DIFF REPORT ==========\n")
+	sb.WriteString(fmt.Sprintf("Baseline: %s\n", filepath.Base(options.BaselineFile)))
+	sb.WriteString(fmt.Sprintf("Candidate: %s\n", filepath.Base(options.CandidateFile)))
+	sb.WriteString(fmt.Sprintf("Regression Threshold: %.2f%%\n\n", delta.RegressionThresholdPercent))
+
+	sb.WriteString(fmt.Sprintf("%-44s %16s %16s %16s %10s\n", "Metric", "Baseline", "Candidate", "Change", "Change %"))
+	sb.WriteString(strings.Repeat("-", 106) + "\n")
+	for _, field := range delta.Fields {
+		marker := ""
+		if field.Regression {
+			marker = "  << REGRESSION"
+		}
+		sb.WriteString(fmt.Sprintf("%-44s %16.6f %16.6f %+16.6f %+9.2f%%%s\n",
+			field.Name, field.Baseline, field.Candidate, field.AbsoluteDelta, field.PercentDelta, marker))
+	}
+
+	sb.WriteString(fmt.Sprintf("\nRegressions: %d\n", delta.Regressions))
+	return sb.String()
+}
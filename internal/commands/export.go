@@ -0,0 +1,156 @@
+package commands
+
+import (
+	"enemeter-data-processing/pkg/parser"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// ExportOptions holds the options of the export command
+type ExportOptions struct {
+	InputFile          string
+	InputFormat        string
+	OutputFile         string
+	AbsoluteTimestamps bool
+
+	StartTime  string
+	EndTime    string
+	SampleRate int
+	MaxRecords int
+
+	VoltageMin int64
+	VoltageMax int64
+	CurrentMin int64
+	CurrentMax int64
+}
+
+// SetupExportCommand configures the export command with all its flags
+func SetupExportCommand() *flag.FlagSet {
+	exportCmd := flag.NewFlagSet("export", flag.ExitOnError)
+
+	exportCmd.String("input", "", "Path to the input file (.gz files are decompressed automatically)")
+	exportCmd.String("input-format", "", "Input format: csv or jsonl (default: jsonl for .jsonl files, csv otherwise)")
+	exportCmd.String("output", "", "Path of the CSV file to write - REQUIRED")
+	exportCmd.Bool("absolute-timestamps", false, "Add a timestamp column with the absolute ISO-8601 time of every record (ignored when the file is read back)")
+
+	exportCmd.String("start", "", "Start time for measurements (format: YYYY-MM-DD HH:MM:SS) - REQUIRED")
+	exportCmd.String("end", "", "End time for filtering (format: YYYY-MM-DD[THH:MM:SS])")
+	exportCmd.Int("sample", 1, "Export every Nth record (1 = all records)")
+	exportCmd.Int("max", 0, "Maximum records to export (0 = no limit)")
+	exportCmd.Int64("volt-min", 0, "Minimum voltage threshold in microvolts")
+	exportCmd.Int64("volt-max", 0, "Maximum voltage threshold in microvolts")
+	exportCmd.Int64("curr-min", 0, "Minimum current threshold in nanoamperes")
+	exportCmd.Int64("curr-max", 0, "Maximum current threshold in nanoamperes")
+
+	exportCmd.Usage = func() {
+		fmt.Println(AppName + " - Export filtered ENEMETER records as CSV")
+		fmt.Println("\nUsage:")
+		fmt.Println("  enemeter-data-processing export [options]")
+		fmt.Println("\nExamples:")
+		fmt.Println("  Extract one hour of data")
+		fmt.Println("  enemeter-data-processing export --input=data.csv --start=\"2023-04-01 12:00:00\" --end=\"2023-04-01T13:00:00\" --output=hour.csv")
+		fmt.Println("\n  Downsample a large file with absolute timestamps")
+		fmt.Println("  enemeter-data-processing export --input=big-data.csv --start=\"2023-04-01 12:00:00\" --sample=100 --absolute-timestamps --output=small.csv")
+		fmt.Println("\nOptions:")
+		exportCmd.PrintDefaults()
+	}
+
+	return exportCmd
+}
+
+// ParseExportOptions parses command line flags into a structured options object
+func ParseExportOptions(cmd *flag.FlagSet) ExportOptions {
+	return ExportOptions{
+		InputFile:          cmd.Lookup("input").Value.String(),
+		InputFormat:        cmd.Lookup("input-format").Value.String(),
+		OutputFile:         cmd.Lookup("output").Value.String(),
+		AbsoluteTimestamps: cmd.Lookup("absolute-timestamps").Value.(flag.Getter).Get().(bool),
+		StartTime:          cmd.Lookup("start").Value.String(),
+		EndTime:            cmd.Lookup("end").Value.String(),
+		SampleRate:         cmd.Lookup("sample").Value.(flag.Getter).Get().(int),
+		MaxRecords:         cmd.Lookup("max").Value.(flag.Getter).Get().(int),
+		VoltageMin:         cmd.Lookup("volt-min").Value.(flag.Getter).Get().(int64),
+		VoltageMax:         cmd.Lookup("volt-max").Value.(flag.Getter).Get().(int64),
+		CurrentMin:         cmd.Lookup("curr-min").Value.(flag.Getter).Get().(int64),
+		CurrentMax:         cmd.Lookup("curr-max").Value.(flag.Getter).Get().(int64),
+	}
+}
+
+// ExportCommand streams the records that pass the filters into a CSV file
+// one row at a time, so memory use does not grow with the input size
+func ExportCommand(options ExportOptions) (err error) {
+	if options.InputFile == "" {
+		return fmt.Errorf("input file is required (--input)")
+	}
+	if options.OutputFile == "" {
+		return fmt.Errorf("output file is required (--output)")
+	}
+	if options.StartTime == "" {
+		return fmt.Errorf("start time is required (--start)")
+	}
+	if _, err := os.Stat(options.InputFile); os.IsNotExist(err) {
+		return fmt.Errorf("input file does not exist: %s", options.InputFile)
+	}
+
+	// The export filters are a subset of the process ones
+	filterOptions, err := buildFilterOptions(CommandLineOptions{
+		StartTime:  options.StartTime,
+		EndTime:    options.EndTime,
+		SampleRate: options.SampleRate,
+		MaxRecords: options.MaxRecords,
+		VoltageMin: options.VoltageMin,
+		VoltageMax: options.VoltageMax,
+		CurrentMin: options.CurrentMin,
+		CurrentMax: options.CurrentMax,
+		VoltScale:  1,
+		CurrScale:  1,
+		TempScale:  1,
+	})
+	if err != nil {
+		return fmt.Errorf("error configuring filters: %v", err)
+	}
+
+	inputParser, err := parser.NewRecordParser(options.InputFile, options.InputFormat, filterOptions, parser.CountModeEstimate)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(options.OutputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("error closing output file: %w", closeErr)
+		}
+	}()
+
+	writer := parser.NewCSVWriter(file)
+	if options.AbsoluteTimestamps {
+		writer.WithAbsoluteTimestamps()
+	}
+	if err := writer.WriteHeader(); err != nil {
+		return err
+	}
+
+	// Time deltas are rewritten relative to the previous exported record, so
+	// reading the export with the same --start gives the same timestamps
+	previous := *filterOptions.StartTime
+	exported := 0
+	err = inputParser.StreamRecords(func(record parser.EnemeterRecord) error {
+		record.TimeDeltaMs = record.Timestamp.Sub(previous).Milliseconds()
+		previous = record.Timestamp
+		exported++
+		return writer.Write(record)
+	})
+	if err != nil {
+		return fmt.Errorf("error exporting records: %w", err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d records to %s\n", exported, options.OutputFile)
+	return nil
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"enemeter-data-processing/pkg/parser"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExportRoundTrip(t *testing.T) {
+	// Two minutes of readings with uneven deltas and varying voltage
+	rows := []string{"0,3600000,1000000,25000"}
+	for i := 1; i <= 120; i++ {
+		delta := 1000
+		if i%3 == 0 {
+			delta = 500
+		}
+		rows = append(rows, fmt.Sprintf("%d,%d,1000000,25000", delta, 3600000+i%7*10000))
+	}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(time.Minute)
+
+	tests := []struct {
+		name    string
+		options ExportOptions
+		filter  parser.FilterOptions
+	}{
+		{"all records", ExportOptions{}, parser.FilterOptions{}},
+		{"time range", ExportOptions{EndTime: "2024-01-01T12:01:00"}, parser.FilterOptions{EndTime: &end}},
+		{"every third record", ExportOptions{SampleRate: 3}, parser.FilterOptions{SampleRate: 3}},
+		{"voltage range", ExportOptions{VoltageMin: 3620000, VoltageMax: 3640000}, parser.FilterOptions{VoltageRange: &[2]int64{3620000, 3640000}}},
+		{"limited", ExportOptions{MaxRecords: 10}, parser.FilterOptions{MaxRecords: 10}},
+		{"absolute timestamps", ExportOptions{AbsoluteTimestamps: true}, parser.FilterOptions{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := writeInput(t, dir, "input.csv", rows)
+			output := filepath.Join(dir, "export.csv")
+
+			tt.options.InputFile = input
+			tt.options.OutputFile = output
+			tt.options.StartTime = "2024-01-01 12:00:00"
+			captureStdout(t, func() {
+				if err := ExportCommand(tt.options); err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			tt.filter.StartTime = &start
+			want, err := parser.NewCSVParser(input).WithFilterOptions(tt.filter).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parser.NewCSVParser(output).WithFilterOptions(parser.FilterOptions{StartTime: &start}).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) == 0 || len(got) != len(want) {
+				t.Fatalf("read back %d records, want %d", len(got), len(want))
+			}
+			for i := range got {
+				// Only the deltas change, so that every record keeps its time
+				want[i].TimeDeltaMs = got[i].TimeDeltaMs
+				if !reflect.DeepEqual(got[i], want[i]) {
+					t.Fatalf("record %d = %+v, want %+v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
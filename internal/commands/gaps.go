@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"enemeter-data-processing/pkg/parser"
+)
+
+// maxListedGaps limits how many individual gaps the report lists
+const maxListedGaps = 10
+
+// gapCollector gathers the gaps reported by the parsers. Merged inputs are
+// parsed concurrently, so add may be called from several goroutines.
+type gapCollector struct {
+	mu   sync.Mutex
+	gaps []parser.GapEvent
+}
+
+func (c *gapCollector) add(gap parser.GapEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gaps = append(c.gaps, gap)
+}
+
+func (c *gapCollector) events() []parser.GapEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gaps
+}
+
+// formatGapSummary renders the DATA GAPS section of the text report
+func formatGapSummary(gaps []parser.GapEvent, thresholdMs int64, sep string) string {
+	var sb strings.Builder
+
+	sb.WriteString("\nDATA GAPS\n")
+	sb.WriteString("---------\n")
+
+	var total, longest int64
+	for _, gap := range gaps {
+		total += gap.GapMs
+		if gap.GapMs > longest {
+			longest = gap.GapMs
+		}
+	}
+
+	sb.WriteString(TableRow("Gap Threshold", fmt.Sprintf("%d", thresholdMs), "ms", sep))
+	sb.WriteString(TableRow("Gaps Detected", fmt.Sprintf("%d", len(gaps)), "", sep))
+	if len(gaps) == 0 {
+		return sb.String()
+	}
+	sb.WriteString(TableRow("Total Gap Time", fmt.Sprintf("%.3f", float64(total)/1000.0), "seconds", sep))
+	sb.WriteString(TableRow("Longest Gap", fmt.Sprintf("%.3f", float64(longest)/1000.0), "seconds", sep))
+
+	for i, gap := range gaps {
+		if i == maxListedGaps {
+			sb.WriteString(fmt.Sprintf("... and %d more\n", len(gaps)-maxListedGaps))
+			break
+		}
+		sb.WriteString(TableRow(fmt.Sprintf("Record %d", gap.RecordIndex),
+			fmt.Sprintf("%s to %s (%s)", gap.Start.Format("2006-01-02 15:04:05"), gap.End.Format("2006-01-02 15:04:05"),
+				time.Duration(gap.GapMs)*time.Millisecond), "", sep))
+	}
+
+	return sb.String()
+}
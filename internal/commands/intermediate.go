@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"enemeter-data-processing/pkg/parser"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SaveIntermediateCSV writes a record set to path in the input CSV format
+func SaveIntermediateCSV(records []parser.EnemeterRecord, path string) (err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("error closing file: %w", closeErr)
+		}
+	}()
+
+	return parser.NewCSVWriter(file).WriteAll(records)
+}
+
+// intermediateFiles keeps the record set after each pipeline stage when
+// --keep-tmp is set. A nil *intermediateFiles is valid and saves nothing.
+type intermediateFiles struct {
+	dir   string
+	paths []string
+}
+
+func newIntermediateFiles(options CommandLineOptions) (*intermediateFiles, error) {
+	if !options.KeepTmp {
+		return nil, nil
+	}
+
+	dir := options.TmpDir
+	if dir == "" {
+		var err error
+		dir, err = os.MkdirTemp("", "enemeter-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	return &intermediateFiles{dir: dir}, nil
+}
+
+// save writes the records of the named stage as NN_<stage>.csv, numbering
+// stages in the order they are saved
+func (f *intermediateFiles) save(stage string, records []parser.EnemeterRecord) error {
+	if f == nil {
+		return nil
+	}
+
+	path := filepath.Join(f.dir, fmt.Sprintf("%02d_%s.csv", len(f.paths)+1, stage))
+	if err := SaveIntermediateCSV(records, path); err != nil {
+		return fmt.Errorf("failed to save %s records: %w", stage, err)
+	}
+	f.paths = append(f.paths, path)
+	return nil
+}
+
+func (f *intermediateFiles) printSummary() {
+	if f == nil || len(f.paths) == 0 {
+		return
+	}
+
+	fmt.Println("Intermediate files:")
+	for _, path := range f.paths {
+		fmt.Printf("  %s\n", path)
+	}
+}
@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"enemeter-data-processing/pkg/parser"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIntermediateFiles(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []parser.EnemeterRecord{
+		{TimeDeltaMs: 1000, VoltageMicroV: 3700000, CurrentNanoA: 1000000, TempMiliCelsius: 25000, Timestamp: start.Add(time.Second)},
+		{TimeDeltaMs: 1000, VoltageMicroV: 3690000, CurrentNanoA: 1100000, TempMiliCelsius: 25100, Timestamp: start.Add(2 * time.Second)},
+	}
+
+	tests := []struct {
+		name      string
+		keepTmp   bool
+		stages    []string
+		wantFiles []string
+	}{
+		{"disabled", false, []string{"parsed", "resampled", "smoothed"}, nil},
+		{"three stages", true, []string{"parsed", "resampled", "smoothed"}, []string{"01_parsed.csv", "02_resampled.csv", "03_smoothed.csv"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "tmp")
+			files, err := newIntermediateFiles(CommandLineOptions{KeepTmp: tt.keepTmp, TmpDir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, stage := range tt.stages {
+				if err := files.save(stage, records); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			if !reflect.DeepEqual(names, tt.wantFiles) {
+				t.Fatalf("files = %v, want %v", names, tt.wantFiles)
+			}
+
+			for _, name := range names {
+				saved, err := parser.NewCSVParser(filepath.Join(dir, name)).
+					WithFilterOptions(parser.FilterOptions{StartTime: &start, SampleRate: 1}).Parse()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(saved, records) {
+					t.Errorf("%s holds %v, want %v", name, saved, records)
+				}
+			}
+		})
+	}
+}
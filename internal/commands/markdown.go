@@ -0,0 +1,237 @@
+package commands
+
+import (
+	"encoding/base64"
+	"enemeter-data-processing/pkg/metrics"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// markdownSep separates the columns of the text report that is converted to
+// Markdown; it cannot appear in any value
+const markdownSep = "\x1f"
+
+// generateMarkdownOutput renders the report, or the metric selected with
+// --metric, as a Markdown document for pasting into a pull request comment
+func generateMarkdownOutput(energyMetrics metrics.EnergyMetrics, options CommandLineOptions) (string, error) {
+	var sb strings.Builder
+
+	sb.WriteString("## ENEMETER Report\n\n")
+	if options.MarkdownBadge {
+		sb.WriteString(markdownBadge(energyMetrics.TotalJoules, options.BudgetJoules) + "\n\n")
+	}
+
+	options.FieldSep = markdownSep
+	if options.Metric == "" {
+		sb.WriteString(markdownFromText(generateReport(energyMetrics, options)))
+		sb.WriteString(markdownHourlyChart(energyMetrics.EnergyConsumptionByHour))
+		return sb.String(), nil
+	}
+
+	metricType := metrics.MetricType(options.Metric)
+	if metricType == metrics.MetricSolarContribution && options.NoSolar {
+		return "", fmt.Errorf("solar statistics are disabled by --no-solar")
+	}
+	if metricType == metrics.MetricBatteryDischarge && options.NoBattery {
+		return "", fmt.Errorf("battery statistics are disabled by --no-battery")
+	}
+	specificMetric, err := metrics.GetSpecificMetric(energyMetrics, metricType)
+	if err != nil {
+		return "", err
+	}
+
+	sb.WriteString(markdownFromText(formatMetricAsText(specificMetric, metricType, markdownSep, options.ReservoirSize > 0)))
+
+	// Histograms keep their bar chart, which needs a fixed-width font
+	if histogram := formatMetricHistogram(energyMetrics, metricType, ""); histogram != "" {
+		sb.WriteString("```\n" + strings.TrimLeft(histogram, "\n") + "```\n\n")
+	}
+	if metricType == metrics.MetricEnergyByHour {
+		sb.WriteString(markdownHourlyChart(energyMetrics.EnergyConsumptionByHour))
+	}
+	return sb.String(), nil
+}
+
+// markdownFromText converts a text report written with markdownSep as the
+// field separator: section titles become headings, runs of rows become
+// tables and "Label: value" lines become two-column rows
+func markdownFromText(text string) string {
+	var sb strings.Builder
+	var table [][]string
+
+	flush := func() {
+		if len(table) == 0 {
+			return
+		}
+		sb.WriteString(markdownTable(table))
+		sb.WriteString("\n")
+		table = nil
+	}
+
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+
+		switch {
+		case line == "":
+			flush()
+
+		case strings.HasPrefix(line, "====="):
+			flush()
+			title := strings.TrimSpace(strings.Trim(line, "="))
+			// The full report title is already the document heading
+			if title != "ENEMETER DATA PROCESSING REPORT" {
+				sb.WriteString("### " + markdownTitle(title) + "\n\n")
+			}
+
+		case i+1 < len(lines) && isUnderline(lines[i+1]):
+			flush()
+			sb.WriteString("### " + markdownTitle(line) + "\n\n")
+			i++
+
+		case strings.Contains(line, markdownSep):
+			table = append(table, strings.Split(line, markdownSep))
+
+		case strings.Contains(line, ": "):
+			label, value, _ := strings.Cut(line, ": ")
+			table = append(table, []string{label, value})
+
+		case strings.HasSuffix(line, ":"):
+			flush()
+			sb.WriteString("#### " + strings.TrimSuffix(line, ":") + "\n\n")
+
+		default:
+			flush()
+			sb.WriteString(line + "\n\n")
+		}
+	}
+	flush()
+
+	return sb.String()
+}
+
+// isUnderline reports whether a line only consists of dashes
+func isUnderline(line string) bool {
+	line = strings.TrimSpace(line)
+	return line != "" && strings.Trim(line, "-") == ""
+}
+
+// markdownTitle turns an upper-case section title or metric name into
+// title case
+func markdownTitle(title string) string {
+	words := strings.Fields(strings.ToLower(strings.ReplaceAll(title, "_", " ")))
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// markdownTable renders rows of label, value and optional further columns
+// as a table; shorter rows are padded with empty cells
+func markdownTable(rows [][]string) string {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+
+	header := make([]string, width)
+	header[0] = "Metric"
+	if width > 1 {
+		header[1] = "Value"
+	}
+	if width == 3 {
+		header[2] = "Unit"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(markdownRow(header))
+	sb.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+	for _, row := range rows {
+		cells := make([]string, width)
+		copy(cells, row)
+		sb.WriteString(markdownRow(cells))
+	}
+	return sb.String()
+}
+
+func markdownRow(cells []string) string {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		escaped[i] = strings.ReplaceAll(strings.TrimSpace(cell), "|", `\|`)
+	}
+	return "| " + strings.Join(escaped, " | ") + " |\n"
+}
+
+// markdownHourlyChart draws the hourly energy as a bar chart in a code
+// block. Bars show the magnitude; the value keeps its sign, so a negative
+// hour was net charging.
+func markdownHourlyChart(energyByHour map[int]float64) string {
+	if len(energyByHour) == 0 {
+		return ""
+	}
+
+	largest := 0.0
+	for _, joules := range energyByHour {
+		largest = max(largest, math.Abs(joules))
+	}
+
+	var sb strings.Builder
+	sb.WriteString("### Hourly Energy Chart\n\n```\n")
+	for hour := 0; hour < 24; hour++ {
+		joules, exists := energyByHour[hour]
+		if !exists {
+			continue
+		}
+		bar := 0
+		if largest > 0 {
+			bar = int(math.Abs(joules)/largest*histogramBarWidth + 0.5)
+		}
+		sb.WriteString(fmt.Sprintf("%02d:00 |%-*s %.4f J\n", hour, histogramBarWidth, strings.Repeat("#", bar), joules))
+	}
+	sb.WriteString("```\n\n")
+	return sb.String()
+}
+
+// Badge colors of markdownBadge
+const (
+	badgeGreen  = "#4c1"
+	badgeYellow = "#dfb317"
+	badgeRed    = "#e05d44"
+	badgeBlue   = "#007ec6"
+)
+
+// markdownBadge renders the total energy as an SVG badge embedded in a
+// Markdown image. With a --budget-joules limit it is green up to 80% of the
+// budget, yellow up to the budget and red above it; without one it is blue.
+func markdownBadge(totalJoules, budgetJoules float64) string {
+	color := badgeBlue
+	if budgetJoules > 0 {
+		switch {
+		case totalJoules > budgetJoules:
+			color = badgeRed
+		case totalJoules > 0.8*budgetJoules:
+			color = badgeYellow
+		default:
+			color = badgeGreen
+		}
+	}
+
+	const label = "energy"
+	value := fmt.Sprintf("%.2f J", totalJoules)
+
+	// Approximate the text widths of the usual 11px Verdana badge font
+	labelWidth := 6*len(label) + 10
+	valueWidth := 7*len(value) + 10
+	width := labelWidth + valueWidth
+
+	svg := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20">`+
+		`<rect width="%d" height="20" fill="#555"/>`+
+		`<rect x="%d" width="%d" height="20" fill="%s"/>`+
+		`<g fill="#fff" font-family="Verdana,sans-serif" font-size="11" text-anchor="middle">`+
+		`<text x="%d" y="14">%s</text><text x="%d" y="14">%s</text></g></svg>`,
+		width, labelWidth, labelWidth, valueWidth, color,
+		labelWidth/2, label, labelWidth+valueWidth/2, value)
+
+	return fmt.Sprintf("![%s: %s](data:image/svg+xml;base64,%s)", label, value, base64.StdEncoding.EncodeToString([]byte(svg)))
+}
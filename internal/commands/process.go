@@ -2,13 +2,16 @@ package commands
 
 import (
 	"encoding/json"
-	"enemeter-data-processing/internal/metrics"
-	"enemeter-data-processing/internal/parser"
+	"enemeter-data-processing/internal/output"
+	"enemeter-data-processing/pkg/metrics"
+	"enemeter-data-processing/pkg/parser"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 )
@@ -20,24 +23,103 @@ const (
 	FormatText OutputFormat = "text"
 	FormatJSON OutputFormat = "json"
 	FormatCSV  OutputFormat = "csv"
+
+	// FormatShell emits "export NAME=value" lines for eval in shell scripts
+	FormatShell OutputFormat = "shell"
+
+	// FormatSQLite stores the report in the SQLite database given by --output
+	FormatSQLite OutputFormat = "sqlite"
+
+	// FormatMarkdown renders the text report as Markdown tables, e.g. for
+	// pull request comments
+	FormatMarkdown OutputFormat = "markdown"
 )
 
+// inputList collects the values of a flag that may be repeated
+type inputList []string
+
+func (l *inputList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *inputList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func (l *inputList) Get() interface{} {
+	return []string(*l)
+}
+
 // CommandLineOptions holds all CLI options
 type CommandLineOptions struct {
 	// Input/output options
-	InputFile  string
-	OutputFile string
-	Format     OutputFormat
+	InputFiles  []string // --input, may be repeated
+	InputGlob   string
+	Compressed  bool
+	InputFormat string // "csv" or "jsonl", empty = by file extension
+	OutputFile  string
+	Format      OutputFormat
+	FieldSep    string // column separator for text tables, empty keeps "Label: value"
+
+	// Shell output options
+	ShellPrefix      string
+	ShellIncludeMaps bool
+	MarkdownBadge    bool // start --format=markdown with a total energy badge
+
+	// HTTP output options
+	OutputURL        string
+	OutputURLToken   string
+	OutputURLTimeout time.Duration
 
 	// Processing options
 	UseStreaming bool
+	ExactCount   bool // count the input rows instead of estimating them
+	Workers      int  // files processed concurrently, capped at the number of CPUs
 	SampleRate   int
+
+	// Watch keeps following the input for appended rows, reprinting the
+	// report every WatchInterval while new records arrive
+	Watch         bool
+	WatchInterval time.Duration
+
 	MaxRecords   int
+	RandomSample bool
+	RandomSeed   int64
+
+	// Resampling options
+	ResampleInterval   string // e.g. "100ms", "1s"
+	ResampleMs         int64  // same as ResampleInterval in milliseconds
+	AggregateBy        string // "day", "hour", "file" or a duration such as "6h"
+	ResampleOutputFile string
+
+	// Metrics options
+	ExactPercentiles bool
+	NoSolar          bool
+	NoBattery        bool
+
+	// Cost options
+	EnergyRate        float64 // price per kWh in RateCurrency
+	RateCurrency      string
+	Currency          string
+	ExchangeRate      float64
+	FetchExchangeRate bool
+
+	// Debugging options
+	Verbose bool
+	KeepTmp bool
+	TmpDir  string
 
 	// Time filtering options
 	StartTime  string
 	EndTime    string
 	TimeWindow string // e.g. "1h", "30m", "24h"
+	Timezone   string // IANA name such as "Europe/Berlin", empty = UTC
+
+	// Calendar period shortcuts, alternatives to --start
+	StartOfDay   string
+	StartOfWeek  string
+	StartOfMonth string
 
 	// Data filtering options
 	MinTemp    int64
@@ -46,6 +128,50 @@ type CommandLineOptions struct {
 	CurrentMin int64
 	CurrentMax int64
 
+	// Unit scale factors for firmware that logs other units
+	VoltScale float64
+	CurrScale float64
+	TempScale float64
+
+	// ColumnMap maps CSV header names to the standard columns,
+	// e.g. "v_mv=voltage_uv,i_ua=current_na"
+	ColumnMap string
+
+	ExcludeZeroPower bool
+	MaxGapMs         int64 // report time deltas above this, 0 = disabled
+	AnomalySigma     float64
+	AnomalyWindow    int
+	MaxSlewRate      float64 // amperes per second, 0 = disabled
+
+	DropNonPositiveDelta bool
+	MaxTimeDeltaMs       int64 // skip records with larger deltas, 0 = disabled
+
+	RequireCompleteHours bool
+
+	ThermalRunawayThreshold float64 // °C/s
+
+	BatteryCapacityAh float64
+	CycleDeadbandNa   int64
+
+	HistogramBuckets int
+	ReservoirSize    int
+
+	PeakThresholdW float64 // watts, 0 = no peak event log
+
+	// Current thresholds of the efficiency metric in nanoamperes
+	LoadThresholdNanoA   int64
+	ChargeThresholdNanoA int64
+
+	// EpochTimestamps reads column 0 as absolute epoch milliseconds
+	EpochTimestamps bool
+
+	// Power budget limits, 0 = no limit. A breach makes ProcessCommand
+	// return a BudgetExceededError.
+	BudgetJoules   float64
+	BudgetAvgW     float64
+	BudgetPeakW    float64
+	BudgetMaxTempC float64
+
 	// Specific metrics to extract
 	Metric string
 }
@@ -55,19 +181,57 @@ func SetupProcessCommand() *flag.FlagSet {
 	processCmd := flag.NewFlagSet("process", flag.ExitOnError)
 
 	// Input/output options
-	processCmd.String("input", "", "Path to the input CSV file")
+	processCmd.Var(&inputList{}, "input", "Path to an input CSV file (.gz files are decompressed automatically), or - for standard input; repeat to merge several files")
+	processCmd.String("input-glob", "", "Glob pattern of input CSV files to merge, e.g. \"logs/*.csv\"")
+	processCmd.Bool("compressed", false, "Treat the input as gzip-compressed regardless of its extension")
+	processCmd.String("input-format", "", "Input format: csv or jsonl (default: jsonl for .jsonl files, csv otherwise)")
 	processCmd.String("output", "", "Path to save the output report (optional)")
-	processCmd.String("format", "text", "Output format: text, json, or csv")
+	processCmd.String("format", "text", "Output format: text, json, csv, shell, markdown, or sqlite (requires --output)")
+	processCmd.String("shell-prefix", "ENEMETER", "Variable name prefix for --format=shell")
+	processCmd.Bool("shell-include-maps", false, "Include map fields such as hourly energy in --format=shell")
+	processCmd.Bool("markdown-badge", false, "Start --format=markdown with a badge of the total energy, colored by --budget-joules")
+	processCmd.String("field-sep", "", "Column separator for text output tables, e.g. \"\\t\" or \"|\" (default: \"Label: value\")")
+	processCmd.String("output-url", "", "POST the JSON report to this URL instead of printing it (optional)")
+	processCmd.String("output-url-token", "", "Bearer token sent in the Authorization header with --output-url")
+	processCmd.String("output-url-auth-header", "", "Deprecated: use --output-url-token")
+	processCmd.Duration("output-url-timeout", output.DefaultHTTPTimeout, "Timeout of each POST to --output-url")
 
 	// Processing options
 	processCmd.Bool("stream", false, "Use streaming mode for processing large files")
+	processCmd.Bool("exact-count", false, "Count the input rows exactly instead of estimating them from the file size")
+	processCmd.Int("workers", 1, "Number of input files to process concurrently, merging their metrics unless --aggregate-by=file (capped at the number of CPUs)")
+	processCmd.Bool("watch", false, "Keep following the input file and reprint the report when rows are appended, until Ctrl-C")
+	processCmd.Duration("watch-interval", 5*time.Second, "How often --watch polls the input file for new rows")
 	processCmd.Int("sample", 1, "Process every Nth record (1 = all records)")
 	processCmd.Int("max", 0, "Maximum records to process (0 = no limit)")
+	processCmd.Bool("randomize", false, "Pick a random sample of records instead of every Nth one (used with --sample)")
+	processCmd.Int64("seed", 0, "Random seed for --randomize (0 = time-based)")
+	processCmd.Bool("no-solar", false, "Skip solar/charging statistics (for devices without a charging source)")
+	processCmd.Bool("no-battery", false, "Skip battery discharge statistics")
+	processCmd.String("resample", "", "Resample records to a fixed interval before calculating metrics (e.g., 100ms, 1s)")
+	processCmd.String("aggregate-by", "", "Report the metrics of every day, hour, custom duration (e.g., 6h) or input file separately")
+	processCmd.Int64("resample-ms", 0, "Resample records to a fixed interval in milliseconds (alternative to --resample)")
+	processCmd.String("resample-output", "", "Also write the resampled records to this CSV file")
+	processCmd.Bool("no-timestamp-accumulation", false, "Treat the first column as absolute milliseconds since the Unix epoch instead of a time delta (--start is ignored)")
+	processCmd.Float64("battery-capacity-ah", 0, "Nominal battery capacity in Ah, enables the state-of-charge estimate (assumes a full battery at the start)")
+	processCmd.Int64("cycle-deadband-na", 0, "Current in nanoamperes that must be exceeded to switch between charge and discharge cycles")
+	processCmd.Int("histogram-buckets", metrics.DefaultHistogramBuckets, "Number of buckets of the voltage, current and temperature histograms")
+	processCmd.Int("reservoir-size", metrics.DefaultReservoirSize, "Number of readings per channel sampled for the estimated percentiles and medians (0 = disabled)")
+	processCmd.Float64("peak-threshold-w", 0, "List every run of records whose power exceeds this many watts as a peak event (0 = disabled)")
+	processCmd.Int64("load-threshold-na", 0, "Discharge current in nanoamperes above which energy counts as output to the load in the efficiency metric")
+	processCmd.Int64("charge-threshold-na", 0, "Charge current in nanoamperes above which energy counts as input in the efficiency metric")
+	processCmd.Float64("thermal-runaway-threshold", metrics.DefaultThermalRunawayThreshold, "Temperature rise in °C/s above which a thermal runaway risk is reported")
+	processCmd.Bool("require-complete-hours", false, "Leave hours with less than 60 minutes of data out of the hourly energy breakdown")
+	processCmd.Bool("exact-percentiles", false, "Compute exact P5/P25/P50/P75/P95 percentiles (not available with --stream)")
 
 	// Make start time required and clarify that it must include time of day
 	processCmd.String("start", "", "Start time for measurements (format: YYYY-MM-DD HH:MM:SS) - REQUIRED")
 	processCmd.String("end", "", "End time for filtering (format: YYYY-MM-DD[THH:MM:SS])")
 	processCmd.String("window", "", "Time window to process (e.g., 1h, 30m, 24h)")
+	processCmd.String("start-of-day", "", "Process one calendar day starting at midnight of this date (format: YYYY-MM-DD), instead of --start")
+	processCmd.String("start-of-week", "", "Process the Monday-to-Sunday week containing this date (format: YYYY-MM-DD), instead of --start")
+	processCmd.String("start-of-month", "", "Process the calendar month containing this date (format: YYYY-MM[-DD]), instead of --start")
+	processCmd.String("timezone", "", "Time zone of --start, --end and the reported times and hours, e.g. Europe/Berlin (default: UTC)")
 
 	// Data filtering options
 	processCmd.Int64("min-temp", 0, "Minimum temperature threshold in millicelsius")
@@ -75,11 +239,40 @@ func SetupProcessCommand() *flag.FlagSet {
 	processCmd.Int64("volt-max", 0, "Maximum voltage threshold in microvolts")
 	processCmd.Int64("curr-min", 0, "Minimum current threshold in nanoamperes")
 	processCmd.Int64("curr-max", 0, "Maximum current threshold in nanoamperes")
+	processCmd.Float64("volt-scale", 1, "Multiply the voltage column by this factor to get microvolts, e.g. 1000 for millivolt logs")
+	processCmd.Float64("curr-scale", 1, "Multiply the current column by this factor to get nanoamperes, e.g. 1000 for microampere logs")
+	processCmd.Float64("temp-scale", 1, "Multiply the temperature column by this factor to get millicelsius, e.g. 100 for decidegree logs")
+	processCmd.String("column-map", "", "Map CSV header names to time_delta_ms, voltage_uv, current_na or temp_mc (e.g., v_mv=voltage_uv,note=); an empty target ignores the column")
+	processCmd.Bool("exclude-zero-power", false, "Skip records where voltage or current is exactly zero")
+	processCmd.Float64("anomaly-sigma", 0, "Flag readings more than this many standard deviations from the local mean, e.g. 3 (0 = disabled)")
+	processCmd.Int("anomaly-window", metrics.DefaultAnomalyWindow, "Number of preceding samples used for the local mean in --anomaly-sigma")
+	processCmd.Int64("max-gap-ms", 0, "Report time deltas larger than this many milliseconds as data gaps (0 = disabled)")
+	processCmd.Float64("max-slew-rate", 0, "Skip records whose current changes faster than this many amperes per second (0 = disabled)")
+	processCmd.Bool("drop-nonpositive-delta", false, "Skip records with a time delta of zero or less (corrupted rows)")
+	processCmd.Int64("max-time-delta-ms", 0, "Skip records with a time delta larger than this many milliseconds (0 = disabled)")
+
+	// Cost options
+	processCmd.Float64("energy-rate", 0, "Energy price per kWh, enables the cost analysis")
+	processCmd.String("rate-schedule-currency", "USD", "Currency of --energy-rate")
+	processCmd.String("currency", "", "Report the cost in this currency (default: the rate schedule currency)")
+	processCmd.Float64("exchange-rate", 0, "Units of --currency per unit of --rate-schedule-currency")
+	processCmd.Bool("fetch-exchange-rate", false, "Look up the exchange rate online instead of using --exchange-rate")
+
+	// Debugging options
+	processCmd.Bool("verbose", false, "Print the first and last parsed records with their computed timestamps")
+	processCmd.Bool("keep-tmp", false, "Save the records after each processing stage as CSV files for debugging")
+	processCmd.String("tmp-dir", "", "Directory for --keep-tmp files (default: a new temporary directory)")
+
+	// Power budget options
+	processCmd.Float64("budget-joules", 0, "Fail with exit code 2 if the total energy exceeds this many joules (0 = no limit)")
+	processCmd.Float64("budget-avg-w", 0, "Fail with exit code 2 if the average power exceeds this many watts (0 = no limit)")
+	processCmd.Float64("budget-peak-w", 0, "Fail with exit code 2 if the peak power exceeds this many watts (0 = no limit)")
+	processCmd.Float64("budget-max-temp-c", 0, "Fail with exit code 2 if the maximum temperature exceeds this many °C (0 = no limit)")
 
 	// Specific metrics extraction
 	processCmd.String("metric", "",
 		"Extract specific metric: total_energy, average_power, peak_power, temperature, "+
-			"energy_by_hour, voltage_stats, current_stats, battery_discharge, solar_contribution")
+			"energy_by_hour, energy_by_minute, voltage_stats, current_stats, battery_discharge, solar_contribution, papr, efficiency")
 
 	// Help function for the process command
 	processCmd.Usage = func() {
@@ -112,12 +305,29 @@ func SetupProcessCommand() *flag.FlagSet {
 // ParseCommandLineOptions parses command line flags into a structured options object
 func ParseCommandLineOptions(cmd *flag.FlagSet) CommandLineOptions {
 	// Input/output options
-	inputFile := cmd.Lookup("input").Value.String()
+	inputFiles := cmd.Lookup("input").Value.(flag.Getter).Get().([]string)
+	inputGlob := cmd.Lookup("input-glob").Value.String()
+	compressed := cmd.Lookup("compressed").Value.(flag.Getter).Get().(bool)
+	inputFormat := cmd.Lookup("input-format").Value.String()
 	outputFile := cmd.Lookup("output").Value.String()
 	format := cmd.Lookup("format").Value.String()
+	shellPrefix := cmd.Lookup("shell-prefix").Value.String()
+	shellIncludeMaps := cmd.Lookup("shell-include-maps").Value.(flag.Getter).Get().(bool)
+	markdownBadge := cmd.Lookup("markdown-badge").Value.(flag.Getter).Get().(bool)
+	fieldSep := strings.ReplaceAll(cmd.Lookup("field-sep").Value.String(), `\t`, "\t")
+	outputURL := cmd.Lookup("output-url").Value.String()
+	outputURLToken := cmd.Lookup("output-url-token").Value.String()
+	if outputURLToken == "" {
+		outputURLToken = cmd.Lookup("output-url-auth-header").Value.String()
+	}
+	outputURLTimeout := cmd.Lookup("output-url-timeout").Value.(flag.Getter).Get().(time.Duration)
 
 	// Processing options
 	useStreaming := cmd.Lookup("stream").Value.(flag.Getter).Get().(bool)
+	exactCount := cmd.Lookup("exact-count").Value.(flag.Getter).Get().(bool)
+	workers := cmd.Lookup("workers").Value.(flag.Getter).Get().(int)
+	watch := cmd.Lookup("watch").Value.(flag.Getter).Get().(bool)
+	watchInterval := cmd.Lookup("watch-interval").Value.(flag.Getter).Get().(time.Duration)
 
 	// Fix type casting issues - convert to int64 safely
 	sampleRateVal := cmd.Lookup("sample").Value.(flag.Getter).Get()
@@ -142,10 +352,34 @@ func ParseCommandLineOptions(cmd *flag.FlagSet) CommandLineOptions {
 		maxRecords = 0 // Default value if conversion fails
 	}
 
+	randomSample := cmd.Lookup("randomize").Value.(flag.Getter).Get().(bool)
+	randomSeed := cmd.Lookup("seed").Value.(flag.Getter).Get().(int64)
+	resampleInterval := cmd.Lookup("resample").Value.String()
+	aggregateBy := cmd.Lookup("aggregate-by").Value.String()
+	resampleOutputFile := cmd.Lookup("resample-output").Value.String()
+	resampleMs := cmd.Lookup("resample-ms").Value.(flag.Getter).Get().(int64)
+	exactPercentiles := cmd.Lookup("exact-percentiles").Value.(flag.Getter).Get().(bool)
+	noSolar := cmd.Lookup("no-solar").Value.(flag.Getter).Get().(bool)
+	noBattery := cmd.Lookup("no-battery").Value.(flag.Getter).Get().(bool)
+	requireCompleteHours := cmd.Lookup("require-complete-hours").Value.(flag.Getter).Get().(bool)
+	thermalRunawayThreshold := cmd.Lookup("thermal-runaway-threshold").Value.(flag.Getter).Get().(float64)
+	batteryCapacityAh := cmd.Lookup("battery-capacity-ah").Value.(flag.Getter).Get().(float64)
+	cycleDeadbandNa := cmd.Lookup("cycle-deadband-na").Value.(flag.Getter).Get().(int64)
+	histogramBuckets := cmd.Lookup("histogram-buckets").Value.(flag.Getter).Get().(int)
+	reservoirSize := cmd.Lookup("reservoir-size").Value.(flag.Getter).Get().(int)
+	peakThresholdW := cmd.Lookup("peak-threshold-w").Value.(flag.Getter).Get().(float64)
+	loadThresholdNanoA := cmd.Lookup("load-threshold-na").Value.(flag.Getter).Get().(int64)
+	chargeThresholdNanoA := cmd.Lookup("charge-threshold-na").Value.(flag.Getter).Get().(int64)
+	epochTimestamps := cmd.Lookup("no-timestamp-accumulation").Value.(flag.Getter).Get().(bool)
+
 	// Time filtering options
 	startTime := cmd.Lookup("start").Value.String()
 	endTime := cmd.Lookup("end").Value.String()
 	timeWindow := cmd.Lookup("window").Value.String()
+	startOfDay := cmd.Lookup("start-of-day").Value.String()
+	startOfWeek := cmd.Lookup("start-of-week").Value.String()
+	startOfMonth := cmd.Lookup("start-of-month").Value.String()
+	timezone := cmd.Lookup("timezone").Value.String()
 
 	// Data filtering options - safe type conversion for int64 values
 	minTempVal := cmd.Lookup("min-temp").Value.(flag.Getter).Get()
@@ -203,6 +437,36 @@ func ParseCommandLineOptions(cmd *flag.FlagSet) CommandLineOptions {
 		currentMax = 0
 	}
 
+	// Cost options
+	energyRate := cmd.Lookup("energy-rate").Value.(flag.Getter).Get().(float64)
+	rateCurrency := cmd.Lookup("rate-schedule-currency").Value.String()
+	currency := cmd.Lookup("currency").Value.String()
+	exchangeRate := cmd.Lookup("exchange-rate").Value.(flag.Getter).Get().(float64)
+	fetchExchangeRate := cmd.Lookup("fetch-exchange-rate").Value.(flag.Getter).Get().(bool)
+
+	voltScale := cmd.Lookup("volt-scale").Value.(flag.Getter).Get().(float64)
+	currScale := cmd.Lookup("curr-scale").Value.(flag.Getter).Get().(float64)
+	tempScale := cmd.Lookup("temp-scale").Value.(flag.Getter).Get().(float64)
+	columnMap := cmd.Lookup("column-map").Value.String()
+	excludeZeroPower := cmd.Lookup("exclude-zero-power").Value.(flag.Getter).Get().(bool)
+	maxSlewRate := cmd.Lookup("max-slew-rate").Value.(flag.Getter).Get().(float64)
+	maxGapMs := cmd.Lookup("max-gap-ms").Value.(flag.Getter).Get().(int64)
+	dropNonPositiveDelta := cmd.Lookup("drop-nonpositive-delta").Value.(flag.Getter).Get().(bool)
+	maxTimeDeltaMs := cmd.Lookup("max-time-delta-ms").Value.(flag.Getter).Get().(int64)
+	anomalySigma := cmd.Lookup("anomaly-sigma").Value.(flag.Getter).Get().(float64)
+	anomalyWindow := cmd.Lookup("anomaly-window").Value.(flag.Getter).Get().(int)
+
+	// Debugging options
+	verbose := cmd.Lookup("verbose").Value.(flag.Getter).Get().(bool)
+	keepTmp := cmd.Lookup("keep-tmp").Value.(flag.Getter).Get().(bool)
+	tmpDir := cmd.Lookup("tmp-dir").Value.String()
+
+	// Power budget options
+	budgetJoules := cmd.Lookup("budget-joules").Value.(flag.Getter).Get().(float64)
+	budgetAvgW := cmd.Lookup("budget-avg-w").Value.(flag.Getter).Get().(float64)
+	budgetPeakW := cmd.Lookup("budget-peak-w").Value.(flag.Getter).Get().(float64)
+	budgetMaxTempC := cmd.Lookup("budget-max-temp-c").Value.(flag.Getter).Get().(float64)
+
 	// Specific metrics extraction
 	metric := cmd.Lookup("metric").Value.String()
 
@@ -213,58 +477,201 @@ func ParseCommandLineOptions(cmd *flag.FlagSet) CommandLineOptions {
 		outputFormat = FormatJSON
 	case "csv":
 		outputFormat = FormatCSV
+	case "shell":
+		outputFormat = FormatShell
+	case "sqlite":
+		outputFormat = FormatSQLite
+	case "markdown", "md":
+		outputFormat = FormatMarkdown
 	default:
 		outputFormat = FormatText
 	}
 
 	return CommandLineOptions{
-		InputFile:    inputFile,
-		OutputFile:   outputFile,
-		Format:       outputFormat,
-		UseStreaming: useStreaming,
-		SampleRate:   sampleRate,
-		MaxRecords:   maxRecords,
-		StartTime:    startTime,
-		EndTime:      endTime,
-		TimeWindow:   timeWindow,
-		MinTemp:      minTemp,
-		VoltageMin:   voltageMin,
-		VoltageMax:   voltageMax,
-		CurrentMin:   currentMin,
-		CurrentMax:   currentMax,
-		Metric:       metric,
+		InputFiles:              inputFiles,
+		Compressed:              compressed,
+		InputFormat:             inputFormat,
+		InputGlob:               inputGlob,
+		OutputFile:              outputFile,
+		Format:                  outputFormat,
+		FieldSep:                fieldSep,
+		ShellPrefix:             shellPrefix,
+		ShellIncludeMaps:        shellIncludeMaps,
+		MarkdownBadge:           markdownBadge,
+		OutputURL:               outputURL,
+		OutputURLToken:          outputURLToken,
+		OutputURLTimeout:        outputURLTimeout,
+		UseStreaming:            useStreaming,
+		ExactCount:              exactCount,
+		Workers:                 workers,
+		Watch:                   watch,
+		WatchInterval:           watchInterval,
+		SampleRate:              sampleRate,
+		MaxRecords:              maxRecords,
+		RandomSample:            randomSample,
+		RandomSeed:              randomSeed,
+		ResampleInterval:        resampleInterval,
+		AggregateBy:             aggregateBy,
+		ResampleOutputFile:      resampleOutputFile,
+		ResampleMs:              resampleMs,
+		ExactPercentiles:        exactPercentiles,
+		NoSolar:                 noSolar,
+		NoBattery:               noBattery,
+		StartTime:               startTime,
+		EndTime:                 endTime,
+		TimeWindow:              timeWindow,
+		Timezone:                timezone,
+		StartOfDay:              startOfDay,
+		StartOfWeek:             startOfWeek,
+		StartOfMonth:            startOfMonth,
+		MinTemp:                 minTemp,
+		VoltageMin:              voltageMin,
+		VoltageMax:              voltageMax,
+		CurrentMin:              currentMin,
+		CurrentMax:              currentMax,
+		ExcludeZeroPower:        excludeZeroPower,
+		VoltScale:               voltScale,
+		CurrScale:               currScale,
+		TempScale:               tempScale,
+		ColumnMap:               columnMap,
+		MaxSlewRate:             maxSlewRate,
+		MaxGapMs:                maxGapMs,
+		DropNonPositiveDelta:    dropNonPositiveDelta,
+		MaxTimeDeltaMs:          maxTimeDeltaMs,
+		AnomalySigma:            anomalySigma,
+		AnomalyWindow:           anomalyWindow,
+		EnergyRate:              energyRate,
+		RateCurrency:            rateCurrency,
+		Currency:                currency,
+		ExchangeRate:            exchangeRate,
+		FetchExchangeRate:       fetchExchangeRate,
+		Verbose:                 verbose,
+		KeepTmp:                 keepTmp,
+		TmpDir:                  tmpDir,
+		RequireCompleteHours:    requireCompleteHours,
+		ThermalRunawayThreshold: thermalRunawayThreshold,
+		BatteryCapacityAh:       batteryCapacityAh,
+		CycleDeadbandNa:         cycleDeadbandNa,
+		HistogramBuckets:        histogramBuckets,
+		ReservoirSize:           reservoirSize,
+		PeakThresholdW:          peakThresholdW,
+		LoadThresholdNanoA:      loadThresholdNanoA,
+		ChargeThresholdNanoA:    chargeThresholdNanoA,
+		EpochTimestamps:         epochTimestamps,
+		BudgetJoules:            budgetJoules,
+		BudgetAvgW:              budgetAvgW,
+		BudgetPeakW:             budgetPeakW,
+		BudgetMaxTempC:          budgetMaxTempC,
+		Metric:                  metric,
 	}
 }
 
 // ProcessCommand executes the main data processing functionality
 func ProcessCommand(options CommandLineOptions) error {
-	// Validate input file
-	if options.InputFile == "" {
-		return fmt.Errorf("input file is required (--input)")
+	// Resolve --input and --input-glob into the list of files
+	inputFiles, err := resolveInputFiles(options)
+	if err != nil {
+		return err
 	}
+	options.InputFiles = inputFiles
 
-	// Validate start time (now required)
-	if options.StartTime == "" {
-		return fmt.Errorf("start time is required (--start)")
+	if options.Format == FormatSQLite {
+		if options.OutputFile == "" {
+			return fmt.Errorf("--format=sqlite requires --output with the database path")
+		}
+		if options.Metric != "" || options.Watch {
+			return fmt.Errorf("--format=sqlite stores the full report and cannot be combined with --metric or --watch")
+		}
+	}
+
+	// --aggregate-by=file reports every input on its own instead of a window
+	perFile := strings.EqualFold(options.AggregateBy, aggregateByFile)
+	var aggregateWindow time.Duration
+	if !perFile {
+		aggregateWindow, err = parseAggregateWindow(options.AggregateBy)
+		if err != nil {
+			return err
+		}
+	}
+	if aggregateWindow > 0 || perFile {
+		if options.Format != FormatText && options.Format != FormatJSON && options.Format != FormatCSV {
+			return fmt.Errorf("--aggregate-by supports the text, json and csv formats, not %s", options.Format)
+		}
+		if options.Metric != "" || options.Watch || hasBudget(options) || options.OutputURL != "" {
+			return fmt.Errorf("--aggregate-by cannot be combined with --metric, --watch, --budget-* or --output-url")
+		}
 	}
 
-	// Ensure input file exists
-	if _, err := os.Stat(options.InputFile); os.IsNotExist(err) {
-		return fmt.Errorf("input file does not exist: %s", options.InputFile)
+	if options.Workers < 1 {
+		return fmt.Errorf("--workers must be at least 1")
 	}
 
-	// Create CSV parser with appropriate options
-	csvParser := parser.NewCSVParser(options.InputFile)
+	// Several files are processed one per worker when every file is reported
+	// on its own, or when asked to with --workers; the report of all files is
+	// then merged from the metrics of every file. Only what MergeMetrics can
+	// combine is available in that case.
+	mergeFiles := !perFile && options.Workers > 1 && len(inputFiles) > 1
+	usePool := perFile || mergeFiles
+	if usePool && (options.KeepTmp || options.ResampleOutputFile != "") {
+		return fmt.Errorf("--keep-tmp and --resample-output are not available with --aggregate-by=file or --workers")
+	}
+	if mergeFiles && (aggregateWindow > 0 || options.ExactPercentiles || options.BatteryCapacityAh > 0) {
+		return fmt.Errorf("--workers cannot be combined with --aggregate-by windows, --exact-percentiles or --battery-capacity-ah")
+	}
+	if mergeFiles {
+		// Percentiles are not merged, so none are estimated or reported
+		options.ReservoirSize = 0
+	}
+
+	// Validate start time (now required)
+	if options.StartTime == "" && !hasCalendarPeriod(options) && !options.EpochTimestamps {
+		return fmt.Errorf("start time is required (--start, --start-of-day, --start-of-week or --start-of-month)")
+	}
+
+	// Create a CSV parser with appropriate options for every input
 	filterOptions, err := buildFilterOptions(options)
 	if err != nil {
 		return fmt.Errorf("error configuring filters: %v", err)
 	}
-	csvParser.WithFilterOptions(filterOptions)
+
+	gaps := &gapCollector{}
+	if options.MaxGapMs > 0 {
+		filterOptions.GapThresholdMs = options.MaxGapMs
+		filterOptions.GapCallback = gaps.add
+	}
+	countMode := parser.CountModeEstimate
+	if options.ExactCount {
+		countMode = parser.CountModeExact
+	}
+	inputParsers := make([]parser.RecordParser, len(inputFiles))
+	for i, inputFile := range inputFiles {
+		inputParsers[i], err = newInputParser(inputFile, options, filterOptions, countMode)
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.Watch {
+		if len(inputParsers) != 1 || inputFiles[0] == stdinInput {
+			return fmt.Errorf("--watch requires a single input file, use the watch command for standard input")
+		}
+		if hasBudget(options) {
+			log.Printf("Warning: --budget-* limits are not checked with --watch")
+		}
+		return watchProcess(inputParsers[0], options)
+	}
 
 	// Check file size to determine if we should use streaming
-	fileSize, err := csvParser.GetFileSize()
-	if err != nil {
-		return fmt.Errorf("error getting file size: %v", err)
+	var fileSize int64
+	for _, inputParser := range inputParsers {
+		size, err := inputParser.GetFileSize()
+		if errors.Is(err, parser.ErrNotAFile) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error getting file size: %v", err)
+		}
+		fileSize += size
 	}
 
 	// Suggest streaming mode for large files (>100MB) if not explicitly set
@@ -274,85 +681,548 @@ func ProcessCommand(options CommandLineOptions) error {
 	}
 
 	// Get an estimate of the number of records
-	recordCount, err := csvParser.GetRecordCount()
-	if err != nil {
-		log.Printf("Warning: Couldn't estimate record count: %v", err)
-	} else {
+	recordCount := 0
+	for _, inputParser := range inputParsers {
+		count, err := inputParser.GetRecordCount()
+		if errors.Is(err, parser.ErrNotAFile) {
+			recordCount = -1
+			break
+		}
+		if err != nil {
+			log.Printf("Warning: Couldn't estimate record count: %v", err)
+			recordCount = -1
+			break
+		}
+		recordCount += count
+	}
+	if recordCount >= 0 && options.ExactCount {
+		fmt.Printf("Records in file: %d\n", recordCount)
+	} else if recordCount >= 0 {
 		fmt.Printf("Estimated records in file: %d\n", recordCount)
 	}
 
+	// Several inputs with epoch timestamps are merged into one time-ordered
+	// stream; inputs with time deltas continue one another in order
+	stream := inputParsers[0].StreamRecords
+	if len(inputParsers) > 1 && options.EpochTimestamps {
+		stream = parser.MergeCSVParsers(inputParsers)
+	} else if len(inputParsers) > 1 {
+		stream = parser.ChainParsers(inputParsers)
+	}
+
+	// The workers read a stream per file. Files with time deltas continue
+	// one another; where every file starts is found up front, so that they
+	// can still be processed in any order.
+	workers := min(options.Workers, runtime.NumCPU(), len(inputParsers))
+	var fileStreams []parser.StreamFunc
+	if usePool && options.EpochTimestamps {
+		for _, inputParser := range inputParsers {
+			fileStreams = append(fileStreams, inputParser.StreamRecords)
+		}
+	} else if usePool {
+		fileStreams, err = parser.ChainStreams(inputParsers)
+		if err != nil {
+			return fmt.Errorf("failed to chain input files: %v", err)
+		}
+	}
+
 	// Process the data
-	fmt.Printf("Processing data from %s...\n", options.InputFile)
+	fmt.Printf("Processing data from %s...\n", strings.Join(inputFiles, ", "))
 
 	var energyMetrics metrics.EnergyMetrics
+	var windows []metrics.EnergyMetrics
+
+	// Exact percentiles need every record in memory, which streaming avoids
+	if options.ExactPercentiles && options.UseStreaming {
+		log.Printf("Warning: --exact-percentiles is not supported in streaming mode and will be ignored")
+		options.ExactPercentiles = false
+	}
+
+	var resampleInterval time.Duration
+	if options.ResampleInterval != "" && options.ResampleMs != 0 {
+		return fmt.Errorf("--resample and --resample-ms cannot be used together")
+	}
+	if options.ResampleInterval != "" {
+		resampleInterval, err = time.ParseDuration(options.ResampleInterval)
+		if err != nil || resampleInterval < time.Millisecond {
+			return fmt.Errorf("invalid resample interval: %s", options.ResampleInterval)
+		}
+	} else if options.ResampleMs != 0 {
+		if options.ResampleMs < 0 {
+			return fmt.Errorf("invalid resample interval: %d ms", options.ResampleMs)
+		}
+		resampleInterval = time.Duration(options.ResampleMs) * time.Millisecond
+	} else if options.ResampleOutputFile != "" {
+		return fmt.Errorf("--resample-output requires --resample")
+	}
+
+	// Resampled records are only written out when they are all in memory
+	if options.ResampleOutputFile != "" && options.UseStreaming {
+		log.Printf("Warning: --resample-output is not supported in streaming mode and will be ignored")
+		options.ResampleOutputFile = ""
+	}
+
+	// Intermediate files need every record in memory as well
+	if options.KeepTmp && options.UseStreaming {
+		log.Printf("Warning: --keep-tmp is not supported in streaming mode and will be ignored")
+		options.KeepTmp = false
+	}
+
+	intermediates, err := newIntermediateFiles(options)
+	if err != nil {
+		return err
+	}
+
+	if options.HistogramBuckets <= 0 {
+		return fmt.Errorf("--histogram-buckets must be positive")
+	}
+	if options.ReservoirSize < 0 {
+		return fmt.Errorf("--reservoir-size must not be negative")
+	}
+	if options.PeakThresholdW < 0 {
+		return fmt.Errorf("--peak-threshold-w must not be negative")
+	}
+	if options.LoadThresholdNanoA < 0 || options.ChargeThresholdNanoA < 0 {
+		return fmt.Errorf("--load-threshold-na and --charge-threshold-na must not be negative")
+	}
 
 	// Configure metrics options
 	metricsOptions := buildMetricsOptions(options)
 
-	// Process data either with streaming or regular mode
-	if options.UseStreaming {
+	// Anomalies are looked for in the parsed records, before resampling.
+	// Workers run a detector per file.
+	var anomalies *metrics.AnomalyDetector
+	if options.AnomalySigma > 0 && !usePool {
+		anomalies = metrics.NewAnomalyDetector(options.AnomalyWindow, options.AnomalySigma)
+	}
+
+	// Process data per file with a pool of workers, streaming or regular mode
+	if usePool {
+		fmt.Printf("Processing %d files with %d workers...\n", len(inputParsers), workers)
+
+		fileMetrics, err := processFilesConcurrently(inputFiles, fileStreams, workers, resampleInterval, metricsOptions, options)
+		if err != nil {
+			return err
+		}
+		if perFile {
+			windows = fileMetrics
+			for _, m := range fileMetrics {
+				energyMetrics.Anomalies = append(energyMetrics.Anomalies, m.Anomalies...)
+			}
+		} else {
+			energyMetrics = metrics.MergeMetrics(fileMetrics)
+		}
+	} else if options.UseStreaming {
 		fmt.Println("Using streaming mode for memory-efficient processing...")
-		energyMetrics, err = metrics.StreamCalculateMetrics(csvParser, metricsOptions)
+
+		if anomalies != nil {
+			stream = anomalies.Wrap(stream)
+		}
+
+		var resampler *parser.ResamplingReader
+		if resampleInterval > 0 {
+			resampler = parser.NewResamplingReader(stream, resampleInterval.Milliseconds())
+			stream = resampler.StreamRecords
+		}
+
+		progress := newProgressPrinter(os.Stdout)
+		metricsOptions.ProgressFunc = progress.update
+		if recordCount > 0 {
+			metricsOptions.EstimatedRecords = recordCount
+		}
+
+		if aggregateWindow > 0 {
+			windows, err = metrics.StreamAggregateByDuration(stream, aggregateWindow, metricsOptions)
+		} else {
+			energyMetrics, err = metrics.StreamCalculateMetricsFunc(stream, metricsOptions)
+		}
+		progress.finish()
 		if err != nil {
-			return fmt.Errorf("failed to process CSV data in streaming mode: %v", err)
+			return fmt.Errorf("failed to process input data in streaming mode: %v", err)
+		}
+
+		if resampler != nil {
+			warnResampleSkipped(resampler)
+		}
+
+		if options.Verbose && energyMetrics.DataPoints > 0 {
+			PrintRecordTable("First record", energyMetrics.FirstRecord)
+			PrintRecordTable("Last record", energyMetrics.LastRecord)
 		}
 	} else {
 		// Parse all records at once
-		records, err := csvParser.Parse()
+		records, err := parseRecords(inputParsers, stream)
 		if err != nil {
-			return fmt.Errorf("failed to parse CSV data: %v", err)
+			return fmt.Errorf("failed to parse input data: %v", err)
 		}
 		fmt.Printf("Successfully parsed %d records\n", len(records))
 
+		if options.Verbose && len(records) > 0 {
+			PrintRecordTable("First record", records[0])
+			PrintRecordTable("Last record", records[len(records)-1])
+		}
+
+		if err := intermediates.save("parsed", records); err != nil {
+			return err
+		}
+
+		if anomalies != nil {
+			anomalies.Detect(records)
+		}
+
+		if resampleInterval > 0 {
+			resampler := parser.NewResamplingReader(parser.SliceStream(records), resampleInterval.Milliseconds())
+			var resampled []parser.EnemeterRecord
+			if err := resampler.StreamRecords(func(record parser.EnemeterRecord) error {
+				resampled = append(resampled, record)
+				return nil
+			}); err != nil {
+				return fmt.Errorf("failed to resample records: %v", err)
+			}
+			warnResampleSkipped(resampler)
+			records = resampled
+			fmt.Printf("Resampled to %d records at %s intervals\n", len(records), resampleInterval)
+
+			if err := intermediates.save("resampled", records); err != nil {
+				return err
+			}
+
+			if options.ResampleOutputFile != "" {
+				if err := SaveIntermediateCSV(records, options.ResampleOutputFile); err != nil {
+					return fmt.Errorf("failed to write resampled records: %v", err)
+				}
+				fmt.Printf("Resampled records written to %s\n", options.ResampleOutputFile)
+			}
+		}
+
 		// Calculate metrics
-		calculator := metrics.NewEnergyCalculator(records).WithOptions(metricsOptions)
-		energyMetrics = calculator.CalculateMetrics()
+		if aggregateWindow > 0 {
+			windows = metrics.AggregateByDuration(records, aggregateWindow, metricsOptions)
+		} else {
+			calculator := metrics.NewEnergyCalculator(records).WithOptions(metricsOptions)
+			energyMetrics = calculator.CalculateMetrics()
+		}
 	}
 
-	// Generate appropriate output based on requested format and metrics
-	output, err := generateOutput(energyMetrics, options)
-	if err != nil {
-		return fmt.Errorf("failed to generate output: %v", err)
+	if anomalies != nil {
+		energyMetrics.Anomalies = anomalies.Events()
+	}
+	if options.AnomalySigma > 0 {
+		fmt.Println(formatAnomalySummary(energyMetrics.Anomalies))
+	}
+
+	stats := parser.MergedStats(inputParsers)
+	if stats.DroppedByZeroPower > 0 {
+		fmt.Printf("Dropped %d zero-power records\n", stats.DroppedByZeroPower)
+	}
+	if stats.DroppedBySlew > 0 {
+		fmt.Printf("Dropped %d records exceeding the current slew rate\n", stats.DroppedBySlew)
+	}
+	if stats.DroppedByTimeDelta > 0 {
+		fmt.Printf("Dropped %d records with an invalid time delta\n", stats.DroppedByTimeDelta)
+	}
+
+	// Every window or file gets a row of its own instead of the single report
+	if aggregateWindow > 0 || perFile {
+		var report string
+		if perFile {
+			report, err = generateFileOutput(inputFiles, windows, options)
+		} else {
+			report, err = generateAggregateOutput(windows, aggregateWindow, options)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to generate output: %v", err)
+		}
+		if options.OutputFile == "" {
+			fmt.Println(report)
+		} else {
+			if err := os.WriteFile(options.OutputFile, []byte(report), 0644); err != nil {
+				return fmt.Errorf("failed to write output file: %v", err)
+			}
+			fmt.Printf("Results saved to %s\n", options.OutputFile)
+		}
+		intermediates.printSummary()
+		return nil
+	}
+
+	// Price the energy if a rate was given
+	if options.EnergyRate > 0 {
+		energyMetrics.CostAnalysis, err = buildCostAnalysis(energyMetrics, options)
+		if err != nil {
+			return fmt.Errorf("failed to calculate energy cost: %v", err)
+		}
+	}
+
+	// Generate appropriate output based on requested format and metrics;
+	// SQLite is written straight to the database below
+	var report string
+	if options.Format != FormatSQLite {
+		report, err = generateOutput(energyMetrics, options)
+		if err != nil {
+			return fmt.Errorf("failed to generate output: %v", err)
+		}
+	}
+
+	// Budget violations end the text output; the JSON report already holds
+	// them and the other formats get them on stderr
+	violations := checkBudget(energyMetrics, options)
+	if options.Format == FormatText {
+		report += formatBudgetViolations(violations)
+	} else if options.Format == FormatMarkdown {
+		report += markdownFromText(formatBudgetViolations(violations))
+	} else if len(violations) > 0 && (options.Format != FormatJSON || options.Metric != "") {
+		fmt.Fprint(os.Stderr, formatBudgetViolations(violations))
+	}
+
+	// The gap summary closes the text report; other formats must stay
+	// machine-readable, so it only goes to the log there
+	if options.MaxGapMs > 0 {
+		gapEvents := gaps.events()
+		if options.Format == FormatText && options.Metric == "" {
+			report += formatGapSummary(gapEvents, options.MaxGapMs, options.FieldSep)
+		} else if options.Format == FormatMarkdown && options.Metric == "" {
+			report += markdownFromText(formatGapSummary(gapEvents, options.MaxGapMs, markdownSep))
+		} else if len(gapEvents) > 0 {
+			log.Printf("Warning: %d data gaps longer than %d ms detected", len(gapEvents), options.MaxGapMs)
+		}
 	}
 
 	// Display or save the output
-	if options.OutputFile == "" {
-		fmt.Println(output)
+	if options.Format == FormatSQLite {
+		runID, err := writeSQLiteReport(options.OutputFile, energyMetrics, options)
+		if err != nil {
+			return fmt.Errorf("failed to write SQLite report: %v", err)
+		}
+		fmt.Printf("Results saved to %s as run %s\n", options.OutputFile, runID)
+	} else if options.OutputFile == "" {
+		// A report sent to --output-url is not printed as well
+		if options.OutputURL == "" {
+			fmt.Println(report)
+		}
 	} else {
-		err = os.WriteFile(options.OutputFile, []byte(output), 0644)
+		err = os.WriteFile(options.OutputFile, []byte(report), 0644)
 		if err != nil {
 			return fmt.Errorf("failed to write output file: %v", err)
 		}
 		fmt.Printf("Results saved to %s\n", options.OutputFile)
 	}
 
+	// Push the report to a remote endpoint if requested
+	if options.OutputURL != "" {
+		sink := output.NewHTTPSink(options.OutputURL, options.OutputURLToken, options.OutputURLTimeout)
+		if err := sink.Post(energyMetrics); err != nil {
+			return fmt.Errorf("failed to post report to %s: %w", options.OutputURL, err)
+		}
+		fmt.Printf("Report posted to %s\n", options.OutputURL)
+	}
+
+	intermediates.printSummary()
+
+	if len(violations) > 0 {
+		return &BudgetExceededError{Violations: violations}
+	}
 	return nil
 }
 
+// PrintRecordTable prints a single record with its reconstructed timestamp
+// and values converted to physical units, to check what the parser produced
+func PrintRecordTable(label string, r parser.EnemeterRecord) {
+	volts := float64(r.VoltageMicroV) / 1000000.0
+	amps := float64(r.CurrentNanoA) / 1000000000.0
+
+	fmt.Printf("%s:\n", label)
+	fmt.Printf("  %-12s %s\n", "Timestamp", r.Timestamp.Format("2006-01-02 15:04:05.000"))
+	fmt.Printf("  %-12s %d ms\n", "Time Delta", r.TimeDeltaMs)
+	fmt.Printf("  %-12s %.6f V\n", "Voltage", volts)
+	fmt.Printf("  %-12s %.9f A\n", "Current", amps)
+	fmt.Printf("  %-12s %.2f °C\n", "Temperature", float64(r.TempMiliCelsius)/1000.0)
+	fmt.Printf("  %-12s %.6f W\n", "Power", volts*amps)
+}
+
+// formatAnomalySummary counts the anomalies per channel
+func formatAnomalySummary(events []metrics.AnomalyEvent) string {
+	if len(events) == 0 {
+		return "No anomalous readings detected"
+	}
+
+	counts := make(map[string]int)
+	for _, event := range events {
+		counts[event.Channel]++
+	}
+
+	var parts []string
+	for _, channel := range []string{metrics.ChannelVoltage, metrics.ChannelCurrent, metrics.ChannelTemperature} {
+		if counts[channel] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[channel], channel))
+		}
+	}
+	return fmt.Sprintf("Detected %d anomalous readings (%s)", len(events), strings.Join(parts, ", "))
+}
+
+// warnResampleSkipped logs the records the resampler could not use
+func warnResampleSkipped(resampler *parser.ResamplingReader) {
+	if skipped := resampler.Skipped(); skipped > 0 {
+		log.Printf("Warning: skipped %d records with a zero or negative time delta while resampling", skipped)
+	}
+}
+
+// resolveInputFiles returns the files named by --input followed by the
+// matches of --input-glob, and checks that they exist
+func resolveInputFiles(options CommandLineOptions) ([]string, error) {
+	inputFiles := append([]string(nil), options.InputFiles...)
+
+	if options.InputGlob != "" {
+		matches, err := filepath.Glob(options.InputGlob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input glob: %w", err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no input files match %s", options.InputGlob)
+		}
+		inputFiles = append(inputFiles, matches...)
+	}
+
+	// Without any input, data piped into the command is read instead
+	if len(inputFiles) == 0 && stdinIsPipe() {
+		inputFiles = append(inputFiles, stdinInput)
+	}
+
+	if len(inputFiles) == 0 {
+		return nil, fmt.Errorf("input file is required (--input or --input-glob)")
+	}
+
+	stdinCount := 0
+	for _, inputFile := range inputFiles {
+		if inputFile == stdinInput {
+			stdinCount++
+			continue
+		}
+		if _, err := os.Stat(inputFile); os.IsNotExist(err) {
+			return nil, fmt.Errorf("input file does not exist: %s", inputFile)
+		}
+	}
+	if stdinCount > 1 {
+		return nil, fmt.Errorf("standard input (--input=%s) can only be given once", stdinInput)
+	}
+
+	return inputFiles, nil
+}
+
+// stdinInput is the --input value that reads standard input
+const stdinInput = "-"
+
+// stdinIsPipe reports whether standard input is redirected rather than a
+// terminal
+func stdinIsPipe() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// newInputParser creates the parser of one input, reading standard input
+// for stdinInput
+func newInputParser(inputFile string, options CommandLineOptions, filterOptions parser.FilterOptions, countMode parser.CountMode) (parser.RecordParser, error) {
+	if inputFile == stdinInput {
+		return parser.NewRecordParserFromReader(os.Stdin, options.InputFormat, filterOptions)
+	}
+	return parser.NewRecordParser(inputFile, options.InputFormat, filterOptions, countMode)
+}
+
+// parseRecords loads all records into memory. A single input goes through
+// Parse so that randomized sampling sees the exact record count; several
+// inputs are collected from the merged stream.
+func parseRecords(inputParsers []parser.RecordParser, stream parser.StreamFunc) ([]parser.EnemeterRecord, error) {
+	if len(inputParsers) == 1 {
+		return inputParsers[0].Parse()
+	}
+
+	var records []parser.EnemeterRecord
+	err := stream(func(record parser.EnemeterRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
 // buildFilterOptions converts CLI options into parser filter options
 func buildFilterOptions(cliOptions CommandLineOptions) (parser.FilterOptions, error) {
 	filterOptions := parser.FilterOptions{
-		SampleRate: cliOptions.SampleRate,
-		MaxRecords: cliOptions.MaxRecords,
+		SampleRate:           cliOptions.SampleRate,
+		MaxRecords:           cliOptions.MaxRecords,
+		RandomizeSampleOrder: cliOptions.RandomSample,
+		RandomSeed:           cliOptions.RandomSeed,
+		ExcludeZeroPower:     cliOptions.ExcludeZeroPower,
+		Compressed:           cliOptions.Compressed,
+
+		MaxCurrentChangeRateAPerSec: cliOptions.MaxSlewRate,
+		TimestampIsAbsoluteEpochMs:  cliOptions.EpochTimestamps,
+		DropNonPositiveDelta:        cliOptions.DropNonPositiveDelta,
+		MaxTimeDeltaMs:              cliOptions.MaxTimeDeltaMs,
+
+		VoltageScaleFactor: cliOptions.VoltScale,
+		CurrentScaleFactor: cliOptions.CurrScale,
+		TempScaleFactor:    cliOptions.TempScale,
 	}
 
-	// Process start time (required with time of day)
-	startTime, err := parseTimeString(cliOptions.StartTime)
-	if err != nil {
-		return filterOptions, fmt.Errorf("invalid start time: %w. Must provide both date and time (YYYY-MM-DD HH:MM:SS)", err)
+	if cliOptions.VoltScale <= 0 || cliOptions.CurrScale <= 0 || cliOptions.TempScale <= 0 {
+		return filterOptions, fmt.Errorf("--volt-scale, --curr-scale and --temp-scale must be positive")
 	}
 
-	// Check if time component is included (not midnight exactly)
-	if startTime.Hour() == 0 && startTime.Minute() == 0 && startTime.Second() == 0 {
-		// Only warn if the time appears to be exactly midnight
-		fmt.Println("Warning: Start time appears to be exactly midnight. Make sure you provided the time of day, not just the date.")
+	if cliOptions.ColumnMap != "" {
+		mapping, err := parseColumnMap(cliOptions.ColumnMap)
+		if err != nil {
+			return filterOptions, err
+		}
+		filterOptions.ColumnMapping = mapping
 	}
 
-	filterOptions.StartTime = &startTime
+	if cliOptions.MaxTimeDeltaMs < 0 {
+		return filterOptions, fmt.Errorf("--max-time-delta-ms must not be negative")
+	}
+
+	location, err := loadTimezone(cliOptions.Timezone)
+	if err != nil {
+		return filterOptions, err
+	}
+	filterOptions.Location = location
+
+	if cliOptions.EpochTimestamps {
+		// Epoch timestamps carry their own origin and the parser ignores
+		// the start time
+		if hasCalendarPeriod(cliOptions) {
+			return filterOptions, fmt.Errorf("--start-of-day, --start-of-week and --start-of-month cannot be used with --no-timestamp-accumulation")
+		}
+		if cliOptions.StartTime != "" {
+			log.Printf("Warning: --start is ignored with --no-timestamp-accumulation")
+		}
+	} else if hasCalendarPeriod(cliOptions) {
+		// Calendar periods start at midnight on purpose, so no warning here
+		startTime, endTime, err := calendarPeriod(cliOptions, location)
+		if err != nil {
+			return filterOptions, err
+		}
+		filterOptions.StartTime = &startTime
+		if cliOptions.EndTime == "" {
+			filterOptions.EndTime = &endTime
+		}
+	} else {
+		// Process start time (required with time of day)
+		startTime, err := parseTimeString(cliOptions.StartTime, location)
+		if err != nil {
+			return filterOptions, fmt.Errorf("invalid start time: %w. Must provide both date and time (YYYY-MM-DD HH:MM:SS)", err)
+		}
+
+		// Check if time component is included (not midnight exactly)
+		if startTime.Hour() == 0 && startTime.Minute() == 0 && startTime.Second() == 0 {
+			// Only warn if the time appears to be exactly midnight
+			fmt.Println("Warning: Start time appears to be exactly midnight. Make sure you provided the time of day, not just the date.")
+		}
+
+		filterOptions.StartTime = &startTime
+	}
 
 	// Process end time if specified
 	if cliOptions.EndTime != "" {
-		endTime, err := parseTimeString(cliOptions.EndTime)
+		endTime, err := parseTimeString(cliOptions.EndTime, location)
 		if err != nil {
 			return filterOptions, fmt.Errorf("invalid end time: %w", err)
 		}
@@ -427,7 +1297,32 @@ func buildFilterOptions(cliOptions CommandLineOptions) (parser.FilterOptions, er
 // buildMetricsOptions converts CLI options into metrics calculation options
 func buildMetricsOptions(cliOptions CommandLineOptions) metrics.MetricsOptions {
 	options := metrics.MetricsOptions{
-		TimeResolution: time.Minute * 5, // Default 5-minute resolution
+		TimeResolution:   time.Minute * 5, // Default 5-minute resolution
+		SamplingMethod:   metrics.SamplingSequential,
+		ExactPercentiles: cliOptions.ExactPercentiles,
+		DisableSolar:     cliOptions.NoSolar,
+		DisableBattery:   cliOptions.NoBattery,
+
+		RequireCompleteHours: cliOptions.RequireCompleteHours,
+
+		ThermalRunawayThreshold: cliOptions.ThermalRunawayThreshold,
+		NominalCapacityAh:       cliOptions.BatteryCapacityAh,
+		CycleDeadbandNanoA:      cliOptions.CycleDeadbandNa,
+		HistogramBuckets:        cliOptions.HistogramBuckets,
+		ReservoirSize:           cliOptions.ReservoirSize,
+		PeakThresholdWatts:      cliOptions.PeakThresholdW,
+
+		LoadCurrentThresholdNanoA:   cliOptions.LoadThresholdNanoA,
+		ChargeCurrentThresholdNanoA: cliOptions.ChargeThresholdNanoA,
+	}
+
+	if cliOptions.RandomSample && cliOptions.SampleRate > 1 {
+		options.SamplingMethod = metrics.SamplingRandom
+	}
+
+	// An invalid name has already been rejected by buildFilterOptions
+	if location, err := loadTimezone(cliOptions.Timezone); err == nil {
+		options.Location = location
 	}
 
 	// Add specific metrics if requested
@@ -441,9 +1336,20 @@ func buildMetricsOptions(cliOptions CommandLineOptions) metrics.MetricsOptions {
 
 // generateOutput creates the appropriate output format based on user options
 func generateOutput(energyMetrics metrics.EnergyMetrics, options CommandLineOptions) (string, error) {
+	if options.Format == FormatMarkdown {
+		return generateMarkdownOutput(energyMetrics, options)
+	}
+
 	// If a specific metric was requested, extract just that
 	if options.Metric != "" {
 		metricType := metrics.MetricType(options.Metric)
+		if metricType == metrics.MetricSolarContribution && options.NoSolar {
+			return "", fmt.Errorf("solar statistics are disabled by --no-solar")
+		}
+		if metricType == metrics.MetricBatteryDischarge && options.NoBattery {
+			return "", fmt.Errorf("battery statistics are disabled by --no-battery")
+		}
+
 		specificMetric, err := metrics.GetSpecificMetric(energyMetrics, metricType)
 		if err != nil {
 			return "", err
@@ -452,6 +1358,11 @@ func generateOutput(energyMetrics metrics.EnergyMetrics, options CommandLineOpti
 		// Format the specific metric according to output format
 		switch options.Format {
 		case FormatJSON:
+			if options.ReservoirSize == 0 && (metricType == metrics.MetricTemperature || metricType == metrics.MetricVoltageStats || metricType == metrics.MetricCurrentStats) {
+				if specificMetric, err = withoutEstimatedPercentiles(specificMetric); err != nil {
+					return "", fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+			}
 			jsonData, err := json.MarshalIndent(specificMetric, "", "  ")
 			if err != nil {
 				return "", fmt.Errorf("failed to marshal JSON: %w", err)
@@ -459,32 +1370,118 @@ func generateOutput(energyMetrics metrics.EnergyMetrics, options CommandLineOpti
 			return string(jsonData), nil
 
 		case FormatCSV:
-			return formatMetricAsCSV(specificMetric, metricType)
+			return formatMetricAsCSV(specificMetric, metricType, options.ReservoirSize > 0)
+
+		case FormatShell:
+			return generateShellMetric(specificMetric, metricType, options.ShellPrefix, true)
 
 		default: // Text format
-			return formatMetricAsText(specificMetric, metricType), nil
+			text := formatMetricAsText(specificMetric, metricType, options.FieldSep, options.ReservoirSize > 0)
+			return text + formatMetricHistogram(energyMetrics, metricType, options.FieldSep), nil
 		}
 	}
 
 	// If no specific metric was requested, format the full report
 	switch options.Format {
 	case FormatJSON:
-		jsonData, err := json.MarshalIndent(energyMetrics, "", "  ")
+		jsonData, err := marshalReportJSON(energyMetrics, options)
 		if err != nil {
 			return "", fmt.Errorf("failed to marshal JSON: %w", err)
 		}
 		return string(jsonData), nil
 
 	case FormatCSV:
-		return generateCSVReport(energyMetrics)
+		return generateCSVReport(energyMetrics, options)
+
+	case FormatShell:
+		return generateShellOutput(energyMetrics, options.ShellPrefix, options.ShellIncludeMaps)
 
 	default: // Text format
-		return generateReport(energyMetrics, options.InputFile), nil
+		return generateReport(energyMetrics, options), nil
+	}
+}
+
+// reportJSON shadows the optional sections of EnergyMetrics so that they are
+// left out of the JSON report entirely when disabled
+type reportJSON struct {
+	metrics.EnergyMetrics
+	BatteryStats *metrics.BatteryStats `json:",omitempty"`
+	SolarStats   *metrics.SolarStats   `json:",omitempty"`
+
+	// The channel statistics lose their estimated percentiles when
+	// --reservoir-size is 0, see withoutEstimatedPercentiles
+	TemperatureStats interface{}
+	VoltageStats     interface{}
+	CurrentStats     interface{}
+
+	// BudgetViolations is only present when a --budget-* limit is set
+	BudgetViolations *[]BudgetViolation `json:",omitempty"`
+}
+
+// marshalReportJSON marshals the full report, omitting disabled sections
+func marshalReportJSON(energyMetrics metrics.EnergyMetrics, options CommandLineOptions) ([]byte, error) {
+	if !options.NoSolar && !options.NoBattery && !hasBudget(options) && options.ReservoirSize > 0 {
+		return json.MarshalIndent(energyMetrics, "", "  ")
 	}
+
+	report := reportJSON{
+		EnergyMetrics:    energyMetrics,
+		TemperatureStats: energyMetrics.TemperatureStats,
+		VoltageStats:     energyMetrics.VoltageStats,
+		CurrentStats:     energyMetrics.CurrentStats,
+	}
+	if options.ReservoirSize == 0 {
+		var err error
+		if report.TemperatureStats, err = withoutEstimatedPercentiles(energyMetrics.TemperatureStats); err != nil {
+			return nil, err
+		}
+		if report.VoltageStats, err = withoutEstimatedPercentiles(energyMetrics.VoltageStats); err != nil {
+			return nil, err
+		}
+		if report.CurrentStats, err = withoutEstimatedPercentiles(energyMetrics.CurrentStats); err != nil {
+			return nil, err
+		}
+	}
+	if !options.NoBattery {
+		report.BatteryStats = &energyMetrics.BatteryStats
+	}
+	if !options.NoSolar {
+		report.SolarStats = &energyMetrics.SolarStats
+	}
+	if hasBudget(options) {
+		violations := checkBudget(energyMetrics, options)
+		if violations == nil {
+			violations = []BudgetViolation{}
+		}
+		report.BudgetViolations = &violations
+	}
+	return json.MarshalIndent(report, "", "  ")
 }
 
-// formatMetricAsCSV formats a specific metric in CSV format
-func formatMetricAsCSV(metric interface{}, metricType metrics.MetricType) (string, error) {
+// estimatedPercentileFields are the channel statistics filled from the
+// reservoir sample
+var estimatedPercentileFields = []string{"P25", "P50", "P75", "P95", "P99", "MedianTempCelsius", "MedianVoltage", "MedianCurrent"}
+
+// withoutEstimatedPercentiles returns the JSON object of a channel's
+// statistics without estimatedPercentileFields
+func withoutEstimatedPercentiles(stats interface{}) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range estimatedPercentileFields {
+		delete(fields, name)
+	}
+	return fields, nil
+}
+
+// formatMetricAsCSV formats a specific metric in CSV format, leaving out
+// the estimated percentiles unless percentiles is set
+func formatMetricAsCSV(metric interface{}, metricType metrics.MetricType, percentiles bool) (string, error) {
 	var sb strings.Builder
 
 	switch metricType {
@@ -505,6 +1502,11 @@ func formatMetricAsCSV(metric interface{}, metricType metrics.MetricType) (strin
 		sb.WriteString(fmt.Sprintf("MinTemperature,%.2f\n", tempStats.MinTempCelsius))
 		sb.WriteString(fmt.Sprintf("MaxTemperature,%.2f\n", tempStats.MaxTempCelsius))
 		sb.WriteString(fmt.Sprintf("AvgTemperature,%.2f\n", tempStats.AvgTempCelsius))
+		sb.WriteString(fmt.Sprintf("TempRateOfChangePerSec,%.6f\n", tempStats.TempRateOfChangePerSec))
+		sb.WriteString(fmt.Sprintf("TempRateOfChangePeakPerSec,%.6f\n", tempStats.TempRateOfChangePeakPerSec))
+		sb.WriteString(fmt.Sprintf("TempThermalRunawayRisk,%t\n", tempStats.TempThermalRunawayRisk))
+		sb.WriteString(formatSpreadAsCSV("Temperature", tempStats.StdDev, tempStats.P25, tempStats.P50, tempStats.P75, tempStats.P95, tempStats.P99, percentiles, "%.2f"))
+		sb.WriteString(formatPercentilesAsCSV("Temperature", tempStats.ExactPercentiles, "%.2f"))
 
 	case metrics.MetricEnergyByHour:
 		hourlyEnergy, ok := metric.(map[int]float64)
@@ -518,6 +1520,18 @@ func formatMetricAsCSV(metric interface{}, metricType metrics.MetricType) (strin
 			}
 		}
 
+	case metrics.MetricEnergyByMinute:
+		minuteEnergy, ok := metric.(metrics.MinuteEnergy)
+		if !ok {
+			return "", fmt.Errorf("unexpected type for energy by minute")
+		}
+		sb.WriteString("Hour,Minute,EnergyJoules\n")
+		for m := 0; m < 24*60; m++ {
+			if energy, exists := minuteEnergy[m]; exists {
+				sb.WriteString(fmt.Sprintf("%d,%d,%.6f\n", m/60, m%60, energy))
+			}
+		}
+
 	case metrics.MetricVoltageStats:
 		voltStats, ok := metric.(metrics.VoltageStats)
 		if !ok {
@@ -527,6 +1541,10 @@ func formatMetricAsCSV(metric interface{}, metricType metrics.MetricType) (strin
 		sb.WriteString(fmt.Sprintf("MinVoltage,%.6f\n", voltStats.MinVoltage))
 		sb.WriteString(fmt.Sprintf("MaxVoltage,%.6f\n", voltStats.MaxVoltage))
 		sb.WriteString(fmt.Sprintf("AvgVoltage,%.6f\n", voltStats.AvgVoltage))
+		sb.WriteString(fmt.Sprintf("RippleAmplitudeV,%.6f\n", voltStats.RippleAmplitudeV))
+		sb.WriteString(fmt.Sprintf("RippleRmsV,%.6f\n", voltStats.RippleRmsV))
+		sb.WriteString(formatSpreadAsCSV("Voltage", voltStats.StdDev, voltStats.P25, voltStats.P50, voltStats.P75, voltStats.P95, voltStats.P99, percentiles, "%.6f"))
+		sb.WriteString(formatPercentilesAsCSV("Voltage", voltStats.ExactPercentiles, "%.6f"))
 
 	case metrics.MetricCurrentStats:
 		currentStats, ok := metric.(metrics.CurrentStats)
@@ -539,6 +1557,8 @@ func formatMetricAsCSV(metric interface{}, metricType metrics.MetricType) (strin
 		sb.WriteString(fmt.Sprintf("AvgCurrent,%.9f\n", currentStats.AvgCurrent))
 		sb.WriteString(fmt.Sprintf("MaxDischarge,%.9f\n", currentStats.MaxDischarge))
 		sb.WriteString(fmt.Sprintf("MaxCharging,%.9f\n", currentStats.MaxCharging))
+		sb.WriteString(formatSpreadAsCSV("Current", currentStats.StdDev, currentStats.P25, currentStats.P50, currentStats.P75, currentStats.P95, currentStats.P99, percentiles, "%.9f"))
+		sb.WriteString(formatPercentilesAsCSV("Current", currentStats.ExactPercentiles, "%.9f"))
 
 	case metrics.MetricBatteryDischarge:
 		batteryStats, ok := metric.(metrics.BatteryStats)
@@ -550,6 +1570,12 @@ func formatMetricAsCSV(metric interface{}, metricType metrics.MetricType) (strin
 		sb.WriteString(fmt.Sprintf("TotalChargeTime,%.2f\n", batteryStats.TotalChargeTime))
 		sb.WriteString(fmt.Sprintf("DischargeToChargeRatio,%.6f\n", batteryStats.DischargeToChargeRatio))
 		sb.WriteString(fmt.Sprintf("AverageDischargeRate,%.6f\n", batteryStats.AverageDischargeRate))
+		sb.WriteString(fmt.Sprintf("ChargePowerAvg,%.6f\n", batteryStats.ChargePowerAvg))
+		sb.WriteString(fmt.Sprintf("DischargePowerAvg,%.6f\n", batteryStats.DischargePowerAvg))
+		sb.WriteString(fmt.Sprintf("PowerAsymmetryRatio,%.6f\n", batteryStats.PowerAsymmetryRatio))
+		sb.WriteString(formatCoulombCountingAsCSV(batteryStats))
+		sb.WriteString(fmt.Sprintf("CycleCount,%d\n", batteryStats.CycleCount))
+		sb.WriteString(formatCyclesAsCSV(batteryStats.Cycles))
 
 	case metrics.MetricSolarContribution:
 		solarStats, ok := metric.(metrics.SolarStats)
@@ -562,6 +1588,23 @@ func formatMetricAsCSV(metric interface{}, metricType metrics.MetricType) (strin
 		sb.WriteString(fmt.Sprintf("PeakOutput,%.6f\n", solarStats.PeakOutput))
 		sb.WriteString(fmt.Sprintf("ContributionPercentage,%.2f\n", solarStats.ContributionPercentage))
 
+	case metrics.MetricPAPR:
+		paprStats, ok := metric.(metrics.PAPRStats)
+		if !ok {
+			return "", fmt.Errorf("unexpected type for PAPR stats")
+		}
+		sb.WriteString("Measurement,Value\n")
+		sb.WriteString(fmt.Sprintf("PAPR,%.6f\n", paprStats.PAPR))
+		sb.WriteString(fmt.Sprintf("CrestFactor,%.6f\n", paprStats.CrestFactor))
+
+	case metrics.MetricEfficiency:
+		efficiencyStats, ok := metric.(metrics.EfficiencyStats)
+		if !ok {
+			return "", fmt.Errorf("unexpected type for efficiency stats")
+		}
+		sb.WriteString("Measurement,Value\n")
+		sb.WriteString(formatEfficiencyAsCSV(efficiencyStats))
+
 	default:
 		return "", fmt.Errorf("CSV formatting not supported for metric type: %s", metricType)
 	}
@@ -569,8 +1612,9 @@ func formatMetricAsCSV(metric interface{}, metricType metrics.MetricType) (strin
 	return sb.String(), nil
 }
 
-// formatMetricAsText formats a specific metric in human-readable text format
-func formatMetricAsText(metric interface{}, metricType metrics.MetricType) string {
+// formatMetricAsText formats a specific metric in human-readable text
+// format, leaving out the estimated percentiles unless percentiles is set
+func formatMetricAsText(metric interface{}, metricType metrics.MetricType, sep string, percentiles bool) string {
 	var sb strings.Builder
 
 	sb.WriteString(fmt.Sprintf("===== %s =====\n", strings.ToUpper(string(metricType))))
@@ -578,77 +1622,118 @@ func formatMetricAsText(metric interface{}, metricType metrics.MetricType) strin
 	switch metricType {
 	case metrics.MetricTotalEnergy:
 		value := metric.(float64)
-		sb.WriteString(fmt.Sprintf("Total Energy: %.4f joules\n", value))
+		sb.WriteString(TableRow("Total Energy", fmt.Sprintf("%.4f", value), "joules", sep))
 
 	case metrics.MetricAveragePower:
 		value := metric.(float64)
-		sb.WriteString(fmt.Sprintf("Average Power: %.4f watts\n", value))
+		sb.WriteString(TableRow("Average Power", fmt.Sprintf("%.4f", value), "watts", sep))
 
 	case metrics.MetricPeakPower:
 		value := metric.(float64)
-		sb.WriteString(fmt.Sprintf("Peak Power: %.4f watts\n", value))
+		sb.WriteString(TableRow("Peak Power", fmt.Sprintf("%.4f", value), "watts", sep))
 
 	case metrics.MetricTemperature:
 		tempStats := metric.(metrics.TemperatureStats)
-		sb.WriteString(fmt.Sprintf("Minimum Temperature: %.2f °C\n", tempStats.MinTempCelsius))
-		sb.WriteString(fmt.Sprintf("Maximum Temperature: %.2f °C\n", tempStats.MaxTempCelsius))
-		sb.WriteString(fmt.Sprintf("Average Temperature: %.2f °C\n", tempStats.AvgTempCelsius))
+		sb.WriteString(TableRow("Minimum Temperature", fmt.Sprintf("%.2f", tempStats.MinTempCelsius), "°C", sep))
+		sb.WriteString(TableRow("Maximum Temperature", fmt.Sprintf("%.2f", tempStats.MaxTempCelsius), "°C", sep))
+		sb.WriteString(TableRow("Average Temperature", fmt.Sprintf("%.2f", tempStats.AvgTempCelsius), "°C", sep))
+		sb.WriteString(formatTempRateAsText(tempStats, sep))
+		sb.WriteString(formatSpreadAsText("Temperature", tempStats.StdDev, tempStats.P25, tempStats.P50, tempStats.P75, tempStats.P95, tempStats.P99, percentiles, "%.2f", "°C", sep))
+		sb.WriteString(formatPercentilesAsText("Temperature Percentiles", tempStats.ExactPercentiles, "%.2f", "°C", sep))
 
 	case metrics.MetricEnergyByHour:
 		hourlyEnergy := metric.(map[int]float64)
 		sb.WriteString("Energy Consumption by Hour:\n")
 		for h := 0; h < 24; h++ {
 			if energy, exists := hourlyEnergy[h]; exists {
-				sb.WriteString(fmt.Sprintf("Hour %02d: %.4f joules\n", h, energy))
+				sb.WriteString(TableRow(fmt.Sprintf("Hour %02d", h), fmt.Sprintf("%.4f", energy), "joules", sep))
+			}
+		}
+
+	case metrics.MetricEnergyByMinute:
+		minuteEnergy := metric.(metrics.MinuteEnergy)
+		sb.WriteString("Energy Consumption by Minute:\n")
+		for m := 0; m < 24*60; m++ {
+			if energy, exists := minuteEnergy[m]; exists {
+				sb.WriteString(TableRow(fmt.Sprintf("%02d:%02d", m/60, m%60), fmt.Sprintf("%.4f", energy), "joules", sep))
 			}
 		}
 
 	case metrics.MetricVoltageStats:
 		voltStats := metric.(metrics.VoltageStats)
-		sb.WriteString(fmt.Sprintf("Minimum Voltage: %.6f V\n", voltStats.MinVoltage))
-		sb.WriteString(fmt.Sprintf("Maximum Voltage: %.6f V\n", voltStats.MaxVoltage))
-		sb.WriteString(fmt.Sprintf("Average Voltage: %.6f V\n", voltStats.AvgVoltage))
+		sb.WriteString(TableRow("Minimum Voltage", fmt.Sprintf("%.6f", voltStats.MinVoltage), "V", sep))
+		sb.WriteString(TableRow("Maximum Voltage", fmt.Sprintf("%.6f", voltStats.MaxVoltage), "V", sep))
+		sb.WriteString(TableRow("Average Voltage", fmt.Sprintf("%.6f", voltStats.AvgVoltage), "V", sep))
+		sb.WriteString(TableRow("Ripple Amplitude (p-p)", fmt.Sprintf("%.6f", voltStats.RippleAmplitudeV), "V", sep))
+		sb.WriteString(TableRow("Ripple RMS", fmt.Sprintf("%.6f", voltStats.RippleRmsV), "V", sep))
+		sb.WriteString(formatSpreadAsText("Voltage", voltStats.StdDev, voltStats.P25, voltStats.P50, voltStats.P75, voltStats.P95, voltStats.P99, percentiles, "%.6f", "V", sep))
+		sb.WriteString(formatPercentilesAsText("Voltage Percentiles", voltStats.ExactPercentiles, "%.6f", "V", sep))
 
 	case metrics.MetricCurrentStats:
 		currentStats := metric.(metrics.CurrentStats)
-		sb.WriteString(fmt.Sprintf("Minimum Current: %.9f A\n", currentStats.MinCurrent))
-		sb.WriteString(fmt.Sprintf("Maximum Current: %.9f A\n", currentStats.MaxCurrent))
-		sb.WriteString(fmt.Sprintf("Average Current: %.9f A\n", currentStats.AvgCurrent))
-		sb.WriteString(fmt.Sprintf("Maximum Discharge Current: %.9f A\n", currentStats.MaxDischarge))
-		sb.WriteString(fmt.Sprintf("Maximum Charging Current: %.9f A\n", currentStats.MaxCharging))
+		sb.WriteString(TableRow("Minimum Current", fmt.Sprintf("%.9f", currentStats.MinCurrent), "A", sep))
+		sb.WriteString(TableRow("Maximum Current", fmt.Sprintf("%.9f", currentStats.MaxCurrent), "A", sep))
+		sb.WriteString(TableRow("Average Current", fmt.Sprintf("%.9f", currentStats.AvgCurrent), "A", sep))
+		sb.WriteString(TableRow("Maximum Discharge Current", fmt.Sprintf("%.9f", currentStats.MaxDischarge), "A", sep))
+		sb.WriteString(TableRow("Maximum Charging Current", fmt.Sprintf("%.9f", currentStats.MaxCharging), "A", sep))
+		sb.WriteString(formatSpreadAsText("Current", currentStats.StdDev, currentStats.P25, currentStats.P50, currentStats.P75, currentStats.P95, currentStats.P99, percentiles, "%.9f", "A", sep))
+		sb.WriteString(formatPercentilesAsText("Current Percentiles", currentStats.ExactPercentiles, "%.9f", "A", sep))
 
 	case metrics.MetricBatteryDischarge:
 		batteryStats := metric.(metrics.BatteryStats)
-		sb.WriteString(fmt.Sprintf("Total Discharge Time: %.2f seconds\n", batteryStats.TotalDischargeTime))
-		sb.WriteString(fmt.Sprintf("Total Charge Time: %.2f seconds\n", batteryStats.TotalChargeTime))
-		sb.WriteString(fmt.Sprintf("Discharge to Charge Ratio: %.2f%%\n", batteryStats.DischargeToChargeRatio*100))
-		sb.WriteString(fmt.Sprintf("Average Discharge Rate: %.4f watts\n\n", batteryStats.AverageDischargeRate))
+		sb.WriteString(TableRow("Total Discharge Time", fmt.Sprintf("%.2f", batteryStats.TotalDischargeTime), "seconds", sep))
+		sb.WriteString(TableRow("Total Charge Time", fmt.Sprintf("%.2f", batteryStats.TotalChargeTime), "seconds", sep))
+		sb.WriteString(TableRow("Discharge to Charge Ratio", fmt.Sprintf("%.2f%%", batteryStats.DischargeToChargeRatio*100), "", sep))
+		sb.WriteString(TableRow("Average Discharge Rate", fmt.Sprintf("%.4f", batteryStats.AverageDischargeRate), "watts", sep))
+		sb.WriteString(formatPowerAsymmetryText(batteryStats, sep))
+		sb.WriteString(formatCoulombCountingText(batteryStats, sep))
+		sb.WriteString(TableRow("Discharge Cycles", fmt.Sprintf("%d", batteryStats.CycleCount), "", sep))
+		sb.WriteString(formatCyclesAsText(batteryStats.Cycles, sep))
+		sb.WriteString("\n")
 
 	case metrics.MetricSolarContribution:
 		solarStats := metric.(metrics.SolarStats)
-		sb.WriteString(fmt.Sprintf("Total Energy Produced: %.4f joules\n", solarStats.TotalEnergyProduced))
-		sb.WriteString(fmt.Sprintf("Average Output: %.4f watts\n", solarStats.AverageOutput))
-		sb.WriteString(fmt.Sprintf("Peak Output: %.4f watts\n", solarStats.PeakOutput))
-		sb.WriteString(fmt.Sprintf("Contribution to Energy: %.2f%%\n\n", solarStats.ContributionPercentage))
+		sb.WriteString(TableRow("Total Energy Produced", fmt.Sprintf("%.4f", solarStats.TotalEnergyProduced), "joules", sep))
+		sb.WriteString(TableRow("Average Output", fmt.Sprintf("%.4f", solarStats.AverageOutput), "watts", sep))
+		sb.WriteString(TableRow("Peak Output", fmt.Sprintf("%.4f", solarStats.PeakOutput), "watts", sep))
+		sb.WriteString(TableRow("Contribution to Energy", fmt.Sprintf("%.2f%%", solarStats.ContributionPercentage), "", sep))
+		sb.WriteString("\n")
+
+	case metrics.MetricPAPR:
+		paprStats := metric.(metrics.PAPRStats)
+		sb.WriteString(TableRow("Peak-to-Average Ratio", fmt.Sprintf("%.2f", paprStats.PAPR), "", sep))
+		sb.WriteString(TableRow("Crest Factor", fmt.Sprintf("%.2f", paprStats.CrestFactor), "", sep))
+
+	case metrics.MetricEfficiency:
+		sb.WriteString(formatEfficiencyAsText(metric.(metrics.EfficiencyStats), sep))
 
 	default:
-		sb.WriteString(fmt.Sprintf("No text formatter available for metric type: %s\n", metricType))
+		sb.WriteString(TableRow("No text formatter available for metric type", fmt.Sprintf("%s", metricType), "", sep))
 	}
 
 	return sb.String()
 }
 
 // generateCSVReport creates a CSV report for all metrics
-func generateCSVReport(metrics metrics.EnergyMetrics) (string, error) {
+func generateCSVReport(metrics metrics.EnergyMetrics, options CommandLineOptions) (string, error) {
 	var sb strings.Builder
+	percentiles := options.ReservoirSize > 0
 
 	sb.WriteString("Metric,Value\n")
 	sb.WriteString(fmt.Sprintf("TotalJoules,%.6f\n", metrics.TotalJoules))
 	sb.WriteString(fmt.Sprintf("AveragePowerWatts,%.6f\n", metrics.AveragePowerWatts))
 	sb.WriteString(fmt.Sprintf("PeakPowerWatts,%.6f\n", metrics.PeakPowerWatts))
+	sb.WriteString(fmt.Sprintf("PeakToAveragePowerRatio,%.6f\n", metrics.PeakToAveragePowerRatio))
+	sb.WriteString(fmt.Sprintf("CrestFactor,%.6f\n", metrics.CrestFactor))
+	sb.WriteString(fmt.Sprintf("HourlyEnergyEntropy,%.6f\n", metrics.HourlyEnergyEntropy))
+	sb.WriteString(fmt.Sprintf("HourlyEnergyEntropyNormalized,%.6f\n", metrics.HourlyEnergyEntropyNormalized))
 	sb.WriteString(fmt.Sprintf("JoulesPerDay,%.6f\n", metrics.JoulesPerDay))
 	sb.WriteString(fmt.Sprintf("DurationSeconds,%.2f\n", metrics.DurationSeconds))
 	sb.WriteString(fmt.Sprintf("DataPoints,%d\n", metrics.DataPoints))
+	sb.WriteString(fmt.Sprintf("SamplingMethod,%s\n", metrics.SamplingMethod))
+	sb.WriteString(fmt.Sprintf("DataCompletenessScore,%.4f\n", metrics.DataCompletenessScore))
+	sb.WriteString(fmt.Sprintf("DataQuality,%s\n", metrics.DataQuality))
+	sb.WriteString(fmt.Sprintf("MaxTimeDeltaMs,%d\n", metrics.MaxTimeDeltaMs))
 	sb.WriteString(fmt.Sprintf("StartTime,%s\n", metrics.TimeRange.StartTime.Format(time.RFC3339)))
 	sb.WriteString(fmt.Sprintf("EndTime,%s\n", metrics.TimeRange.EndTime.Format(time.RFC3339)))
 
@@ -656,11 +1741,20 @@ func generateCSVReport(metrics metrics.EnergyMetrics) (string, error) {
 	sb.WriteString(fmt.Sprintf("MinTempCelsius,%.2f\n", metrics.TemperatureStats.MinTempCelsius))
 	sb.WriteString(fmt.Sprintf("MaxTempCelsius,%.2f\n", metrics.TemperatureStats.MaxTempCelsius))
 	sb.WriteString(fmt.Sprintf("AvgTempCelsius,%.2f\n", metrics.TemperatureStats.AvgTempCelsius))
+	sb.WriteString(fmt.Sprintf("TempRateOfChangePerSec,%.6f\n", metrics.TemperatureStats.TempRateOfChangePerSec))
+	sb.WriteString(fmt.Sprintf("TempRateOfChangePeakPerSec,%.6f\n", metrics.TemperatureStats.TempRateOfChangePeakPerSec))
+	sb.WriteString(fmt.Sprintf("TempThermalRunawayRisk,%t\n", metrics.TemperatureStats.TempThermalRunawayRisk))
+	sb.WriteString(formatSpreadAsCSV("TempCelsius", metrics.TemperatureStats.StdDev, metrics.TemperatureStats.P25, metrics.TemperatureStats.P50, metrics.TemperatureStats.P75, metrics.TemperatureStats.P95, metrics.TemperatureStats.P99, percentiles, "%.2f"))
+	sb.WriteString(formatPercentilesAsCSV("TempCelsius", metrics.TemperatureStats.ExactPercentiles, "%.2f"))
 
 	sb.WriteString("\nVoltageStats,Value\n")
 	sb.WriteString(fmt.Sprintf("MinVoltage,%.6f\n", metrics.VoltageStats.MinVoltage))
 	sb.WriteString(fmt.Sprintf("MaxVoltage,%.6f\n", metrics.VoltageStats.MaxVoltage))
 	sb.WriteString(fmt.Sprintf("AvgVoltage,%.6f\n", metrics.VoltageStats.AvgVoltage))
+	sb.WriteString(fmt.Sprintf("RippleAmplitudeV,%.6f\n", metrics.VoltageStats.RippleAmplitudeV))
+	sb.WriteString(fmt.Sprintf("RippleRmsV,%.6f\n", metrics.VoltageStats.RippleRmsV))
+	sb.WriteString(formatSpreadAsCSV("Voltage", metrics.VoltageStats.StdDev, metrics.VoltageStats.P25, metrics.VoltageStats.P50, metrics.VoltageStats.P75, metrics.VoltageStats.P95, metrics.VoltageStats.P99, percentiles, "%.6f"))
+	sb.WriteString(formatPercentilesAsCSV("Voltage", metrics.VoltageStats.ExactPercentiles, "%.6f"))
 
 	sb.WriteString("\nCurrentStats,Value\n")
 	sb.WriteString(fmt.Sprintf("MinCurrent,%.9f\n", metrics.CurrentStats.MinCurrent))
@@ -668,18 +1762,48 @@ func generateCSVReport(metrics metrics.EnergyMetrics) (string, error) {
 	sb.WriteString(fmt.Sprintf("AvgCurrent,%.9f\n", metrics.CurrentStats.AvgCurrent))
 	sb.WriteString(fmt.Sprintf("MaxDischarge,%.9f\n", metrics.CurrentStats.MaxDischarge))
 	sb.WriteString(fmt.Sprintf("MaxCharging,%.9f\n", metrics.CurrentStats.MaxCharging))
+	sb.WriteString(formatSpreadAsCSV("Current", metrics.CurrentStats.StdDev, metrics.CurrentStats.P25, metrics.CurrentStats.P50, metrics.CurrentStats.P75, metrics.CurrentStats.P95, metrics.CurrentStats.P99, percentiles, "%.9f"))
+	sb.WriteString(formatPercentilesAsCSV("Current", metrics.CurrentStats.ExactPercentiles, "%.9f"))
+
+	sb.WriteString("\nCorrelations,Value\n")
+	sb.WriteString(fmt.Sprintf("VoltageCurrent,%.6f\n", metrics.Correlations.VoltageCurrent))
+	sb.WriteString(fmt.Sprintf("VoltageTemperature,%.6f\n", metrics.Correlations.VoltageTemperature))
+	sb.WriteString(fmt.Sprintf("CurrentTemperature,%.6f\n", metrics.Correlations.CurrentTemperature))
+
+	if !options.NoBattery {
+		sb.WriteString("\nBatteryStats,Value\n")
+		sb.WriteString(fmt.Sprintf("TotalDischargeTime,%.2f\n", metrics.BatteryStats.TotalDischargeTime))
+		sb.WriteString(fmt.Sprintf("TotalChargeTime,%.2f\n", metrics.BatteryStats.TotalChargeTime))
+		sb.WriteString(fmt.Sprintf("DischargeToChargeRatio,%.6f\n", metrics.BatteryStats.DischargeToChargeRatio))
+		sb.WriteString(fmt.Sprintf("AverageDischargeRate,%.6f\n", metrics.BatteryStats.AverageDischargeRate))
+		sb.WriteString(fmt.Sprintf("ChargePowerAvg,%.6f\n", metrics.BatteryStats.ChargePowerAvg))
+		sb.WriteString(fmt.Sprintf("DischargePowerAvg,%.6f\n", metrics.BatteryStats.DischargePowerAvg))
+		sb.WriteString(fmt.Sprintf("PowerAsymmetryRatio,%.6f\n", metrics.BatteryStats.PowerAsymmetryRatio))
+		sb.WriteString(formatCoulombCountingAsCSV(metrics.BatteryStats))
+		sb.WriteString(fmt.Sprintf("CycleCount,%d\n", metrics.BatteryStats.CycleCount))
+	}
 
-	sb.WriteString("\nBatteryStats,Value\n")
-	sb.WriteString(fmt.Sprintf("TotalDischargeTime,%.2f\n", metrics.BatteryStats.TotalDischargeTime))
-	sb.WriteString(fmt.Sprintf("TotalChargeTime,%.2f\n", metrics.BatteryStats.TotalChargeTime))
-	sb.WriteString(fmt.Sprintf("DischargeToChargeRatio,%.6f\n", metrics.BatteryStats.DischargeToChargeRatio))
-	sb.WriteString(fmt.Sprintf("AverageDischargeRate,%.6f\n", metrics.BatteryStats.AverageDischargeRate))
+	if !options.NoSolar {
+		sb.WriteString("\nSolarStats,Value\n")
+		sb.WriteString(fmt.Sprintf("TotalEnergyProduced,%.6f\n", metrics.SolarStats.TotalEnergyProduced))
+		sb.WriteString(fmt.Sprintf("AverageOutput,%.6f\n", metrics.SolarStats.AverageOutput))
+		sb.WriteString(fmt.Sprintf("PeakOutput,%.6f\n", metrics.SolarStats.PeakOutput))
+		sb.WriteString(fmt.Sprintf("ContributionPercentage,%.2f\n", metrics.SolarStats.ContributionPercentage))
+	}
 
-	sb.WriteString("\nSolarStats,Value\n")
-	sb.WriteString(fmt.Sprintf("TotalEnergyProduced,%.6f\n", metrics.SolarStats.TotalEnergyProduced))
-	sb.WriteString(fmt.Sprintf("AverageOutput,%.6f\n", metrics.SolarStats.AverageOutput))
-	sb.WriteString(fmt.Sprintf("PeakOutput,%.6f\n", metrics.SolarStats.PeakOutput))
-	sb.WriteString(fmt.Sprintf("ContributionPercentage,%.2f\n", metrics.SolarStats.ContributionPercentage))
+	sb.WriteString("\nEfficiencyStats,Value\n")
+	sb.WriteString(formatEfficiencyAsCSV(metrics.EfficiencyStats))
+
+	if metrics.CostAnalysis.RatePerKWh > 0 {
+		sb.WriteString("\nCostAnalysis,Value\n")
+		sb.WriteString(fmt.Sprintf("EnergyKWh,%.9f\n", metrics.CostAnalysis.EnergyKWh))
+		sb.WriteString(fmt.Sprintf("RatePerKWh,%.6f\n", metrics.CostAnalysis.RatePerKWh))
+		sb.WriteString(fmt.Sprintf("BaseCurrency,%s\n", metrics.CostAnalysis.BaseCurrency))
+		sb.WriteString(fmt.Sprintf("TotalCostBase,%.6f\n", metrics.CostAnalysis.TotalCostBase))
+		sb.WriteString(fmt.Sprintf("TargetCurrency,%s\n", metrics.CostAnalysis.TargetCurrency))
+		sb.WriteString(fmt.Sprintf("ExchangeRate,%.6f\n", metrics.CostAnalysis.ExchangeRate))
+		sb.WriteString(fmt.Sprintf("TotalCostConverted,%.6f\n", metrics.CostAnalysis.TotalCostConverted))
+	}
 
 	sb.WriteString("\nHour,EnergyJoules\n")
 	for h := 0; h < 24; h++ {
@@ -688,62 +1812,135 @@ func generateCSVReport(metrics metrics.EnergyMetrics) (string, error) {
 		}
 	}
 
+	sb.WriteString(formatPeakEventsAsCSV(metrics.PeakEvents))
+
 	return sb.String(), nil
 }
 
 // generateReport creates a human-readable report of the energy metrics
-func generateReport(metrics metrics.EnergyMetrics, inputFile string) string {
+func generateReport(metrics metrics.EnergyMetrics, options CommandLineOptions) string {
 	var sb strings.Builder
+	sep := options.FieldSep
+	percentiles := options.ReservoirSize > 0
 
 	sb.WriteString("========== ENEMETER DATA PROCESSING REPORT ==========\n")
-	sb.WriteString(fmt.Sprintf("Input File: %s\n", filepath.Base(inputFile)))
+	if len(options.InputFiles) == 1 {
+		sb.WriteString(fmt.Sprintf("Input File: %s\n", filepath.Base(options.InputFiles[0])))
+	} else {
+		names := make([]string, len(options.InputFiles))
+		for i, inputFile := range options.InputFiles {
+			names[i] = filepath.Base(inputFile)
+		}
+		sb.WriteString(fmt.Sprintf("Input Files: %s\n", strings.Join(names, ", ")))
+	}
 	sb.WriteString(fmt.Sprintf("Date: %s\n", time.Now().Format("2006-01-02 15:04:05")))
-	sb.WriteString(fmt.Sprintf("Data Points: %d\n", metrics.DataPoints))
+	sb.WriteString(TableRow("Data Points", fmt.Sprintf("%d", metrics.DataPoints), "", sep))
+	sb.WriteString(fmt.Sprintf("Sampling Method: %s\n", metrics.SamplingMethod))
+	sb.WriteString(TableRow("Data Completeness", fmt.Sprintf("%.2f", metrics.DataCompletenessScore), "("+metrics.DataQuality+")", sep))
+	sb.WriteString(TableRow("Longest Interval", fmt.Sprintf("%.3f", float64(metrics.MaxTimeDeltaMs)/1000.0), "seconds", sep))
 	sb.WriteString(fmt.Sprintf("Time Range: %s to %s\n\n",
 		metrics.TimeRange.StartTime.Format("2006-01-02 15:04:05"),
 		metrics.TimeRange.EndTime.Format("2006-01-02 15:04:05")))
 
 	sb.WriteString("ENERGY METRICS\n")
 	sb.WriteString("-------------\n")
-	sb.WriteString(fmt.Sprintf("Total Energy Consumed: %.4f joules\n", metrics.TotalJoules))
-	sb.WriteString(fmt.Sprintf("Average Power: %.4f watts\n", metrics.AveragePowerWatts))
-	sb.WriteString(fmt.Sprintf("Peak Power: %.4f watts\n", metrics.PeakPowerWatts))
-	sb.WriteString(fmt.Sprintf("Estimated Energy per Day: %.4f joules\n", metrics.JoulesPerDay))
-	sb.WriteString(fmt.Sprintf("Measurement Duration: %.2f seconds\n\n", metrics.DurationSeconds))
+	sb.WriteString(TableRow("Total Energy Consumed", fmt.Sprintf("%.4f", metrics.TotalJoules), "joules", sep))
+	sb.WriteString(TableRow("Average Power", fmt.Sprintf("%.4f", metrics.AveragePowerWatts), "watts", sep))
+	sb.WriteString(TableRow("Peak Power", fmt.Sprintf("%.4f", metrics.PeakPowerWatts), "watts", sep))
+	sb.WriteString(TableRow("Peak-to-Average Ratio", fmt.Sprintf("%.2f", metrics.PeakToAveragePowerRatio), "", sep))
+	sb.WriteString(TableRow("Crest Factor", fmt.Sprintf("%.2f", metrics.CrestFactor), "", sep))
+	sb.WriteString(TableRow("Hourly Energy Entropy", fmt.Sprintf("%.2f", metrics.HourlyEnergyEntropy), "bits", sep))
+	sb.WriteString(TableRow("Normalized Hourly Entropy", fmt.Sprintf("%.2f", metrics.HourlyEnergyEntropyNormalized), "", sep))
+	sb.WriteString(TableRow("Estimated Energy per Day", fmt.Sprintf("%.4f", metrics.JoulesPerDay), "joules", sep))
+	sb.WriteString(TableRow("Measurement Duration", fmt.Sprintf("%.2f", metrics.DurationSeconds), "seconds", sep))
+	sb.WriteString("\n")
+
+	if options.PeakThresholdW > 0 {
+		sb.WriteString("PEAK POWER EVENTS\n")
+		sb.WriteString("-----------------\n")
+		sb.WriteString(formatPeakEventsAsText(metrics.PeakEvents, options.PeakThresholdW, sep))
+		sb.WriteString("\n")
+	}
 
 	sb.WriteString("TEMPERATURE STATISTICS\n")
 	sb.WriteString("---------------------\n")
-	sb.WriteString(fmt.Sprintf("Minimum Temperature: %.2f °C\n", metrics.TemperatureStats.MinTempCelsius))
-	sb.WriteString(fmt.Sprintf("Maximum Temperature: %.2f °C\n", metrics.TemperatureStats.MaxTempCelsius))
-	sb.WriteString(fmt.Sprintf("Average Temperature: %.2f °C\n\n", metrics.TemperatureStats.AvgTempCelsius))
+	sb.WriteString(TableRow("Minimum Temperature", fmt.Sprintf("%.2f", metrics.TemperatureStats.MinTempCelsius), "°C", sep))
+	sb.WriteString(TableRow("Maximum Temperature", fmt.Sprintf("%.2f", metrics.TemperatureStats.MaxTempCelsius), "°C", sep))
+	sb.WriteString(TableRow("Average Temperature", fmt.Sprintf("%.2f", metrics.TemperatureStats.AvgTempCelsius), "°C", sep))
+	sb.WriteString(formatTempRateAsText(metrics.TemperatureStats, sep))
+	sb.WriteString(formatSpreadAsText("Temperature", metrics.TemperatureStats.StdDev, metrics.TemperatureStats.P25, metrics.TemperatureStats.P50, metrics.TemperatureStats.P75, metrics.TemperatureStats.P95, metrics.TemperatureStats.P99, percentiles, "%.2f", "°C", sep))
+	sb.WriteString(formatPercentilesAsText("Temperature Percentiles", metrics.TemperatureStats.ExactPercentiles, "%.2f", "°C", sep))
+	sb.WriteString("\n")
 
 	sb.WriteString("VOLTAGE STATISTICS\n")
 	sb.WriteString("----------------\n")
-	sb.WriteString(fmt.Sprintf("Minimum Voltage: %.6f V\n", metrics.VoltageStats.MinVoltage))
-	sb.WriteString(fmt.Sprintf("Maximum Voltage: %.6f V\n", metrics.VoltageStats.MaxVoltage))
-	sb.WriteString(fmt.Sprintf("Average Voltage: %.6f V\n\n", metrics.VoltageStats.AvgVoltage))
+	sb.WriteString(TableRow("Minimum Voltage", fmt.Sprintf("%.6f", metrics.VoltageStats.MinVoltage), "V", sep))
+	sb.WriteString(TableRow("Maximum Voltage", fmt.Sprintf("%.6f", metrics.VoltageStats.MaxVoltage), "V", sep))
+	sb.WriteString(TableRow("Average Voltage", fmt.Sprintf("%.6f", metrics.VoltageStats.AvgVoltage), "V", sep))
+	sb.WriteString(TableRow("Ripple Amplitude (p-p)", fmt.Sprintf("%.6f", metrics.VoltageStats.RippleAmplitudeV), "V", sep))
+	sb.WriteString(TableRow("Ripple RMS", fmt.Sprintf("%.6f", metrics.VoltageStats.RippleRmsV), "V", sep))
+	sb.WriteString(formatSpreadAsText("Voltage", metrics.VoltageStats.StdDev, metrics.VoltageStats.P25, metrics.VoltageStats.P50, metrics.VoltageStats.P75, metrics.VoltageStats.P95, metrics.VoltageStats.P99, percentiles, "%.6f", "V", sep))
+	sb.WriteString(formatPercentilesAsText("Voltage Percentiles", metrics.VoltageStats.ExactPercentiles, "%.6f", "V", sep))
+	sb.WriteString("\n")
 
 	sb.WriteString("CURRENT STATISTICS\n")
 	sb.WriteString("----------------\n")
-	sb.WriteString(fmt.Sprintf("Minimum Current: %.9f A\n", metrics.CurrentStats.MinCurrent))
-	sb.WriteString(fmt.Sprintf("Maximum Current: %.9f A\n", metrics.CurrentStats.MaxCurrent))
-	sb.WriteString(fmt.Sprintf("Average Current: %.9f A\n", metrics.CurrentStats.AvgCurrent))
-	sb.WriteString(fmt.Sprintf("Maximum Discharge Current: %.9f A\n", metrics.CurrentStats.MaxDischarge))
-	sb.WriteString(fmt.Sprintf("Maximum Charging Current: %.9f A\n\n", metrics.CurrentStats.MaxCharging))
-
-	sb.WriteString("BATTERY STATISTICS\n")
-	sb.WriteString("------------------\n")
-	sb.WriteString(fmt.Sprintf("Total Discharge Time: %.2f seconds\n", metrics.BatteryStats.TotalDischargeTime))
-	sb.WriteString(fmt.Sprintf("Total Charge Time: %.2f seconds\n", metrics.BatteryStats.TotalChargeTime))
-	sb.WriteString(fmt.Sprintf("Discharge to Charge Ratio: %.2f%%\n", metrics.BatteryStats.DischargeToChargeRatio*100))
-	sb.WriteString(fmt.Sprintf("Average Discharge Rate: %.4f watts\n\n", metrics.BatteryStats.AverageDischargeRate))
-
-	sb.WriteString("SOLAR CONTRIBUTION\n")
-	sb.WriteString("-----------------\n")
-	sb.WriteString(fmt.Sprintf("Total Energy Produced: %.4f joules\n", metrics.SolarStats.TotalEnergyProduced))
-	sb.WriteString(fmt.Sprintf("Average Output: %.4f watts\n", metrics.SolarStats.AverageOutput))
-	sb.WriteString(fmt.Sprintf("Peak Output: %.4f watts\n", metrics.SolarStats.PeakOutput))
-	sb.WriteString(fmt.Sprintf("Contribution to Energy: %.2f%%\n\n", metrics.SolarStats.ContributionPercentage))
+	sb.WriteString(TableRow("Minimum Current", fmt.Sprintf("%.9f", metrics.CurrentStats.MinCurrent), "A", sep))
+	sb.WriteString(TableRow("Maximum Current", fmt.Sprintf("%.9f", metrics.CurrentStats.MaxCurrent), "A", sep))
+	sb.WriteString(TableRow("Average Current", fmt.Sprintf("%.9f", metrics.CurrentStats.AvgCurrent), "A", sep))
+	sb.WriteString(TableRow("Maximum Discharge Current", fmt.Sprintf("%.9f", metrics.CurrentStats.MaxDischarge), "A", sep))
+	sb.WriteString(TableRow("Maximum Charging Current", fmt.Sprintf("%.9f", metrics.CurrentStats.MaxCharging), "A", sep))
+	sb.WriteString(formatSpreadAsText("Current", metrics.CurrentStats.StdDev, metrics.CurrentStats.P25, metrics.CurrentStats.P50, metrics.CurrentStats.P75, metrics.CurrentStats.P95, metrics.CurrentStats.P99, percentiles, "%.9f", "A", sep))
+	sb.WriteString(formatPercentilesAsText("Current Percentiles", metrics.CurrentStats.ExactPercentiles, "%.9f", "A", sep))
+	sb.WriteString("\n")
+
+	sb.WriteString("CHANNEL CORRELATIONS\n")
+	sb.WriteString("--------------------\n")
+	sb.WriteString(TableRow("Voltage / Current", fmt.Sprintf("%.4f", metrics.Correlations.VoltageCurrent), "", sep))
+	sb.WriteString(TableRow("Voltage / Temperature", fmt.Sprintf("%.4f", metrics.Correlations.VoltageTemperature), "", sep))
+	sb.WriteString(TableRow("Current / Temperature", fmt.Sprintf("%.4f", metrics.Correlations.CurrentTemperature), "", sep))
+	sb.WriteString("\n")
+
+	if !options.NoBattery {
+		sb.WriteString("BATTERY STATISTICS\n")
+		sb.WriteString("------------------\n")
+		sb.WriteString(TableRow("Total Discharge Time", fmt.Sprintf("%.2f", metrics.BatteryStats.TotalDischargeTime), "seconds", sep))
+		sb.WriteString(TableRow("Total Charge Time", fmt.Sprintf("%.2f", metrics.BatteryStats.TotalChargeTime), "seconds", sep))
+		sb.WriteString(TableRow("Discharge to Charge Ratio", fmt.Sprintf("%.2f%%", metrics.BatteryStats.DischargeToChargeRatio*100), "", sep))
+		sb.WriteString(TableRow("Average Discharge Rate", fmt.Sprintf("%.4f", metrics.BatteryStats.AverageDischargeRate), "watts", sep))
+		sb.WriteString(formatPowerAsymmetryText(metrics.BatteryStats, sep))
+		sb.WriteString(formatCoulombCountingText(metrics.BatteryStats, sep))
+		sb.WriteString(TableRow("Discharge Cycles", fmt.Sprintf("%d", metrics.BatteryStats.CycleCount), "", sep))
+		sb.WriteString("\n")
+	}
+
+	if !options.NoSolar {
+		sb.WriteString("SOLAR CONTRIBUTION\n")
+		sb.WriteString("-----------------\n")
+		sb.WriteString(TableRow("Total Energy Produced", fmt.Sprintf("%.4f", metrics.SolarStats.TotalEnergyProduced), "joules", sep))
+		sb.WriteString(TableRow("Average Output", fmt.Sprintf("%.4f", metrics.SolarStats.AverageOutput), "watts", sep))
+		sb.WriteString(TableRow("Peak Output", fmt.Sprintf("%.4f", metrics.SolarStats.PeakOutput), "watts", sep))
+		sb.WriteString(TableRow("Contribution to Energy", fmt.Sprintf("%.2f%%", metrics.SolarStats.ContributionPercentage), "", sep))
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("EFFICIENCY\n")
+	sb.WriteString("----------\n")
+	sb.WriteString(formatEfficiencyAsText(metrics.EfficiencyStats, sep))
+	sb.WriteString("\n")
+
+	if cost := metrics.CostAnalysis; cost.RatePerKWh > 0 {
+		sb.WriteString("ENERGY COST\n")
+		sb.WriteString("-----------\n")
+		sb.WriteString(TableRow("Energy", fmt.Sprintf("%.9f", cost.EnergyKWh), "kWh", sep))
+		sb.WriteString(TableRow("Rate", fmt.Sprintf("%.6f", cost.RatePerKWh), cost.BaseCurrency+"/kWh", sep))
+		sb.WriteString(TableRow("Total Cost", fmt.Sprintf("%.6f", cost.TotalCostBase), cost.BaseCurrency, sep))
+		if cost.TargetCurrency != cost.BaseCurrency {
+			sb.WriteString(TableRow("Exchange Rate", fmt.Sprintf("%.6f", cost.ExchangeRate), cost.TargetCurrency+"/"+cost.BaseCurrency, sep))
+			sb.WriteString(TableRow("Total Cost Converted", fmt.Sprintf("%.6f", cost.TotalCostConverted), cost.TargetCurrency, sep))
+		}
+		sb.WriteString("\n")
+	}
 
 	sb.WriteString("HOURLY ENERGY CONSUMPTION\n")
 	sb.WriteString("------------------------\n")
@@ -752,18 +1949,386 @@ func generateReport(metrics metrics.EnergyMetrics, inputFile string) string {
 	if len(metrics.EnergyConsumptionByHour) > 0 {
 		for hour := 0; hour < 24; hour++ {
 			if joules, exists := metrics.EnergyConsumptionByHour[hour]; exists {
-				sb.WriteString(fmt.Sprintf("Hour %02d: %.4f joules\n", hour, joules))
+				sb.WriteString(TableRow(fmt.Sprintf("Hour %02d", hour), fmt.Sprintf("%.4f", joules), "joules", sep))
 			}
 		}
 	} else {
 		sb.WriteString("No hourly data available\n")
 	}
 
+	if len(metrics.PartialHoursExcluded) > 0 {
+		hours := make([]string, len(metrics.PartialHoursExcluded))
+		for i, hour := range metrics.PartialHoursExcluded {
+			hours[i] = fmt.Sprintf("%02d", hour)
+		}
+		sb.WriteString(fmt.Sprintf("Partial hours excluded: %s\n", strings.Join(hours, ", ")))
+	}
+
+	return sb.String()
+}
+
+// TableRow formats one label/value line of the text report. With an empty
+// separator it keeps the "Label: value unit" layout; otherwise the columns
+// are joined by sep so the output can be split with cut or awk.
+func TableRow(label, value, unit, sep string) string {
+	if sep == "" {
+		if unit == "" {
+			return fmt.Sprintf("%s: %s\n", label, value)
+		}
+		return fmt.Sprintf("%s: %s %s\n", label, value, unit)
+	}
+
+	if unit == "" {
+		return label + sep + value + "\n"
+	}
+	return label + sep + value + sep + unit + "\n"
+}
+
+// formatSpreadAsText renders the standard deviation and, unless percentiles
+// is false, the estimated P25/P50/P75/P95/P99 of a channel
+func formatSpreadAsText(label string, stdDev, p25, p50, p75, p95, p99 float64, percentiles bool, valueFormat, unit, sep string) string {
+	f := valueFormat
+	var sb strings.Builder
+	sb.WriteString(TableRow(label+" Std Deviation", fmt.Sprintf(f, stdDev), unit, sep))
+	if !percentiles {
+		return sb.String()
+	}
+	sb.WriteString(TableRow(label+" P25/P50/P75", fmt.Sprintf(f+" / "+f+" / "+f, p25, p50, p75), unit, sep))
+	sb.WriteString(TableRow(label+" P95/P99", fmt.Sprintf(f+" / "+f, p95, p99), unit, sep))
+	return sb.String()
+}
+
+// formatSpreadAsCSV renders the standard deviation and, unless percentiles
+// is false, the estimated P25/P50/P75/P95/P99 of a channel as
+// Measurement,Value rows
+func formatSpreadAsCSV(prefix string, stdDev, p25, p50, p75, p95, p99 float64, percentiles bool, valueFormat string) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%sStdDev,"+valueFormat+"\n", prefix, stdDev))
+	if !percentiles {
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf("%sP25,"+valueFormat+"\n", prefix, p25))
+	sb.WriteString(fmt.Sprintf("%sP50,"+valueFormat+"\n", prefix, p50))
+	sb.WriteString(fmt.Sprintf("%sP75,"+valueFormat+"\n", prefix, p75))
+	sb.WriteString(fmt.Sprintf("%sP95,"+valueFormat+"\n", prefix, p95))
+	sb.WriteString(fmt.Sprintf("%sP99,"+valueFormat+"\n", prefix, p99))
+	return sb.String()
+}
+
+// formatPercentilesAsText renders a percentile set on one line, or nothing if
+// percentiles were not computed
+func formatPercentilesAsText(label string, ps metrics.PercentileSet, valueFormat, unit, sep string) string {
+	if ps == (metrics.PercentileSet{}) {
+		return ""
+	}
+	f := valueFormat
+	value := fmt.Sprintf("P5="+f+" P25="+f+" P50="+f+" P75="+f+" P95="+f, ps.P5, ps.P25, ps.P50, ps.P75, ps.P95)
+	return TableRow(label, value, unit, sep)
+}
+
+// formatPercentilesAsCSV renders a percentile set as Measurement,Value rows,
+// or nothing if percentiles were not computed
+func formatPercentilesAsCSV(prefix string, ps metrics.PercentileSet, valueFormat string) string {
+	if ps == (metrics.PercentileSet{}) {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%sExactP5,"+valueFormat+"\n", prefix, ps.P5))
+	sb.WriteString(fmt.Sprintf("%sExactP25,"+valueFormat+"\n", prefix, ps.P25))
+	sb.WriteString(fmt.Sprintf("%sExactP50,"+valueFormat+"\n", prefix, ps.P50))
+	sb.WriteString(fmt.Sprintf("%sExactP75,"+valueFormat+"\n", prefix, ps.P75))
+	sb.WriteString(fmt.Sprintf("%sExactP95,"+valueFormat+"\n", prefix, ps.P95))
+	return sb.String()
+}
+
+// parseColumnMap parses --column-map, a comma-separated list of
+// header=column pairs
+func parseColumnMap(value string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		name, column, found := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid --column-map entry %q, expected header=column", pair)
+		}
+		mapping[name] = strings.TrimSpace(column)
+	}
+	return mapping, nil
+}
+
+// loadTimezone returns the location named by --timezone, UTC when empty
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", name, err)
+	}
+	return location, nil
+}
+
+// hasCalendarPeriod reports whether one of the --start-of-* flags is set
+func hasCalendarPeriod(cliOptions CommandLineOptions) bool {
+	return cliOptions.StartOfDay != "" || cliOptions.StartOfWeek != "" || cliOptions.StartOfMonth != ""
+}
+
+// calendarPeriod returns the [start, end) boundaries selected by the
+// --start-of-day, --start-of-week or --start-of-month flag, starting at
+// midnight in location. Weeks run from Monday to Sunday.
+func calendarPeriod(cliOptions CommandLineOptions, location *time.Location) (time.Time, time.Time, error) {
+	set := 0
+	for _, value := range []string{cliOptions.StartTime, cliOptions.StartOfDay, cliOptions.StartOfWeek, cliOptions.StartOfMonth} {
+		if value != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return time.Time{}, time.Time{}, fmt.Errorf("only one of --start, --start-of-day, --start-of-week and --start-of-month can be used")
+	}
+
+	switch {
+	case cliOptions.StartOfDay != "":
+		date, err := time.ParseInLocation("2006-01-02", cliOptions.StartOfDay, location)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --start-of-day date (format: YYYY-MM-DD): %w", err)
+		}
+		return date, date.AddDate(0, 0, 1), nil
+
+	case cliOptions.StartOfWeek != "":
+		date, err := time.ParseInLocation("2006-01-02", cliOptions.StartOfWeek, location)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --start-of-week date (format: YYYY-MM-DD): %w", err)
+		}
+		// time.Weekday counts from Sunday, shift it so Monday is day 0
+		daysSinceMonday := (int(date.Weekday()) + 6) % 7
+		start := date.AddDate(0, 0, -daysSinceMonday)
+		return start, start.AddDate(0, 0, 7), nil
+
+	default:
+		date, err := time.ParseInLocation("2006-01-02", cliOptions.StartOfMonth, location)
+		if err != nil {
+			date, err = time.ParseInLocation("2006-01", cliOptions.StartOfMonth, location)
+		}
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --start-of-month date (format: YYYY-MM or YYYY-MM-DD): %w", err)
+		}
+		start := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+		return start, start.AddDate(0, 1, 0), nil
+	}
+}
+
+// formatTempRateAsText renders the temperature rate of change rows
+func formatTempRateAsText(tempStats metrics.TemperatureStats, sep string) string {
+	var sb strings.Builder
+
+	risk := "no"
+	if tempStats.TempThermalRunawayRisk {
+		risk = "YES"
+	}
+
+	sb.WriteString(TableRow("Average Temperature Change", fmt.Sprintf("%.4f", tempStats.TempRateOfChangePerSec), "°C/s", sep))
+	sb.WriteString(TableRow("Peak Temperature Rise", fmt.Sprintf("%.4f", tempStats.TempRateOfChangePeakPerSec), "°C/s", sep))
+	sb.WriteString(TableRow("Thermal Runaway Risk", risk, "", sep))
+
+	return sb.String()
+}
+
+// hasCoulombCounting reports whether the state-of-charge fields were filled
+func hasCoulombCounting(batteryStats metrics.BatteryStats) bool {
+	return batteryStats.ConsumedCapacityAh != 0 || batteryStats.EstimatedSoCPercent != 0
+}
+
+// formatCoulombCountingText renders the state-of-charge estimate, or nothing
+// without --battery-capacity-ah
+func formatCoulombCountingText(batteryStats metrics.BatteryStats, sep string) string {
+	if !hasCoulombCounting(batteryStats) {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString(TableRow("Consumed Capacity", fmt.Sprintf("%.6f", batteryStats.ConsumedCapacityAh), "Ah", sep))
+	sb.WriteString(TableRow("Estimated State of Charge", fmt.Sprintf("%.2f%%", batteryStats.EstimatedSoCPercent), "", sep))
+	return sb.String()
+}
+
+// formatCoulombCountingAsCSV is the CSV counterpart of formatCoulombCountingText
+func formatCoulombCountingAsCSV(batteryStats metrics.BatteryStats) string {
+	if !hasCoulombCounting(batteryStats) {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("ConsumedCapacityAh,%.6f\n", batteryStats.ConsumedCapacityAh))
+	sb.WriteString(fmt.Sprintf("EstimatedSoCPercent,%.2f\n", batteryStats.EstimatedSoCPercent))
+	return sb.String()
+}
+
+// histogramBarWidth is the length of the longest bar of a text histogram
+const histogramBarWidth = 40
+
+// formatMetricHistogram renders the histogram belonging to metricType, if
+// it has one
+func formatMetricHistogram(energyMetrics metrics.EnergyMetrics, metricType metrics.MetricType, sep string) string {
+	switch metricType {
+	case metrics.MetricVoltageStats:
+		return formatHistogramAsText("Voltage Distribution", energyMetrics.VoltageHistogram, "%.6f", "V", sep)
+	case metrics.MetricCurrentStats:
+		return formatHistogramAsText("Current Distribution", energyMetrics.CurrentHistogram, "%.9f", "A", sep)
+	case metrics.MetricTemperature:
+		return formatHistogramAsText("Temperature Distribution", energyMetrics.TemperatureHistogram, "%.2f", "°C", sep)
+	}
+	return ""
+}
+
+// formatHistogramAsText draws an ASCII bar chart with one line per bucket.
+// With a field separator the bars are left out and each line holds the
+// bucket edges and count.
+func formatHistogramAsText(label string, histogram metrics.Histogram, valueFormat, unit, sep string) string {
+	if len(histogram.Counts) == 0 {
+		return ""
+	}
+
+	maxCount := 0
+	for _, count := range histogram.Counts {
+		if count > maxCount {
+			maxCount = count
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\n%s (%s):\n", label, unit))
+	for i, count := range histogram.Counts {
+		lower := fmt.Sprintf(valueFormat, histogram.Edges[i])
+		upper := fmt.Sprintf(valueFormat, histogram.Edges[i+1])
+		if sep != "" {
+			sb.WriteString(strings.Join([]string{lower, upper, fmt.Sprintf("%d", count)}, sep) + "\n")
+			continue
+		}
+
+		bar := 0
+		if maxCount > 0 {
+			bar = (count*histogramBarWidth + maxCount - 1) / maxCount
+		}
+		sb.WriteString(fmt.Sprintf("%14s - %-14s |%-*s %d\n", lower, upper, histogramBarWidth, strings.Repeat("#", bar), count))
+	}
+	return sb.String()
+}
+
+// formatCyclesAsText lists the charge/discharge segments one per line
+func formatCyclesAsText(cycles []metrics.CycleSegment, sep string) string {
+	if len(cycles) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\nCycles:\n")
+	for i, cycle := range cycles {
+		value := fmt.Sprintf("%s to %s, %.4f J, peak %.9f A",
+			cycle.StartTime.Format("2006-01-02 15:04:05"), cycle.EndTime.Format("2006-01-02 15:04:05"),
+			cycle.EnergyJoules, cycle.PeakCurrentA)
+		if sep != "" {
+			value = strings.Join([]string{
+				cycle.StartTime.Format(time.RFC3339), cycle.EndTime.Format(time.RFC3339),
+				fmt.Sprintf("%.4f", cycle.EnergyJoules), fmt.Sprintf("%.9f", cycle.PeakCurrentA),
+			}, sep)
+		}
+		sb.WriteString(TableRow(fmt.Sprintf("%d %s", i+1, cycle.CycleType), value, "", sep))
+	}
+	return sb.String()
+}
+
+// formatCyclesAsCSV renders the segments as a separate CSV table
+func formatCyclesAsCSV(cycles []metrics.CycleSegment) string {
+	if len(cycles) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\nCycle,CycleType,StartTime,EndTime,EnergyJoules,PeakCurrentA\n")
+	for i, cycle := range cycles {
+		sb.WriteString(fmt.Sprintf("%d,%s,%s,%s,%.6f,%.9f\n", i+1, cycle.CycleType,
+			cycle.StartTime.Format(time.RFC3339), cycle.EndTime.Format(time.RFC3339),
+			cycle.EnergyJoules, cycle.PeakCurrentA))
+	}
+	return sb.String()
+}
+
+// formatPeakEventsAsText lists the peak power events one per line
+func formatPeakEventsAsText(events []metrics.PowerEvent, thresholdW float64, sep string) string {
+	var sb strings.Builder
+	sb.WriteString(TableRow("Threshold", fmt.Sprintf("%.4f", thresholdW), "watts", sep))
+	sb.WriteString(TableRow("Events", fmt.Sprintf("%d", len(events)), "", sep))
+	for i, event := range events {
+		value := fmt.Sprintf("%s for %.3f s, peak %.4f W at %.6f V, %.9f A",
+			event.Timestamp.Format("2006-01-02 15:04:05.000"), float64(event.DurationMs)/1000.0,
+			event.PeakWatts, event.VoltageV, event.CurrentA)
+		if sep != "" {
+			value = strings.Join([]string{
+				event.Timestamp.Format(time.RFC3339Nano), fmt.Sprintf("%d", event.DurationMs),
+				fmt.Sprintf("%.4f", event.PeakWatts), fmt.Sprintf("%.6f", event.VoltageV), fmt.Sprintf("%.9f", event.CurrentA),
+			}, sep)
+		}
+		sb.WriteString(TableRow(fmt.Sprintf("Event %d", i+1), value, "", sep))
+	}
+	return sb.String()
+}
+
+// formatPeakEventsAsCSV renders the peak power events as a separate CSV table
+func formatPeakEventsAsCSV(events []metrics.PowerEvent) string {
+	if len(events) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\nPeakEvent,Timestamp,DurationMs,PeakWatts,VoltageV,CurrentA\n")
+	for i, event := range events {
+		sb.WriteString(fmt.Sprintf("%d,%s,%d,%.6f,%.6f,%.9f\n", i+1, event.Timestamp.Format(time.RFC3339Nano),
+			event.DurationMs, event.PeakWatts, event.VoltageV, event.CurrentA))
+	}
+	return sb.String()
+}
+
+// formatEfficiencyAsText renders the input and output energy of the
+// efficiency metric
+func formatEfficiencyAsText(efficiencyStats metrics.EfficiencyStats, sep string) string {
+	var sb strings.Builder
+	sb.WriteString(TableRow("Input Energy", fmt.Sprintf("%.4f", efficiencyStats.InputEnergyJ), "joules", sep))
+	sb.WriteString(TableRow("Output Energy", fmt.Sprintf("%.4f", efficiencyStats.OutputEnergyJ), "joules", sep))
+	sb.WriteString(TableRow("Efficiency", fmt.Sprintf("%.2f%%", efficiencyStats.EfficiencyPercent), "", sep))
+	sb.WriteString(TableRow("Losses", fmt.Sprintf("%.4f", efficiencyStats.LossesJ), "joules", sep))
+	return sb.String()
+}
+
+// formatEfficiencyAsCSV renders the efficiency metric as Measurement,Value
+// rows
+func formatEfficiencyAsCSV(efficiencyStats metrics.EfficiencyStats) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("InputEnergyJ,%.6f\n", efficiencyStats.InputEnergyJ))
+	sb.WriteString(fmt.Sprintf("OutputEnergyJ,%.6f\n", efficiencyStats.OutputEnergyJ))
+	sb.WriteString(fmt.Sprintf("EfficiencyPercent,%.2f\n", efficiencyStats.EfficiencyPercent))
+	sb.WriteString(fmt.Sprintf("LossesJ,%.6f\n", efficiencyStats.LossesJ))
+	return sb.String()
+}
+
+// formatPowerAsymmetryText renders the charge/discharge power comparison of
+// the battery section. A high ratio means the battery drains much faster than
+// it is refilled, as with a small solar panel behind a current limiter.
+func formatPowerAsymmetryText(batteryStats metrics.BatteryStats, sep string) string {
+	var sb strings.Builder
+
+	sb.WriteString(TableRow("Average Charge Power", fmt.Sprintf("%.4f", batteryStats.ChargePowerAvg), "watts", sep))
+	sb.WriteString(TableRow("Average Discharge Power", fmt.Sprintf("%.4f", batteryStats.DischargePowerAvg), "watts", sep))
+	if batteryStats.PowerAsymmetryRatio == 0 {
+		return sb.String()
+	}
+
+	sb.WriteString(TableRow("Power Asymmetry Ratio", fmt.Sprintf("%.2f", batteryStats.PowerAsymmetryRatio), "", sep))
+	if batteryStats.PowerAsymmetryRatio > 5 && sep == "" {
+		sb.WriteString("  Note: fast discharge with slow charging, typical of solar applications\n")
+	}
+
 	return sb.String()
 }
 
 // parseTimeString parses a time string in the format YYYY-MM-DD[THH:MM:SS]
-func parseTimeString(timeStr string) (time.Time, error) {
+// as a wall clock time in location
+func parseTimeString(timeStr string, location *time.Location) (time.Time, error) {
 	layouts := []string{
 		"2006-01-02T15:04:05",
 		"2006-01-02 15:04:05",
@@ -773,7 +2338,7 @@ func parseTimeString(timeStr string) (time.Time, error) {
 	}
 
 	for _, layout := range layouts {
-		if t, err := time.Parse(layout, timeStr); err == nil {
+		if t, err := time.ParseInLocation(layout, timeStr, location); err == nil {
 			return t, nil
 		}
 	}
@@ -0,0 +1,368 @@
+package commands
+
+import (
+	"enemeter-data-processing/pkg/metrics"
+	"enemeter-data-processing/pkg/parser"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	// The time zone tests must not depend on the system database
+	_ "time/tzdata"
+)
+
+// processOptions parses process command line arguments the way main does
+func processOptions(t *testing.T, args ...string) CommandLineOptions {
+	t.Helper()
+	cmd := SetupProcessCommand()
+	if err := cmd.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return ParseCommandLineOptions(cmd)
+}
+
+// captureStdout returns what f prints to standard output
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		output <- string(b)
+	}()
+
+	f()
+	w.Close()
+	return <-output
+}
+
+// writeInput writes rows as a CSV file in dir and returns its path
+func writeInput(t *testing.T, dir, name string, rows []string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(strings.Join(rows, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReportSections(t *testing.T) {
+	energyMetrics := metrics.EnergyMetrics{
+		DataPoints:   10,
+		BatteryStats: metrics.BatteryStats{TotalDischargeTime: 5},
+		SolarStats:   metrics.SolarStats{TotalEnergyProduced: 2},
+	}
+
+	tests := []struct {
+		name        string
+		options     CommandLineOptions
+		wantSolar   bool
+		wantBattery bool
+	}{
+		{"all sections", CommandLineOptions{}, true, true},
+		{"no solar", CommandLineOptions{NoSolar: true}, false, true},
+		{"no battery", CommandLineOptions{NoBattery: true}, true, false},
+		{"neither", CommandLineOptions{NoSolar: true, NoBattery: true}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := tt.options
+			text.Format = FormatText
+			report, err := generateOutput(energyMetrics, text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(report, "SOLAR CONTRIBUTION"); got != tt.wantSolar {
+				t.Errorf("text has solar section = %v, want %v", got, tt.wantSolar)
+			}
+			if got := strings.Contains(report, "BATTERY STATISTICS"); got != tt.wantBattery {
+				t.Errorf("text has battery section = %v, want %v", got, tt.wantBattery)
+			}
+
+			json := tt.options
+			json.Format = FormatJSON
+			report, err = generateOutput(energyMetrics, json)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(report, `"SolarStats"`); got != tt.wantSolar {
+				t.Errorf("JSON has SolarStats = %v, want %v", got, tt.wantSolar)
+			}
+			if got := strings.Contains(report, `"BatteryStats"`); got != tt.wantBattery {
+				t.Errorf("JSON has BatteryStats = %v, want %v", got, tt.wantBattery)
+			}
+		})
+	}
+}
+
+func TestTableRow(t *testing.T) {
+	tests := []struct {
+		label, value, unit, sep string
+		want                    string
+	}{
+		{"Peak Power", "1.5000", "watts", "", "Peak Power: 1.5000 watts\n"},
+		{"Crest Factor", "1.22", "", "", "Crest Factor: 1.22\n"},
+		{"Peak Power", "1.5000", "watts", "\t", "Peak Power\t1.5000\twatts\n"},
+		{"Crest Factor", "1.22", "", "\t", "Crest Factor\t1.22\n"},
+		{"Peak Power", "1.5000", "watts", "|", "Peak Power|1.5000|watts\n"},
+	}
+
+	for _, tt := range tests {
+		if got := TableRow(tt.label, tt.value, tt.unit, tt.sep); got != tt.want {
+			t.Errorf("TableRow(%q, %q, %q, %q) = %q, want %q", tt.label, tt.value, tt.unit, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestTabSeparatedReport(t *testing.T) {
+	energyMetrics := metrics.EnergyMetrics{
+		DataPoints:              10,
+		TotalJoules:             12.5,
+		EnergyConsumptionByHour: map[int]float64{10: 12.5},
+	}
+
+	report, err := generateOutput(energyMetrics, CommandLineOptions{Format: FormatText, FieldSep: "\t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := 0
+	for _, line := range strings.Split(report, "\n") {
+		if !strings.Contains(line, "\t") {
+			continue
+		}
+		rows++
+		// The unit, if any, follows the value after a second tab
+		label, rest, _ := strings.Cut(line, "\t")
+		value, _, _ := strings.Cut(rest, "\t")
+		if label == "" || value == "" || strings.TrimSpace(label) != label || strings.TrimSpace(value) != value {
+			t.Errorf("row %q is not label<TAB>value", line)
+		}
+		if n := strings.Count(line, "\t"); n > 2 {
+			t.Errorf("row %q has %d tabs", line, n)
+		}
+	}
+	if rows == 0 {
+		t.Fatal("report has no tab-separated rows")
+	}
+	if !strings.Contains(report, "Total Energy Consumed\t12.5000\tjoules\n") {
+		t.Errorf("report lacks the total energy row:\n%s", report)
+	}
+}
+
+func TestResampleOutput(t *testing.T) {
+	// Ten seconds of irregularly spaced records
+	rows := []string{"0,3650000,1500000,25000"}
+	for i := 0; i < 5; i++ {
+		rows = append(rows, "700,3700000,1000000,25000", "1300,3600000,2000000,25500")
+	}
+
+	tests := []struct {
+		interval    string
+		wantDeltaMs int64
+		wantRecords int
+	}{
+		{"100ms", 100, 100},
+		{"250ms", 250, 40},
+		{"1s", 1000, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.interval, func(t *testing.T) {
+			dir := t.TempDir()
+			input := writeInput(t, dir, "input.csv", rows)
+			resampled := filepath.Join(dir, "resampled.csv")
+
+			options := processOptions(t, "--input="+input, "--start=2024-01-01 12:00:00",
+				"--resample="+tt.interval, "--resample-output="+resampled, "--output="+filepath.Join(dir, "report.txt"))
+			if err := ProcessCommand(options); err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			records, err := parser.NewCSVParser(resampled).
+				WithFilterOptions(parser.FilterOptions{StartTime: &start}).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != tt.wantRecords {
+				t.Errorf("got %d records, want %d", len(records), tt.wantRecords)
+			}
+			for i, record := range records {
+				if record.TimeDeltaMs != tt.wantDeltaMs {
+					t.Fatalf("record %d has a delta of %d ms, want %d", i, record.TimeDeltaMs, tt.wantDeltaMs)
+				}
+			}
+		})
+	}
+}
+
+func TestCalendarPeriods(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantStart string
+		wantEnd   string
+		wantErr   bool
+	}{
+		{"day", []string{"--start-of-day=2024-01-15"}, "2024-01-15T00:00:00Z", "2024-01-16T00:00:00Z", false},
+		{"leap day", []string{"--start-of-day=2024-02-29"}, "2024-02-29T00:00:00Z", "2024-03-01T00:00:00Z", false},
+		{"last day of the year", []string{"--start-of-day=2023-12-31"}, "2023-12-31T00:00:00Z", "2024-01-01T00:00:00Z", false},
+		{"day with end", []string{"--start-of-day=2024-02-29", "--end=2024-02-29 12:00:00"}, "2024-02-29T00:00:00Z", "2024-02-29T12:00:00Z", false},
+		{"day across DST", []string{"--start-of-day=2024-03-31", "--timezone=Europe/Berlin"}, "2024-03-31T00:00:00+01:00", "2024-04-01T00:00:00+02:00", false},
+		{"week from Thursday", []string{"--start-of-week=2024-02-29"}, "2024-02-26T00:00:00Z", "2024-03-04T00:00:00Z", false},
+		{"week from Monday", []string{"--start-of-week=2024-02-26"}, "2024-02-26T00:00:00Z", "2024-03-04T00:00:00Z", false},
+		{"week from Sunday", []string{"--start-of-week=2024-03-03"}, "2024-02-26T00:00:00Z", "2024-03-04T00:00:00Z", false},
+		{"leap February", []string{"--start-of-month=2024-02"}, "2024-02-01T00:00:00Z", "2024-03-01T00:00:00Z", false},
+		{"February", []string{"--start-of-month=2023-02-15"}, "2023-02-01T00:00:00Z", "2023-03-01T00:00:00Z", false},
+		{"December", []string{"--start-of-month=2024-12"}, "2024-12-01T00:00:00Z", "2025-01-01T00:00:00Z", false},
+		{"two periods", []string{"--start-of-day=2024-01-15", "--start-of-month=2024-01"}, "", "", true},
+		{"period and start", []string{"--start-of-day=2024-01-15", "--start=2024-01-15 10:00:00"}, "", "", true},
+		{"invalid date", []string{"--start-of-day=2024-02-30"}, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filterOptions, err := buildFilterOptions(processOptions(t, tt.args...))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildFilterOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := filterOptions.StartTime.Format(time.RFC3339); got != tt.wantStart {
+				t.Errorf("start = %s, want %s", got, tt.wantStart)
+			}
+			if got := filterOptions.EndTime.Format(time.RFC3339); got != tt.wantEnd {
+				t.Errorf("end = %s, want %s", got, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestEpochStartTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{"without start", []string{"--no-timestamp-accumulation"}, false},
+		{"start is ignored", []string{"--no-timestamp-accumulation", "--start=2024-01-01 12:00:00"}, false},
+		{"calendar period", []string{"--no-timestamp-accumulation", "--start-of-day=2024-01-01"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filterOptions, err := buildFilterOptions(processOptions(t, tt.args...))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildFilterOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && filterOptions.StartTime != nil {
+				t.Errorf("start time = %v, want none", filterOptions.StartTime)
+			}
+		})
+	}
+}
+
+func TestVerboseRecordTables(t *testing.T) {
+	dir := t.TempDir()
+	input := writeInput(t, dir, "input.csv", []string{
+		"1000,3700000,-250000000,25000",
+		"1000,3650000,-500000000,25500",
+		"1500,3600000,100000000,26250",
+	})
+
+	want := "First record:\n" +
+		"  Timestamp    2024-01-01 12:00:01.000\n" +
+		"  Time Delta   1000 ms\n" +
+		"  Voltage      3.700000 V\n" +
+		"  Current      -0.250000000 A\n" +
+		"  Temperature  25.00 °C\n" +
+		"  Power        -0.925000 W\n" +
+		"Last record:\n" +
+		"  Timestamp    2024-01-01 12:00:03.500\n" +
+		"  Time Delta   1500 ms\n" +
+		"  Voltage      3.600000 V\n" +
+		"  Current      0.100000000 A\n" +
+		"  Temperature  26.25 °C\n" +
+		"  Power        0.360000 W\n"
+
+	for _, mode := range []string{"--stream=false", "--stream=true"} {
+		t.Run(mode, func(t *testing.T) {
+			options := processOptions(t, "--input="+input, "--start=2024-01-01 12:00:00", "--verbose", mode,
+				"--output="+filepath.Join(dir, "report.txt"))
+
+			var err error
+			output := captureStdout(t, func() { err = ProcessCommand(options) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(output, want) {
+				t.Errorf("output lacks the record tables:\n%s", output)
+			}
+		})
+	}
+}
+
+func TestReservoirSizeDisabled(t *testing.T) {
+	rows := []string{"0,3600000,1000000,25000"}
+	for i := 0; i < 20; i++ {
+		rows = append(rows, "1000,3700000,1000000,25000", "1000,3800000,-1000000,26000")
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		estimate string // present only with a reservoir
+		always   string // present either way
+	}{
+		{"text", []string{"--format=text"}, "Voltage P25/P50/P75", "Voltage Std Deviation"},
+		{"csv", []string{"--format=csv"}, "VoltageP50,", "VoltageStdDev,"},
+		{"json", []string{"--format=json"}, `"MedianVoltage"`, `"StdDev"`},
+		{"text metric", []string{"--format=text", "--metric=voltage_stats"}, "Voltage P95/P99", "Voltage Std Deviation"},
+		{"csv metric", []string{"--format=csv", "--metric=current_stats"}, "CurrentP99,", "CurrentStdDev,"},
+		{"json metric", []string{"--format=json", "--metric=temperature"}, `"P99"`, `"StdDev"`},
+	}
+
+	for _, tt := range tests {
+		for _, size := range []string{"0", "100"} {
+			t.Run(tt.name+" size "+size, func(t *testing.T) {
+				dir := t.TempDir()
+				output := filepath.Join(dir, "report")
+				args := append([]string{"--input=" + writeInput(t, dir, "input.csv", rows), "--start=2024-01-01 12:00:00",
+					"--reservoir-size=" + size, "--output=" + output}, tt.args...)
+				if err := ProcessCommand(processOptions(t, args...)); err != nil {
+					t.Fatal(err)
+				}
+				data, err := os.ReadFile(output)
+				if err != nil {
+					t.Fatal(err)
+				}
+				report := string(data)
+
+				if !strings.Contains(report, tt.always) {
+					t.Errorf("report lacks %q:\n%s", tt.always, report)
+				}
+				if want := size != "0"; strings.Contains(report, tt.estimate) != want {
+					t.Errorf("report contains %q: %v, want %v:\n%s", tt.estimate, !want, want, report)
+				}
+			})
+		}
+	}
+
+	input := writeInput(t, t.TempDir(), "input.csv", rows)
+	if err := ProcessCommand(processOptions(t, "--input="+input, "--start=2024-01-01 12:00:00", "--reservoir-size=-1")); err == nil || !strings.Contains(err.Error(), "reservoir-size") {
+		t.Errorf("--reservoir-size=-1 gave %v", err)
+	}
+}
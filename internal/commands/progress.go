@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// progressPrinter writes streaming progress lines. On a terminal each line
+// overwrites the previous one; when the output is redirected every update
+// goes on its own line so logs stay readable.
+type progressPrinter struct {
+	out      *os.File
+	terminal bool
+	printed  bool
+}
+
+func newProgressPrinter(out *os.File) *progressPrinter {
+	terminal := false
+	if info, err := out.Stat(); err == nil {
+		terminal = info.Mode()&os.ModeCharDevice != 0
+	}
+	return &progressPrinter{out: out, terminal: terminal}
+}
+
+// update has the signature of metrics.ProgressFunc
+func (p *progressPrinter) update(processed, estimated int) {
+	line := fmt.Sprintf("Processed %s records", formatCount(processed))
+	if estimated > 0 {
+		line = fmt.Sprintf("Processed %s / ~%s records (%.1f%%)",
+			formatCount(processed), formatCount(estimated), float64(processed)/float64(estimated)*100)
+	}
+
+	if p.terminal {
+		// Pad to clear leftovers of a longer previous line
+		fmt.Fprintf(p.out, "\r%-60s", line)
+	} else {
+		fmt.Fprintln(p.out, line)
+	}
+	p.printed = true
+}
+
+// finish ends the overwritten terminal line
+func (p *progressPrinter) finish() {
+	if p.terminal && p.printed {
+		fmt.Fprintln(p.out)
+	}
+}
+
+// formatCount formats n with thousands separators, e.g. 1,200,000
+func formatCount(n int) string {
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+	digits := strconv.Itoa(n)
+
+	var out []byte
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out = append(out, ',')
+		}
+		out = append(out, digits[i])
+	}
+	return string(out)
+}
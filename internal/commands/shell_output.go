@@ -0,0 +1,141 @@
+package commands
+
+import (
+	"enemeter-data-processing/pkg/metrics"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// generateShellOutput renders every scalar field of the metrics as an
+// "export NAME=value" line that can be eval'd by a POSIX shell. Field names
+// are converted to upper snake case below the prefix, nested structs add
+// their own name (without a "Stats" suffix) as another segment, e.g.
+// ENEMETER_TEMPERATURE_MIN_TEMP_CELSIUS. Maps are only emitted when
+// includeMaps is set, one variable per key.
+func generateShellOutput(energyMetrics metrics.EnergyMetrics, prefix string, includeMaps bool) (string, error) {
+	prefix = strings.ToUpper(prefix)
+	if !isShellIdentifier(prefix) {
+		return "", fmt.Errorf("invalid shell variable prefix: %q", prefix)
+	}
+
+	var sb strings.Builder
+	writeShellValue(&sb, prefix, reflect.ValueOf(energyMetrics), includeMaps)
+	return sb.String(), nil
+}
+
+// generateShellMetric renders a single metric the same way, named after the
+// metric type, e.g. ENEMETER_TOTAL_ENERGY or ENEMETER_TEMPERATURE_MIN_TEMP_CELSIUS
+func generateShellMetric(metric interface{}, metricType metrics.MetricType, prefix string, includeMaps bool) (string, error) {
+	prefix = strings.ToUpper(prefix)
+	if !isShellIdentifier(prefix) {
+		return "", fmt.Errorf("invalid shell variable prefix: %q", prefix)
+	}
+
+	var sb strings.Builder
+	writeShellValue(&sb, prefix+"_"+toUpperSnake(string(metricType)), reflect.ValueOf(metric), includeMaps)
+	return sb.String(), nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func writeShellValue(sb *strings.Builder, name string, v reflect.Value, includeMaps bool) {
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == timeType {
+			writeShellExport(sb, name, shellQuote(v.Interface().(time.Time).Format(time.RFC3339)))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() || field.Tag.Get("json") == "-" {
+				continue
+			}
+			fieldName := field.Name
+			if field.Type.Kind() == reflect.Struct && field.Type != timeType {
+				fieldName = strings.TrimSuffix(fieldName, "Stats")
+			}
+			writeShellValue(sb, name+"_"+toUpperSnake(fieldName), v.Field(i), includeMaps)
+		}
+
+	case reflect.Map:
+		if !includeMaps {
+			return
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].CanInt() {
+				return keys[i].Int() < keys[j].Int()
+			}
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			keyName := toUpperSnake(fmt.Sprint(key.Interface()))
+			writeShellValue(sb, name+"_"+keyName, v.MapIndex(key), includeMaps)
+		}
+
+	case reflect.Float32, reflect.Float64:
+		writeShellExport(sb, name, strconv.FormatFloat(v.Float(), 'f', -1, 64))
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeShellExport(sb, name, strconv.FormatInt(v.Int(), 10))
+
+	case reflect.Bool:
+		writeShellExport(sb, name, strconv.FormatBool(v.Bool()))
+
+	case reflect.String:
+		writeShellExport(sb, name, shellQuote(v.String()))
+	}
+}
+
+func writeShellExport(sb *strings.Builder, name, value string) {
+	sb.WriteString("export ")
+	sb.WriteString(name)
+	sb.WriteString("=")
+	sb.WriteString(value)
+	sb.WriteString("\n")
+}
+
+// shellQuote wraps s in single quotes so the shell takes it literally
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// toUpperSnake converts a CamelCase identifier to UPPER_SNAKE_CASE, keeping
+// runs of capitals such as "KWh" or "ID" together where possible
+func toUpperSnake(s string) string {
+	runes := []rune(s)
+	var sb strings.Builder
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				sb.WriteRune('_')
+			}
+		}
+		if r == '-' || r == ' ' || r == ':' {
+			r = '_'
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+
+	return sb.String()
+}
+
+func isShellIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if r != '_' && !(r >= 'A' && r <= 'Z') && !(i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
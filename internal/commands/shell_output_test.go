@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"enemeter-data-processing/pkg/metrics"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestShellOutputIsSourceable(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available")
+	}
+
+	energyMetrics := metrics.EnergyMetrics{
+		TotalJoules:             1234.5678,
+		DataQuality:             "it's \"fair\"",
+		TemperatureStats:        metrics.TemperatureStats{MinTempCelsius: 22.5},
+		EnergyConsumptionByHour: map[int]float64{10: 12.5},
+	}
+
+	tests := []struct {
+		name        string
+		prefix      string
+		includeMaps bool
+		script      string
+		want        string
+	}{
+		{"scalars", "ENEMETER", false, `echo "$ENEMETER_TOTAL_JOULES|$ENEMETER_TEMPERATURE_MIN_TEMP_CELSIUS"`, "1234.5678|22.5"},
+		{"quoted string", "ENEMETER", false, `echo "$ENEMETER_DATA_QUALITY"`, `it's "fair"`},
+		{"custom prefix", "em", false, `echo "$EM_TOTAL_JOULES"`, "1234.5678"},
+		{"maps skipped", "ENEMETER", false, `echo "${ENEMETER_ENERGY_CONSUMPTION_BY_HOUR_10-unset}"`, "unset"},
+		{"maps included", "ENEMETER", true, `echo "$ENEMETER_ENERGY_CONSUMPTION_BY_HOUR_10"`, "12.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := generateShellOutput(energyMetrics, tt.prefix, tt.includeMaps)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(bash, "-c", `eval "$(cat)" && `+tt.script)
+			cmd.Stdin = strings.NewReader(output)
+			got, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("bash failed: %v\n%s", err, got)
+			}
+			if strings.TrimSpace(string(got)) != tt.want {
+				t.Errorf("got %q, want %q", strings.TrimSpace(string(got)), tt.want)
+			}
+		})
+	}
+}
+
+func TestShellOutputInvalidPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "1ENEMETER", "ENE-METER", "A B"} {
+		if _, err := generateShellOutput(metrics.EnergyMetrics{}, prefix, false); err == nil {
+			t.Errorf("prefix %q was accepted", prefix)
+		}
+	}
+}
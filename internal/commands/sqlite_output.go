@@ -0,0 +1,261 @@
+package commands
+
+import (
+	"database/sql"
+	"enemeter-data-processing/pkg/metrics"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the report tables. Every table but runs holds one
+// section of the report, tied to its run by run_id.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS runs (
+		run_id                  TEXT PRIMARY KEY,
+		created_at              TEXT NOT NULL,
+		input_files             TEXT NOT NULL,
+		start_time              TEXT NOT NULL,
+		end_time                TEXT NOT NULL,
+		data_points             INTEGER,
+		sampling_method         TEXT,
+		total_joules            REAL,
+		average_power_watts     REAL,
+		peak_power_watts        REAL,
+		joules_per_day          REAL,
+		duration_seconds        REAL,
+		data_completeness_score REAL,
+		data_quality            TEXT,
+		UNIQUE (input_files, start_time, end_time)
+	)`,
+	`CREATE TABLE IF NOT EXISTS temperature_stats (
+		run_id           TEXT PRIMARY KEY REFERENCES runs (run_id),
+		min_temp_celsius REAL,
+		max_temp_celsius REAL,
+		avg_temp_celsius REAL,
+		std_dev          REAL,
+		p50              REAL,
+		p95              REAL,
+		p99              REAL
+	)`,
+	`CREATE TABLE IF NOT EXISTS voltage_stats (
+		run_id      TEXT PRIMARY KEY REFERENCES runs (run_id),
+		min_voltage REAL,
+		max_voltage REAL,
+		avg_voltage REAL,
+		std_dev     REAL,
+		p50         REAL,
+		p95         REAL,
+		p99         REAL
+	)`,
+	`CREATE TABLE IF NOT EXISTS current_stats (
+		run_id        TEXT PRIMARY KEY REFERENCES runs (run_id),
+		min_current   REAL,
+		max_current   REAL,
+		avg_current   REAL,
+		max_discharge REAL,
+		max_charging  REAL,
+		std_dev       REAL,
+		p50           REAL,
+		p95           REAL,
+		p99           REAL
+	)`,
+	`CREATE TABLE IF NOT EXISTS battery_stats (
+		run_id                    TEXT PRIMARY KEY REFERENCES runs (run_id),
+		total_discharge_time      REAL,
+		total_charge_time         REAL,
+		discharge_to_charge_ratio REAL,
+		average_discharge_rate    REAL,
+		charge_power_avg          REAL,
+		discharge_power_avg       REAL,
+		cycle_count               INTEGER
+	)`,
+	`CREATE TABLE IF NOT EXISTS solar_stats (
+		run_id                  TEXT PRIMARY KEY REFERENCES runs (run_id),
+		total_energy_produced   REAL,
+		average_output          REAL,
+		peak_output             REAL,
+		contribution_percentage REAL
+	)`,
+	`CREATE TABLE IF NOT EXISTS energy_by_hour (
+		run_id TEXT NOT NULL REFERENCES runs (run_id),
+		hour   INTEGER NOT NULL,
+		joules REAL,
+		PRIMARY KEY (run_id, hour)
+	)`,
+}
+
+// sqliteInsert is one row to write for a run
+type sqliteInsert struct {
+	table string
+	query string
+	args  []interface{}
+}
+
+// sqliteChildTables lists the tables whose rows belong to a run
+var sqliteChildTables = []string{
+	"temperature_stats", "voltage_stats", "current_stats",
+	"battery_stats", "solar_stats", "energy_by_hour",
+}
+
+// writeSQLiteReport stores the report in the SQLite database at path,
+// creating it if needed. A previous run over the same input files and time
+// range is replaced. It returns the new run ID.
+func writeSQLiteReport(path string, energyMetrics metrics.EnergyMetrics, options CommandLineOptions) (string, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open database: %w", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			log.Printf("Warning: Error closing database: %v", closeErr)
+		}
+	}()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to start transaction: %w", err)
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer func() { _ = tx.Rollback() }()
+
+	for _, statement := range sqliteSchema {
+		if _, err := tx.Exec(statement); err != nil {
+			return "", fmt.Errorf("failed to create tables: %w", err)
+		}
+	}
+
+	inputFiles := sqliteInputFiles(options.InputFiles)
+	startTime := energyMetrics.TimeRange.StartTime.UTC().Format(time.RFC3339Nano)
+	endTime := energyMetrics.TimeRange.EndTime.UTC().Format(time.RFC3339Nano)
+
+	if err := deleteSQLiteRuns(tx, inputFiles, startTime, endTime); err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	runID := now.Format("20060102T150405.000000000Z")
+
+	// The percentile columns stay NULL when the estimates are disabled
+	estimate := func(value float64) interface{} {
+		if options.ReservoirSize == 0 {
+			return nil
+		}
+		return value
+	}
+
+	inserts := []sqliteInsert{
+		{"runs", `INSERT INTO runs VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, []interface{}{
+			runID, now.Format(time.RFC3339), inputFiles, startTime, endTime,
+			energyMetrics.DataPoints, energyMetrics.SamplingMethod,
+			energyMetrics.TotalJoules, energyMetrics.AveragePowerWatts, energyMetrics.PeakPowerWatts,
+			energyMetrics.JoulesPerDay, energyMetrics.DurationSeconds,
+			energyMetrics.DataCompletenessScore, energyMetrics.DataQuality,
+		}},
+		{"temperature_stats", `INSERT INTO temperature_stats VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, []interface{}{
+			runID, energyMetrics.TemperatureStats.MinTempCelsius, energyMetrics.TemperatureStats.MaxTempCelsius,
+			energyMetrics.TemperatureStats.AvgTempCelsius, energyMetrics.TemperatureStats.StdDev,
+			estimate(energyMetrics.TemperatureStats.P50), estimate(energyMetrics.TemperatureStats.P95), estimate(energyMetrics.TemperatureStats.P99),
+		}},
+		{"voltage_stats", `INSERT INTO voltage_stats VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, []interface{}{
+			runID, energyMetrics.VoltageStats.MinVoltage, energyMetrics.VoltageStats.MaxVoltage,
+			energyMetrics.VoltageStats.AvgVoltage, energyMetrics.VoltageStats.StdDev,
+			estimate(energyMetrics.VoltageStats.P50), estimate(energyMetrics.VoltageStats.P95), estimate(energyMetrics.VoltageStats.P99),
+		}},
+		{"current_stats", `INSERT INTO current_stats VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, []interface{}{
+			runID, energyMetrics.CurrentStats.MinCurrent, energyMetrics.CurrentStats.MaxCurrent,
+			energyMetrics.CurrentStats.AvgCurrent, energyMetrics.CurrentStats.MaxDischarge,
+			energyMetrics.CurrentStats.MaxCharging, energyMetrics.CurrentStats.StdDev,
+			estimate(energyMetrics.CurrentStats.P50), estimate(energyMetrics.CurrentStats.P95), estimate(energyMetrics.CurrentStats.P99),
+		}},
+	}
+
+	if !options.NoBattery {
+		battery := energyMetrics.BatteryStats
+		inserts = append(inserts, sqliteInsert{"battery_stats", `INSERT INTO battery_stats VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, []interface{}{
+			runID, battery.TotalDischargeTime, battery.TotalChargeTime, battery.DischargeToChargeRatio,
+			battery.AverageDischargeRate, battery.ChargePowerAvg, battery.DischargePowerAvg, battery.CycleCount,
+		}})
+	}
+
+	if !options.NoSolar {
+		solar := energyMetrics.SolarStats
+		inserts = append(inserts, sqliteInsert{"solar_stats", `INSERT INTO solar_stats VALUES (?, ?, ?, ?, ?)`, []interface{}{
+			runID, solar.TotalEnergyProduced, solar.AverageOutput, solar.PeakOutput, solar.ContributionPercentage,
+		}})
+	}
+
+	for _, insert := range inserts {
+		if _, err := tx.Exec(insert.query, insert.args...); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", insert.table, err)
+		}
+	}
+
+	for hour := 0; hour < 24; hour++ {
+		joules, exists := energyMetrics.EnergyConsumptionByHour[hour]
+		if !exists {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO energy_by_hour VALUES (?, ?, ?)`, runID, hour, joules); err != nil {
+			return "", fmt.Errorf("failed to write energy_by_hour: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit report: %w", err)
+	}
+	return runID, nil
+}
+
+// deleteSQLiteRuns removes earlier runs over the same data with their rows
+func deleteSQLiteRuns(tx *sql.Tx, inputFiles, startTime, endTime string) error {
+	rows, err := tx.Query(`SELECT run_id FROM runs WHERE input_files = ? AND start_time = ? AND end_time = ?`,
+		inputFiles, startTime, endTime)
+	if err != nil {
+		return fmt.Errorf("failed to look up previous runs: %w", err)
+	}
+	var runIDs []string
+	for rows.Next() {
+		var runID string
+		if err := rows.Scan(&runID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to look up previous runs: %w", err)
+		}
+		runIDs = append(runIDs, runID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to look up previous runs: %w", err)
+	}
+
+	for _, runID := range runIDs {
+		for _, table := range append(sqliteChildTables, "runs") {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE run_id = ?", runID); err != nil {
+				return fmt.Errorf("failed to replace previous run %s: %w", runID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sqliteInputFiles identifies the input by its absolute paths, so that the
+// same files given relative to another directory still match
+func sqliteInputFiles(inputFiles []string) string {
+	paths := make([]string, len(inputFiles))
+	for i, inputFile := range inputFiles {
+		if inputFile == stdinInput {
+			paths[i] = inputFile
+			continue
+		}
+		path, err := filepath.Abs(inputFile)
+		if err != nil {
+			path = inputFile
+		}
+		paths[i] = path
+	}
+	return strings.Join(paths, ",")
+}
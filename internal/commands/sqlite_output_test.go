@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"database/sql"
+	"enemeter-data-processing/pkg/metrics"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteReportReplacesRun(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.db")
+	input := writeInput(t, dir, "input.csv", []string{"1000,3700000,1000000,25000"})
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	relative, err := filepath.Rel(wd, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	report := func(end time.Time) metrics.EnergyMetrics {
+		return metrics.EnergyMetrics{
+			DataPoints:              10,
+			TotalJoules:             100,
+			TimeRange:               metrics.TimeRange{StartTime: start, EndTime: end},
+			EnergyConsumptionByHour: map[int]float64{10: 60, 11: 40},
+		}
+	}
+	later := start.Add(2 * time.Hour)
+
+	tests := []struct {
+		name     string
+		input    string
+		end      time.Time
+		wantRuns int
+	}{
+		{"first run", input, later, 1},
+		{"same input and range", input, later, 1},
+		{"same input given relative", relative, later, 1},
+		{"other range", input, later.Add(time.Hour), 2},
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	count := func(table string) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runID, err := writeSQLiteReport(path, report(tt.end), CommandLineOptions{InputFiles: []string{tt.input}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := count("runs"); got != tt.wantRuns {
+				t.Errorf("%d runs, want %d", got, tt.wantRuns)
+			}
+			for _, table := range sqliteChildTables {
+				want := tt.wantRuns
+				if table == "energy_by_hour" {
+					want *= 2
+				}
+				if got := count(table); got != want {
+					t.Errorf("%d rows in %s, want %d", got, table, want)
+				}
+			}
+
+			var latest string
+			if err := db.QueryRow("SELECT run_id FROM runs WHERE end_time = ?", tt.end.Format(time.RFC3339Nano)).Scan(&latest); err != nil {
+				t.Fatal(err)
+			}
+			if latest != runID {
+				t.Errorf("run %s is stored, want %s", latest, runID)
+			}
+		})
+	}
+}
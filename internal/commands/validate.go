@@ -0,0 +1,391 @@
+package commands
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"enemeter-data-processing/pkg/parser"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Exit codes of the validate command. A validation that could not run,
+// because of invalid options or an input that cannot be read, exits with
+// ValidationFailedExitCode so that it is not taken for warnings.
+const (
+	ValidationWarningExitCode = 1
+	ValidationErrorExitCode   = 2
+	ValidationFailedExitCode  = 3
+)
+
+// Plausible temperature range of the sensor in °C
+const (
+	minValidTempC = -40.0
+	maxValidTempC = 125.0
+)
+
+// Validation statuses of a ValidationReport
+const (
+	ValidationOK       = "ok"
+	ValidationWarnings = "warnings"
+	ValidationErrors   = "errors"
+)
+
+// ValidateOptions holds the options of the validate command
+type ValidateOptions struct {
+	InputFile       string
+	Compressed      bool
+	EpochTimestamps bool
+	Format          OutputFormat
+	OutputFile      string
+
+	MinValidV float64
+	MaxValidV float64
+	MaxGapMs  int64 // 0 = no gap check
+}
+
+// ValidationReport lists the data quality issues found in a CSV file.
+// Malformed rows, non-numeric values and negative time deltas are errors;
+// implausible readings and gaps are warnings.
+type ValidationReport struct {
+	File      string `json:"file"`
+	Rows      int    `json:"rows"` // data rows, without a header row
+	HeaderRow bool   `json:"header_row"`
+
+	WrongColumnCount   int            `json:"wrong_column_count"`
+	NonNumeric         map[string]int `json:"non_numeric"` // by CSVHeader column
+	NegativeTimeDeltas int            `json:"negative_time_deltas"`
+
+	VoltageOutOfRange     int   `json:"voltage_out_of_range"`
+	TemperatureOutOfRange int   `json:"temperature_out_of_range"`
+	Gaps                  int   `json:"gaps"`
+	LongestGapMs          int64 `json:"longest_gap_ms"`
+
+	MinValidV float64 `json:"min_valid_v"`
+	MaxValidV float64 `json:"max_valid_v"`
+	MaxGapMs  int64   `json:"max_gap_ms"`
+
+	Errors   int    `json:"errors"`
+	Warnings int    `json:"warnings"`
+	Status   string `json:"status"` // ValidationOK, ValidationWarnings or ValidationErrors
+}
+
+// ValidationError is returned by ValidateCommand after the report has been
+// written when the file has issues
+type ValidationError struct {
+	Errors   int
+	Warnings int
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("validation found %d error(s) and %d warning(s)", e.Errors, e.Warnings)
+}
+
+// ExitCode returns ValidationErrorExitCode when there were errors and
+// ValidationWarningExitCode for warnings only
+func (e *ValidationError) ExitCode() int {
+	if e.Errors > 0 {
+		return ValidationErrorExitCode
+	}
+	return ValidationWarningExitCode
+}
+
+// ValidateExitCode returns the exit code of the validate command for the
+// error returned by ValidateCommand
+func ValidateExitCode(err error) int {
+	var validationErr *ValidationError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &validationErr):
+		return validationErr.ExitCode()
+	default:
+		return ValidationFailedExitCode
+	}
+}
+
+// SetupValidateCommand configures the validate command with all its flags.
+// Invalid flags are returned by Parse instead of exiting, so that they can
+// exit with ValidationFailedExitCode.
+func SetupValidateCommand() *flag.FlagSet {
+	validateCmd := flag.NewFlagSet("validate", flag.ContinueOnError)
+
+	validateCmd.String("input", "", "Path to the CSV file to check (.gz files are decompressed automatically) - REQUIRED")
+	validateCmd.Bool("compressed", false, "Force gzip decompression of the input")
+	validateCmd.Bool("no-timestamp-accumulation", false, "Treat the first column as absolute milliseconds since the Unix epoch instead of a time delta")
+	validateCmd.String("format", "text", "Output format: text or json")
+	validateCmd.String("output", "", "Path to save the validation report (optional)")
+	validateCmd.Float64("min-valid-v", 0, "Lowest plausible voltage in volts")
+	validateCmd.Float64("max-valid-v", 60, "Highest plausible voltage in volts")
+	validateCmd.Int64("max-gap-ms", 60000, "Report time deltas above this many milliseconds as gaps (0 = no gap check)")
+
+	validateCmd.Usage = func() {
+		fmt.Println(AppName + " - Check an ENEMETER CSV file for data quality issues")
+		fmt.Println("\nUsage:")
+		fmt.Println("  enemeter-data-processing validate [options]")
+		fmt.Println("\nExamples:")
+		fmt.Println("  Audit a capture before archiving it")
+		fmt.Println("  enemeter-data-processing validate --input=data.csv")
+		fmt.Println("\n  Check a 3.3V rail and write a JSON report")
+		fmt.Println("  enemeter-data-processing validate --input=data.csv --min-valid-v=3.0 --max-valid-v=3.6 --format=json --output=report.json")
+		fmt.Println("\nThe exit code is 0 without issues, 1 for warnings only, 2 for errors and 3 when the file could not be validated.")
+		fmt.Println("\nOptions:")
+		validateCmd.PrintDefaults()
+	}
+
+	return validateCmd
+}
+
+// ParseValidateOptions parses command line flags into a structured options object
+func ParseValidateOptions(cmd *flag.FlagSet) ValidateOptions {
+	return ValidateOptions{
+		InputFile:       cmd.Lookup("input").Value.String(),
+		Compressed:      cmd.Lookup("compressed").Value.(flag.Getter).Get().(bool),
+		EpochTimestamps: cmd.Lookup("no-timestamp-accumulation").Value.(flag.Getter).Get().(bool),
+		Format:          OutputFormat(strings.ToLower(cmd.Lookup("format").Value.String())),
+		OutputFile:      cmd.Lookup("output").Value.String(),
+		MinValidV:       cmd.Lookup("min-valid-v").Value.(flag.Getter).Get().(float64),
+		MaxValidV:       cmd.Lookup("max-valid-v").Value.(flag.Getter).Get().(float64),
+		MaxGapMs:        cmd.Lookup("max-gap-ms").Value.(flag.Getter).Get().(int64),
+	}
+}
+
+// ValidateCommand scans a CSV file row by row without calculating metrics
+// and reports its data quality issues. It returns a ValidationError when
+// any were found.
+func ValidateCommand(options ValidateOptions) error {
+	if options.InputFile == "" {
+		return fmt.Errorf("input file is required (--input)")
+	}
+	if parser.DetectFormat(options.InputFile) != parser.FormatCSV {
+		return fmt.Errorf("validate only supports CSV input")
+	}
+	if options.Format != FormatText && options.Format != FormatJSON {
+		return fmt.Errorf("unsupported validate format: %s (use text or json)", options.Format)
+	}
+	if options.MinValidV >= options.MaxValidV {
+		return fmt.Errorf("--min-valid-v must be below --max-valid-v")
+	}
+	if options.MaxGapMs < 0 {
+		return fmt.Errorf("--max-gap-ms must not be negative")
+	}
+
+	input, err := openValidateInput(options)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	fmt.Printf("Validating %s...\n", options.InputFile)
+	report, err := validateCSV(input, options)
+	if err != nil {
+		return err
+	}
+	report.File = options.InputFile
+
+	var output string
+	if options.Format == FormatJSON {
+		jsonData, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		output = string(jsonData)
+	} else {
+		output = generateValidationReport(report)
+	}
+
+	if options.OutputFile == "" {
+		fmt.Println(output)
+	} else {
+		if err := os.WriteFile(options.OutputFile, []byte(output), 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %v", err)
+		}
+		fmt.Printf("Results saved to %s\n", options.OutputFile)
+	}
+
+	if report.Status != ValidationOK {
+		return &ValidationError{Errors: report.Errors, Warnings: report.Warnings}
+	}
+	return nil
+}
+
+// openValidateInput opens the input file, decompressing .gz files
+func openValidateInput(options ValidateOptions) (io.ReadCloser, error) {
+	file, err := os.Open(options.InputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	if !options.Compressed && !strings.HasSuffix(strings.ToLower(options.InputFile), ".gz") {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, file}, nil
+}
+
+// validateCSV checks every row of a CSV input. It reads the rows itself
+// rather than through CSVParser.StreamRecords, which stops at the first
+// malformed row and drops the rows that are counted here. A first row
+// without any numeric field is taken as a header; the columns are expected
+// in CSVHeader order.
+func validateCSV(input io.Reader, options ValidateOptions) (ValidationReport, error) {
+	report := ValidationReport{
+		NonNumeric: make(map[string]int, len(parser.CSVHeader)),
+		MinValidV:  options.MinValidV,
+		MaxValidV:  options.MaxValidV,
+		MaxGapMs:   options.MaxGapMs,
+	}
+	for _, column := range parser.CSVHeader {
+		report.NonNumeric[column] = 0
+	}
+
+	reader := csv.NewReader(parser.CRLFStrip(input))
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	values := make([]int64, len(parser.CSVHeader))
+	prevEpochMs := int64(-1)
+	firstRow := true
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return report, fmt.Errorf("error reading CSV row: %w", err)
+			}
+			// A quoting error spoils the row, not the rest of the file
+			report.Rows++
+			report.WrongColumnCount++
+			firstRow = false
+			continue
+		}
+
+		if firstRow {
+			firstRow = false
+			if isTextRow(row) {
+				report.HeaderRow = true
+				continue
+			}
+		}
+		report.Rows++
+
+		if len(row) != len(parser.CSVHeader) {
+			report.WrongColumnCount++
+			continue
+		}
+
+		numeric := true
+		for i, field := range row {
+			value, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+			if err != nil {
+				report.NonNumeric[parser.CSVHeader[i]]++
+				numeric = false
+				continue
+			}
+			values[i] = value
+		}
+		if !numeric {
+			continue
+		}
+
+		deltaMs := values[0]
+		if options.EpochTimestamps {
+			deltaMs = 0
+			if prevEpochMs >= 0 {
+				deltaMs = values[0] - prevEpochMs
+			}
+			prevEpochMs = values[0]
+		}
+		if deltaMs < 0 {
+			report.NegativeTimeDeltas++
+		}
+		if options.MaxGapMs > 0 && deltaMs > options.MaxGapMs {
+			report.Gaps++
+			report.LongestGapMs = max(report.LongestGapMs, deltaMs)
+		}
+
+		voltage := float64(values[1]) / 1_000_000
+		if voltage < options.MinValidV || voltage > options.MaxValidV {
+			report.VoltageOutOfRange++
+		}
+
+		tempC := float64(values[3]) / 1000
+		if tempC < minValidTempC || tempC > maxValidTempC {
+			report.TemperatureOutOfRange++
+		}
+	}
+
+	report.Errors = report.WrongColumnCount + report.NegativeTimeDeltas
+	for _, count := range report.NonNumeric {
+		report.Errors += count
+	}
+	report.Warnings = report.VoltageOutOfRange + report.TemperatureOutOfRange + report.Gaps
+
+	switch {
+	case report.Errors > 0:
+		report.Status = ValidationErrors
+	case report.Warnings > 0:
+		report.Status = ValidationWarnings
+	default:
+		report.Status = ValidationOK
+	}
+	return report, nil
+}
+
+// isTextRow reports whether no field of a row is an integer, as in a header
+func isTextRow(row []string) bool {
+	for _, field := range row {
+		if _, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// generateValidationReport renders the issue counts as text
+func generateValidationReport(report ValidationReport) string {
+	var sb strings.Builder
+
+	sb.WriteString("========== ENEMETER VALIDATION REPORT ==========\n")
+	sb.WriteString(fmt.Sprintf("File: %s\n", report.File))
+	sb.WriteString(fmt.Sprintf("Rows: %d\n", report.Rows))
+	if report.HeaderRow {
+		sb.WriteString("Header Row: yes\n")
+	}
+
+	sb.WriteString("\nERRORS\n------\n")
+	sb.WriteString(fmt.Sprintf("Wrong Column Count: %d\n", report.WrongColumnCount))
+	for _, column := range parser.CSVHeader {
+		sb.WriteString(fmt.Sprintf("Non-numeric %s: %d\n", column, report.NonNumeric[column]))
+	}
+	sb.WriteString(fmt.Sprintf("Negative Time Deltas: %d\n", report.NegativeTimeDeltas))
+
+	sb.WriteString("\nWARNINGS\n--------\n")
+	sb.WriteString(fmt.Sprintf("Voltage Outside %.3f-%.3f V: %d\n", report.MinValidV, report.MaxValidV, report.VoltageOutOfRange))
+	sb.WriteString(fmt.Sprintf("Temperature Outside %.0f-%.0f °C: %d\n", minValidTempC, maxValidTempC, report.TemperatureOutOfRange))
+	if report.MaxGapMs > 0 {
+		sb.WriteString(fmt.Sprintf("Gaps Over %d ms: %d\n", report.MaxGapMs, report.Gaps))
+		if report.Gaps > 0 {
+			sb.WriteString(fmt.Sprintf("Longest Gap: %d ms\n", report.LongestGapMs))
+		}
+	}
+
+	sb.WriteString(fmt.Sprintf("\nStatus: %s (%d errors, %d warnings)\n", strings.ToUpper(report.Status), report.Errors, report.Warnings))
+	return sb.String()
+}
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateExitCode(t *testing.T) {
+	dir := t.TempDir()
+	clean := writeInput(t, dir, "clean.csv", []string{"1000,3700000,1000000,25000", "1000,3700000,1000000,25000"})
+	gap := writeInput(t, dir, "gap.csv", []string{"1000,3700000,1000000,25000", "90000,3700000,1000000,25000"})
+	negative := writeInput(t, dir, "negative.csv", []string{"1000,3700000,1000000,25000", "-1000,3700000,1000000,25000"})
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"clean", []string{"--input=" + clean}, 0},
+		{"warnings", []string{"--input=" + gap}, ValidationWarningExitCode},
+		{"errors", []string{"--input=" + negative}, ValidationErrorExitCode},
+		{"missing file", []string{"--input=" + filepath.Join(dir, "missing.csv")}, ValidationFailedExitCode},
+		{"invalid options", []string{"--input=" + clean, "--min-valid-v=5", "--max-valid-v=3"}, ValidationFailedExitCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := SetupValidateCommand()
+			if err := cmd.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			var err error
+			captureStdout(t, func() { err = ValidateCommand(ParseValidateOptions(cmd)) })
+			if got := ValidateExitCode(err); got != tt.want {
+				t.Errorf("exit code %d (%v), want %d", got, err, tt.want)
+			}
+		})
+	}
+
+	if err := SetupValidateCommand().Parse([]string{"--no-such-flag"}); err == nil {
+		t.Errorf("an unknown flag was accepted")
+	}
+}
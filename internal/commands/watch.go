@@ -0,0 +1,277 @@
+package commands
+
+import (
+	"enemeter-data-processing/pkg/metrics"
+	"enemeter-data-processing/pkg/parser"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// WatchOptions holds the options of the watch command
+type WatchOptions struct {
+	InputFile     string
+	UseStdin      bool
+	StartTime     string
+	Timezone      string
+	Interval      time.Duration
+	RollingWindow time.Duration
+}
+
+// SetupWatchCommand configures the watch command with all its flags
+func SetupWatchCommand() *flag.FlagSet {
+	watchCmd := flag.NewFlagSet("watch", flag.ExitOnError)
+
+	watchCmd.String("input", "", "Path to the input CSV file")
+	watchCmd.Bool("stdin", false, "Read records from standard input instead of a file")
+	watchCmd.String("start", "", "Start time for measurements (format: YYYY-MM-DD HH:MM:SS, default: now)")
+	watchCmd.String("timezone", "", "Time zone of --start and the reported times, e.g. Europe/Berlin (default: UTC)")
+	watchCmd.Duration("interval", 5*time.Second, "How often to recompute and display the running summary")
+	watchCmd.Duration("rolling-window", time.Hour, "Only keep records this far back from the newest one (0 = keep all)")
+
+	watchCmd.Usage = func() {
+		fmt.Println(AppName + " - Display running metrics for live ENEMETER data")
+		fmt.Println("\nUsage:")
+		fmt.Println("  enemeter-data-processing watch [options]")
+		fmt.Println("\nExamples:")
+		fmt.Println("  Watch data piped from a serial bridge")
+		fmt.Println("  socat - TCP:esp32.local:7000 | enemeter-data-processing watch --stdin --interval=10s")
+		fmt.Println("\n  Keep only the last 15 minutes of data")
+		fmt.Println("  nc esp32.local 7000 | enemeter-data-processing watch --stdin --rolling-window=15m")
+		fmt.Println("\nOptions:")
+		watchCmd.PrintDefaults()
+	}
+
+	return watchCmd
+}
+
+// ParseWatchOptions parses command line flags into a structured options object
+func ParseWatchOptions(cmd *flag.FlagSet) WatchOptions {
+	return WatchOptions{
+		InputFile:     cmd.Lookup("input").Value.String(),
+		UseStdin:      cmd.Lookup("stdin").Value.(flag.Getter).Get().(bool),
+		StartTime:     cmd.Lookup("start").Value.String(),
+		Timezone:      cmd.Lookup("timezone").Value.String(),
+		Interval:      cmd.Lookup("interval").Value.(flag.Getter).Get().(time.Duration),
+		RollingWindow: cmd.Lookup("rolling-window").Value.(flag.Getter).Get().(time.Duration),
+	}
+}
+
+// WatchCommand reads records continuously and periodically prints the
+// running metrics summary until the input ends
+func WatchCommand(options WatchOptions) error {
+	if !options.UseStdin && options.InputFile == "" {
+		return fmt.Errorf("input file is required (--input), or use --stdin")
+	}
+
+	if options.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+
+	startTime, err := watchStartTime(options)
+	if err != nil {
+		return err
+	}
+
+	var input io.Reader = os.Stdin
+	if !options.UseStdin {
+		file, err := os.Open(options.InputFile)
+		if err != nil {
+			return fmt.Errorf("failed to open input file: %w", err)
+		}
+		defer func() {
+			if closeErr := file.Close(); closeErr != nil {
+				log.Printf("Warning: Error closing file: %v", closeErr)
+			}
+		}()
+		input = file
+	}
+
+	return watchRecords(input, startTime, options, os.Stdout)
+}
+
+// watchStartTime returns the time the first record is counted from: --start
+// in the --timezone, or now
+func watchStartTime(options WatchOptions) (time.Time, error) {
+	location, err := loadTimezone(options.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if options.StartTime == "" {
+		return time.Now().In(location), nil
+	}
+	startTime, err := parseTimeString(options.StartTime, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid start time: %w", err)
+	}
+	return startTime, nil
+}
+
+// watchRecords feeds records from r into a rolling calculator and writes a
+// summary to out every interval, plus a final one when r is exhausted
+func watchRecords(r io.Reader, startTime time.Time, options WatchOptions, out io.Writer) error {
+	scanner := parser.NewRecordScanner(r, startTime)
+	calculator := metrics.NewRollingCalculator(options.RollingWindow)
+
+	// The scanner is owned by the reading goroutine; the invalid line count
+	// travels with each record so the display loop never touches it
+	type scannedRecord struct {
+		record       parser.EnemeterRecord
+		invalidLines int
+	}
+
+	records := make(chan scannedRecord)
+	scanErr := make(chan error, 1)
+	go func() {
+		for scanner.Scan() {
+			records <- scannedRecord{scanner.Record(), scanner.InvalidLines()}
+		}
+		// Lines skipped after the last record still need to be reported
+		records <- scannedRecord{invalidLines: scanner.InvalidLines()}
+		scanErr <- scanner.Err()
+		close(records)
+	}()
+
+	invalidLines := 0
+
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case scanned, ok := <-records:
+			if !ok {
+				if _, err := fmt.Fprint(out, formatWatchSummary(calculator, invalidLines)); err != nil {
+					return err
+				}
+				if err := <-scanErr; err != nil {
+					return fmt.Errorf("error reading input: %w", err)
+				}
+				return nil
+			}
+			invalidLines = scanned.invalidLines
+			if !scanned.record.Timestamp.IsZero() {
+				calculator.Add(scanned.record)
+			}
+
+		case <-ticker.C:
+			if _, err := fmt.Fprint(out, formatWatchSummary(calculator, invalidLines)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// formatWatchSummary renders a compact summary of the records in the window
+func formatWatchSummary(calculator *metrics.RollingCalculator, invalidLines int) string {
+	var sb strings.Builder
+
+	calculator.SetInvalidRows(invalidLines)
+	energyMetrics := calculator.CalculateMetrics()
+
+	sb.WriteString(fmt.Sprintf("===== %s =====\n", time.Now().Format("2006-01-02 15:04:05")))
+	sb.WriteString(fmt.Sprintf("Records in Window: %d\n", calculator.Len()))
+	if invalidLines > 0 {
+		sb.WriteString(fmt.Sprintf("Invalid Lines Skipped: %d\n", invalidLines))
+	}
+	if calculator.Len() == 0 {
+		sb.WriteString("No data received yet\n\n")
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("Time Range: %s to %s\n",
+		energyMetrics.TimeRange.StartTime.Format("2006-01-02 15:04:05"),
+		energyMetrics.TimeRange.EndTime.Format("2006-01-02 15:04:05")))
+	sb.WriteString(fmt.Sprintf("Data Completeness: %.2f (%s)\n", energyMetrics.DataCompletenessScore, energyMetrics.DataQuality))
+	sb.WriteString(fmt.Sprintf("Total Energy: %.4f joules\n", energyMetrics.TotalJoules))
+	sb.WriteString(fmt.Sprintf("Average Power: %.4f watts\n", energyMetrics.AveragePowerWatts))
+	sb.WriteString(fmt.Sprintf("Peak Power: %.4f watts\n", energyMetrics.PeakPowerWatts))
+	sb.WriteString(fmt.Sprintf("Average Voltage: %.6f V\n", energyMetrics.VoltageStats.AvgVoltage))
+	sb.WriteString(fmt.Sprintf("Average Current: %.9f A\n", energyMetrics.CurrentStats.AvgCurrent))
+	sb.WriteString(fmt.Sprintf("Average Temperature: %.2f °C\n\n", energyMetrics.TemperatureStats.AvgTempCelsius))
+
+	return sb.String()
+}
+
+// watchProcess implements process --watch: it reports on the rows already in
+// the file, then follows it and reports again after every poll that brought
+// new records. Ctrl-C prints a last report for any unreported records.
+func watchProcess(inputParser parser.RecordParser, options CommandLineOptions) error {
+	if options.WatchInterval <= 0 {
+		return fmt.Errorf("--watch-interval must be positive")
+	}
+	if options.RandomSample {
+		log.Printf("Warning: --randomize is not supported with --watch and will be ignored")
+	}
+	if options.ResampleInterval != "" || options.ResampleMs != 0 || options.AnomalySigma > 0 || options.KeepTmp {
+		log.Printf("Warning: resampling, anomaly detection and --keep-tmp are not supported with --watch and will be ignored")
+	}
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		if _, ok := <-signals; ok {
+			close(stop)
+		}
+	}()
+
+	calculator := metrics.NewIncrementalCalculator(buildMetricsOptions(options))
+	reported := -1
+
+	// report runs on the parser's goroutine between reads, so the calculator
+	// is never used concurrently
+	report := func() {
+		if calculator.Len() == reported {
+			return
+		}
+		reported = calculator.Len()
+		if err := writeWatchReport(calculator.CalculateMetrics(), options); err != nil {
+			log.Printf("Error: %v", err)
+		}
+	}
+
+	fmt.Printf("Watching %s for new data, press Ctrl-C to stop...\n", options.InputFiles[0])
+	err := inputParser.FollowRecords(stop, options.WatchInterval, report, func(record parser.EnemeterRecord) error {
+		calculator.Add(record)
+		return nil
+	})
+	report()
+	if err != nil {
+		return fmt.Errorf("failed to follow input file: %v", err)
+	}
+	return nil
+}
+
+// writeWatchReport prints the report, or replaces the output file with it
+func writeWatchReport(energyMetrics metrics.EnergyMetrics, options CommandLineOptions) error {
+	if options.EnergyRate > 0 {
+		cost, err := buildCostAnalysis(energyMetrics, options)
+		if err != nil {
+			return fmt.Errorf("failed to calculate energy cost: %v", err)
+		}
+		energyMetrics.CostAnalysis = cost
+	}
+
+	output, err := generateOutput(energyMetrics, options)
+	if err != nil {
+		return fmt.Errorf("failed to generate output: %v", err)
+	}
+
+	if options.OutputFile == "" {
+		fmt.Println(output)
+		return nil
+	}
+	if err := os.WriteFile(options.OutputFile, []byte(output), 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %v", err)
+	}
+	fmt.Printf("Results for %d records saved to %s\n", energyMetrics.DataPoints, options.OutputFile)
+	return nil
+}
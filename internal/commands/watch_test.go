@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchRecords(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		rollingWindow time.Duration
+		invalidLines  int
+		want          []string
+	}{
+		{"keep all", 0, 0, []string{"Records in Window: 100\n", "Time Range: 2024-01-01 00:00:01 to 2024-01-01 00:01:40\n"}},
+		{"rolling window", 10 * time.Second, 0, []string{"Records in Window: 11\n", "Time Range: 2024-01-01 00:01:30 to 2024-01-01 00:01:40\n"}},
+		{"invalid lines", 0, 3, []string{"Records in Window: 100\n", "Invalid Lines Skipped: 3\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, w := io.Pipe()
+			go func() {
+				for i := 0; i < 100; i++ {
+					fmt.Fprintf(w, "1000,3700000,1000000,25000\n")
+					if i < tt.invalidLines {
+						fmt.Fprintf(w, "not,a,record\n")
+					}
+				}
+				w.Close()
+			}()
+
+			var out bytes.Buffer
+			options := WatchOptions{Interval: time.Hour, RollingWindow: tt.rollingWindow}
+			if err := watchRecords(r, start, options, &out); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("summary lacks %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestWatchStartTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		options WatchOptions
+		want    string
+		wantErr bool
+	}{
+		{"UTC by default", WatchOptions{StartTime: "2024-01-01 12:00:00"}, "2024-01-01T12:00:00Z", false},
+		{"time zone", WatchOptions{StartTime: "2024-01-01 12:00:00", Timezone: "Europe/Berlin"}, "2024-01-01T12:00:00+01:00", false},
+		{"unknown time zone", WatchOptions{StartTime: "2024-01-01 12:00:00", Timezone: "Nowhere/City"}, "", true},
+		{"invalid start", WatchOptions{StartTime: "yesterday"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := watchStartTime(tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("watchStartTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Format(time.RFC3339) != tt.want {
+				t.Errorf("watchStartTime() = %s, want %s", got.Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
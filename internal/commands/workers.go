@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"enemeter-data-processing/pkg/metrics"
+	"enemeter-data-processing/pkg/parser"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// fileResult is the outcome of one input file processed by a worker
+type fileResult struct {
+	index   int
+	metrics metrics.EnergyMetrics
+	err     error
+}
+
+// processFilesConcurrently calculates the metrics of every input stream on
+// its own, with workers goroutines taking the streams from a shared queue.
+// The results are in the order of the inputs. A file with time deltas
+// continues the one before it, so the interval to its first record counts.
+func processFilesConcurrently(inputFiles []string, streams []parser.StreamFunc, workers int,
+	resampleInterval time.Duration, metricsOptions metrics.MetricsOptions, options CommandLineOptions) ([]metrics.EnergyMetrics, error) {
+	jobs := make(chan int)
+	results := make(chan fileResult)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fileOptions := metricsOptions
+				fileOptions.CountFirstInterval = i > 0 && !options.EpochTimestamps
+				fileMetrics, err := calculateFileMetrics(streams[i], resampleInterval, fileOptions, options)
+				results <- fileResult{index: i, metrics: fileMetrics, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		for i := range streams {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Results are collected until the workers are done, even after an
+	// error, so that no worker is left blocked on the channel
+	fileMetrics := make([]metrics.EnergyMetrics, len(streams))
+	var firstErr error
+	for result := range results {
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to process %s: %v", inputFiles[result.index], result.err)
+			}
+			continue
+		}
+		fileMetrics[result.index] = result.metrics
+		fmt.Printf("Processed %s (%d records)\n", inputFiles[result.index], result.metrics.DataPoints)
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return fileMetrics, nil
+}
+
+// calculateFileMetrics passes one input through the anomaly detector and
+// the resampler, if enabled, into the metrics calculation. The records are
+// only held in memory when not streaming, as for a single input.
+func calculateFileMetrics(stream parser.StreamFunc, resampleInterval time.Duration,
+	metricsOptions metrics.MetricsOptions, options CommandLineOptions) (metrics.EnergyMetrics, error) {
+
+	var anomalies *metrics.AnomalyDetector
+	if options.AnomalySigma > 0 {
+		anomalies = metrics.NewAnomalyDetector(options.AnomalyWindow, options.AnomalySigma)
+		stream = anomalies.Wrap(stream)
+	}
+
+	var resampler *parser.ResamplingReader
+	if resampleInterval > 0 {
+		resampler = parser.NewResamplingReader(stream, resampleInterval.Milliseconds())
+		stream = resampler.StreamRecords
+	}
+
+	var fileMetrics metrics.EnergyMetrics
+	var err error
+	if options.UseStreaming {
+		fileMetrics, err = metrics.StreamCalculateMetricsFunc(stream, metricsOptions)
+	} else {
+		var records []parser.EnemeterRecord
+		err = stream(func(record parser.EnemeterRecord) error {
+			records = append(records, record)
+			return nil
+		})
+		if err == nil {
+			fileMetrics = metrics.NewEnergyCalculator(records).WithOptions(metricsOptions).CalculateMetrics()
+		}
+	}
+	if err != nil {
+		return fileMetrics, err
+	}
+
+	if resampler != nil {
+		warnResampleSkipped(resampler)
+	}
+	if anomalies != nil {
+		fileMetrics.Anomalies = anomalies.Events()
+	}
+	return fileMetrics, nil
+}
@@ -0,0 +1,212 @@
+package commands
+
+import (
+	"enemeter-data-processing/pkg/metrics"
+	"enemeter-data-processing/pkg/parser"
+	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessFilesConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	var inputFiles []string
+	for i := 0; i < 6; i++ {
+		var rows []string
+		start := int64(1704103200000) + int64(i)*3600000
+		for j := int64(0); j < 200; j++ {
+			// A spike, a gap and readings that differ from file to file
+			volts, gap := 3600000+int64(i)*10000+j%7*1000, int64(0)
+			if j == 100 {
+				volts = 9000000
+			}
+			if j > 150 {
+				gap = 120000
+			}
+			rows = append(rows, fmt.Sprintf("%d,%d,%d,%d", start+j*1000+gap, volts, (j%5-2)*1000000, 25000+j*10))
+		}
+		inputFiles = append(inputFiles, writeInput(t, dir, fmt.Sprintf("input%d.csv", i), rows))
+	}
+
+	run := func(t *testing.T, workers int, args ...string) ([]metrics.EnergyMetrics, []parser.GapEvent) {
+		t.Helper()
+		options := processOptions(t, append([]string{"--no-timestamp-accumulation", "--aggregate-by=file",
+			"--anomaly-sigma=3", "--resample=500ms", "--max-gap-ms=60000"}, args...)...)
+		filterOptions, err := buildFilterOptions(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gaps := &gapCollector{}
+		filterOptions.GapThresholdMs = options.MaxGapMs
+		filterOptions.GapCallback = gaps.add
+
+		var streams []parser.StreamFunc
+		for _, inputFile := range inputFiles {
+			inputParser, err := newInputParser(inputFile, options, filterOptions, parser.CountModeEstimate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			streams = append(streams, inputParser.StreamRecords)
+		}
+
+		var fileMetrics []metrics.EnergyMetrics
+		captureStdout(t, func() {
+			fileMetrics, err = processFilesConcurrently(inputFiles, streams, workers, 500*time.Millisecond, buildMetricsOptions(options), options)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fileMetrics, gaps.events()
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"in memory", nil},
+		{"exact percentiles", []string{"--exact-percentiles"}},
+		{"streaming", []string{"--stream"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serial, serialGaps := run(t, 1, tt.args...)
+			concurrent, concurrentGaps := run(t, 4, tt.args...)
+
+			for i := range serial {
+				if serial[i].DataPoints == 0 || len(serial[i].Anomalies) == 0 {
+					t.Errorf("file %d: %d data points and %d anomalies", i, serial[i].DataPoints, len(serial[i].Anomalies))
+				}
+				if !reflect.DeepEqual(concurrent[i], serial[i]) {
+					t.Errorf("file %d with 4 workers = %+v, want %+v", i, concurrent[i], serial[i])
+				}
+			}
+			// Gaps arrive in the order the workers find them
+			if len(concurrentGaps) != len(serialGaps) || len(serialGaps) != len(inputFiles) {
+				t.Errorf("%d gaps with 4 workers, %d serially, want %d", len(concurrentGaps), len(serialGaps), len(inputFiles))
+			}
+		})
+	}
+}
+
+func TestMergedWorkers(t *testing.T) {
+	// Daily files with time deltas that continue one another, so that the
+	// intervals between the files count as well
+	dir := t.TempDir()
+	var inputFiles []string
+	for i := 0; i < 5; i++ {
+		var rows []string
+		for j := int64(0); j < 300; j++ {
+			rows = append(rows, fmt.Sprintf("%d,%d,%d,%d", 1000+j%3*500, 3600000+int64(i)*20000+j%7*1000, (j%5-2)*1000000+int64(i)*300000, 25000+j*10))
+		}
+		inputFiles = append(inputFiles, writeInput(t, dir, fmt.Sprintf("day%d.csv", i), rows))
+	}
+
+	options := processOptions(t, "--start=2024-01-01 23:50:00", "--workers=4", "--reservoir-size=0")
+	filterOptions, err := buildFilterOptions(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metricsOptions := buildMetricsOptions(options)
+	newParsers := func() []parser.RecordParser {
+		var inputParsers []parser.RecordParser
+		for _, inputFile := range inputFiles {
+			inputParser, err := newInputParser(inputFile, options, filterOptions, parser.CountModeEstimate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			inputParsers = append(inputParsers, inputParser)
+		}
+		return inputParsers
+	}
+
+	pool := func(workers int) metrics.EnergyMetrics {
+		streams, err := parser.ChainStreams(newParsers())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fileMetrics []metrics.EnergyMetrics
+		captureStdout(t, func() {
+			fileMetrics, err = processFilesConcurrently(inputFiles, streams, workers, 0, metricsOptions, options)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return metrics.MergeMetrics(fileMetrics)
+	}
+
+	var records []parser.EnemeterRecord
+	if err := parser.ChainParsers(newParsers())(func(record parser.EnemeterRecord) error {
+		records = append(records, record)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	serial := metrics.NewEnergyCalculator(records).WithOptions(metricsOptions).CalculateMetrics()
+
+	merged := pool(4)
+	if again := pool(1); !reflect.DeepEqual(merged, again) {
+		t.Errorf("4 workers = %+v, 1 worker = %+v", merged, again)
+	}
+
+	if merged.DataPoints != serial.DataPoints || !merged.TimeRange.StartTime.Equal(serial.TimeRange.StartTime) || !merged.TimeRange.EndTime.Equal(serial.TimeRange.EndTime) {
+		t.Errorf("merged %d points from %v to %v, serial %d from %v to %v", merged.DataPoints, merged.TimeRange.StartTime, merged.TimeRange.EndTime,
+			serial.DataPoints, serial.TimeRange.StartTime, serial.TimeRange.EndTime)
+	}
+	tests := []struct {
+		name      string
+		got, want float64
+	}{
+		{"total joules", merged.TotalJoules, serial.TotalJoules},
+		{"duration", merged.DurationSeconds, serial.DurationSeconds},
+		{"average voltage", merged.VoltageStats.AvgVoltage, serial.VoltageStats.AvgVoltage},
+		{"current std dev", merged.CurrentStats.StdDev, serial.CurrentStats.StdDev},
+		{"voltage-current correlation", merged.Correlations.VoltageCurrent, serial.Correlations.VoltageCurrent},
+		{"discharge time", merged.BatteryStats.TotalDischargeTime, serial.BatteryStats.TotalDischargeTime},
+		{"energy before midnight", merged.EnergyConsumptionByHour[23], serial.EnergyConsumptionByHour[23]},
+	}
+	for _, tt := range tests {
+		if math.Abs(tt.got-tt.want) > 1e-9*math.Max(1, math.Abs(tt.want)) {
+			t.Errorf("%s = %v, serial %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestWorkersOptions(t *testing.T) {
+	dir := t.TempDir()
+	rows := []string{"1704103200000,3700000,1000000,25000", "1704103201000,3700000,1000000,25000"}
+	first := writeInput(t, dir, "first.csv", rows)
+	second := writeInput(t, dir, "second.csv", rows)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"merged report", []string{"--workers=2"}, ""},
+		{"per file", []string{"--aggregate-by=file", "--workers=2"}, ""},
+		{"keep-tmp", []string{"--aggregate-by=file", "--keep-tmp"}, "--keep-tmp"},
+		{"resample-output", []string{"--workers=2", "--resample=1s", "--resample-output=" + filepath.Join(dir, "resampled.csv")}, "--resample-output"},
+		{"merged windows", []string{"--workers=2", "--aggregate-by=hour"}, "--aggregate-by windows"},
+		{"merged exact percentiles", []string{"--workers=2", "--exact-percentiles"}, "--exact-percentiles"},
+		{"merged state of charge", []string{"--workers=2", "--battery-capacity-ah=2"}, "--battery-capacity-ah"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--input=" + first, "--input=" + second, "--no-timestamp-accumulation"}, tt.args...)
+			var err error
+			captureStdout(t, func() { err = ProcessCommand(processOptions(t, args...)) })
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
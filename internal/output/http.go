@@ -0,0 +1,123 @@
+// Package output holds the destinations a report can be sent to besides
+// stdout and local files
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// DefaultHTTPTimeout bounds one request, including reading the response
+	DefaultHTTPTimeout = 30 * time.Second
+
+	// DefaultHTTPRetries is how often a failed POST is repeated
+	DefaultHTTPRetries = 3
+
+	// DefaultHTTPBackoff is the wait before the first retry; it doubles
+	// with every further retry
+	DefaultHTTPBackoff = time.Second
+)
+
+// HTTPSink POSTs reports as JSON to a URL, such as a dashboard webhook
+type HTTPSink struct {
+	URL   string
+	Token string // sent as a Bearer Authorization header when not empty
+
+	Client  *http.Client
+	Retries int
+	Backoff time.Duration
+}
+
+// StatusError is returned when the server answered with a non-2xx status
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Body)
+}
+
+// NewHTTPSink creates a sink with the default retry policy. A timeout of
+// zero uses DefaultHTTPTimeout.
+func NewHTTPSink(url, token string, timeout time.Duration) *HTTPSink {
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	return &HTTPSink{
+		URL:     url,
+		Token:   token,
+		Client:  &http.Client{Timeout: timeout},
+		Retries: DefaultHTTPRetries,
+		Backoff: DefaultHTTPBackoff,
+	}
+}
+
+// Post sends report as JSON. Network errors and 5xx responses are retried
+// with exponential backoff; other non-2xx responses fail at once.
+func (s *HTTPSink) Post(report interface{}) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	backoff := s.Backoff
+	for attempt := 0; ; attempt++ {
+		err = s.post(body)
+		if err == nil || attempt >= s.Retries || !transient(err) {
+			return err
+		}
+		log.Printf("Warning: Posting report failed (%v), retrying in %s", err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post makes a single attempt
+func (s *HTTPSink) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Printf("Warning: Error closing response body: %v", closeErr)
+		}
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(respBody))}
+	}
+
+	return nil
+}
+
+// transient reports whether a failed attempt is worth repeating: the
+// request got no answer, or the server had a problem of its own
+func transient(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	// Client.Do reports connection failures and timeouts as *url.Error
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
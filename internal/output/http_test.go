@@ -0,0 +1,80 @@
+package output
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPSinkPost(t *testing.T) {
+	report := map[string]float64{"TotalJoules": 12.5}
+
+	tests := []struct {
+		name         string
+		token        string
+		statuses     []int // answered in turn, the last one repeats
+		wantAuth     string
+		wantRequests int
+		wantStatus   int // of the returned StatusError, 0 for success
+	}{
+		{"with token", "secret", []int{http.StatusOK}, "Bearer secret", 1, 0},
+		{"without token", "", []int{http.StatusNoContent}, "", 1, 0},
+		{"client error is not retried", "", []int{http.StatusBadRequest}, "", 1, http.StatusBadRequest},
+		{"server error is retried", "", []int{http.StatusBadGateway, http.StatusOK}, "", 2, 0},
+		{"retries run out", "", []int{http.StatusServiceUnavailable}, "", 3, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("method = %s, want POST", r.Method)
+				}
+				if got := r.Header.Get("Content-Type"); got != "application/json" {
+					t.Errorf("Content-Type = %q", got)
+				}
+				if got := r.Header.Get("Authorization"); got != tt.wantAuth {
+					t.Errorf("Authorization = %q, want %q", got, tt.wantAuth)
+				}
+
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Error(err)
+				}
+				var got map[string]float64
+				if err := json.Unmarshal(body, &got); err != nil {
+					t.Errorf("body is not JSON: %v", err)
+				}
+				if got["TotalJoules"] != report["TotalJoules"] {
+					t.Errorf("body = %s", body)
+				}
+
+				status := tt.statuses[min(requests, len(tt.statuses)-1)]
+				requests++
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			sink := NewHTTPSink(server.URL, tt.token, 0)
+			sink.Retries = 2
+			sink.Backoff = time.Millisecond
+
+			err := sink.Post(report)
+			var statusErr *StatusError
+			switch {
+			case tt.wantStatus == 0 && err != nil:
+				t.Errorf("Post() = %v", err)
+			case tt.wantStatus != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus):
+				t.Errorf("Post() = %v, want status %d", err, tt.wantStatus)
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Package enemeter is the entry point for using the ENEMETER data processing
+// as a library. Process covers the common case of one file in, metrics out;
+// the parser and metrics packages offer finer control.
+package enemeter
+
+import (
+	"fmt"
+	"time"
+
+	"enemeter-data-processing/pkg/metrics"
+	"enemeter-data-processing/pkg/parser"
+)
+
+// The result types, so that callers of Process need not import the metrics
+// package for them
+type (
+	EnergyMetrics    = metrics.EnergyMetrics
+	TemperatureStats = metrics.TemperatureStats
+	VoltageStats     = metrics.VoltageStats
+	CurrentStats     = metrics.CurrentStats
+	BatteryStats     = metrics.BatteryStats
+	SolarStats       = metrics.SolarStats
+)
+
+// Options configures Process. The zero value reads the whole file with the
+// default calculation options.
+type Options struct {
+	// InputFormat is parser.FormatCSV or parser.FormatJSONL; empty picks the
+	// format from the file extension
+	InputFormat string
+
+	// Filter is applied while reading. Its StartTime is set by Process.
+	Filter parser.FilterOptions
+
+	// Metrics.ReservoirSize must be set, e.g. to metrics.DefaultReservoirSize,
+	// for the estimated percentiles and medians
+	Metrics metrics.MetricsOptions
+}
+
+// Process reads the file at filePath, reconstructing the timestamps from
+// startTime, and returns its metrics. The records are streamed unless
+// opts.Metrics.ExactPercentiles needs them all in memory.
+func Process(filePath string, startTime time.Time, opts Options) (EnergyMetrics, error) {
+	filter := opts.Filter
+	filter.StartTime = &startTime
+	if filter.SampleRate < 1 {
+		filter.SampleRate = 1
+	}
+
+	p, err := parser.NewRecordParser(filePath, opts.InputFormat, filter, parser.CountModeEstimate)
+	if err != nil {
+		return EnergyMetrics{}, err
+	}
+
+	if !opts.Metrics.ExactPercentiles {
+		return metrics.StreamCalculateMetrics(p, opts.Metrics)
+	}
+
+	records, err := p.Parse()
+	if err != nil {
+		return EnergyMetrics{}, fmt.Errorf("failed to parse %s: %w", filePath, err)
+	}
+	return metrics.NewEnergyCalculator(records).WithOptions(opts.Metrics).CalculateMetrics(), nil
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+
+	"enemeter-data-processing/pkg/parser"
+)
+
+// WindowStart returns the start of the aggregation window that t falls in.
+// Windows that divide a day evenly (hours, 6h, a day) are aligned to
+// midnight in the location of t; longer windows to multiples of window
+// since the zero time.
+func WindowStart(t time.Time, window time.Duration) time.Time {
+	const day = 24 * time.Hour
+	if window <= day && day%window == 0 {
+		midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return midnight.Add(t.Sub(midnight).Truncate(window))
+	}
+	return t.Truncate(window)
+}
+
+// AggregateByDuration calculates the metrics of every window of the given
+// length that holds records, in time order. Windows without records are
+// left out. Like every interval, the one ending at the first record of a
+// window is counted in that window, so the energies and durations of the
+// windows add up to those of all records.
+func AggregateByDuration(records []parser.EnemeterRecord, window time.Duration, options MetricsOptions) []EnergyMetrics {
+	aggregator := newWindowAggregator(window, options)
+	for _, record := range records {
+		aggregator.add(record)
+	}
+	return aggregator.finish()
+}
+
+// StreamAggregateByDuration is AggregateByDuration over a record stream.
+// Only the tracker of the current window is kept in memory.
+func StreamAggregateByDuration(stream parser.StreamFunc, window time.Duration, options MetricsOptions) ([]EnergyMetrics, error) {
+	aggregator := newWindowAggregator(window, options)
+	err := stream(func(record parser.EnemeterRecord) error {
+		aggregator.add(record)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("streaming aggregation error: %w", err)
+	}
+	return aggregator.finish(), nil
+}
+
+// windowAggregator runs one metricsTracker per window, reusing it from one
+// window to the next
+type windowAggregator struct {
+	window  time.Duration
+	options MetricsOptions
+	tracker *metricsTracker
+	start   time.Time // of the current window
+	open    bool      // the tracker holds records of the current window
+	results []EnergyMetrics
+}
+
+func newWindowAggregator(window time.Duration, options MetricsOptions) *windowAggregator {
+	return &windowAggregator{
+		window:  window,
+		options: options,
+		tracker: newMetricsTracker(options),
+	}
+}
+
+func (a *windowAggregator) add(record parser.EnemeterRecord) {
+	timestamp := record.Timestamp
+	if a.options.Location != nil {
+		timestamp = timestamp.In(a.options.Location)
+	}
+	start := WindowStart(timestamp, a.window)
+	if a.open && !start.Equal(a.start) {
+		a.results = append(a.results, a.tracker.finalizeMetrics())
+		prev := a.tracker.prevRecord
+		a.tracker.reset(a.options)
+		a.tracker.prevRecord = prev
+		a.open = false
+	}
+	if !a.open {
+		a.start = start
+		a.open = true
+	}
+	a.tracker.processRecord(record, 0)
+}
+
+// finish closes the last window and returns the metrics of all windows
+func (a *windowAggregator) finish() []EnergyMetrics {
+	if a.open {
+		a.results = append(a.results, a.tracker.finalizeMetrics())
+		a.open = false
+	}
+	return a.results
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"enemeter-data-processing/pkg/parser"
+)
+
+func TestAggregateByDuration(t *testing.T) {
+	// Varying power every 7 minutes over 10 hours, so intervals cross the
+	// boundaries of every window length
+	var readings []reading
+	readings = append(readings, reading{0, 3.7, 1, 25})
+	for i := 1; i < 86; i++ {
+		readings = append(readings, reading{7 * 60 * 1000, 3.6 + float64(i%3)*0.1, float64(i%5) - 2, 25})
+	}
+	records := buildRecords(testStart, readings)
+	whole := NewEnergyCalculator(records).CalculateMetrics()
+
+	tests := []struct {
+		name        string
+		window      time.Duration
+		wantWindows int
+	}{
+		{"hour", time.Hour, 10},
+		{"quarter hour", 15 * time.Minute, 40},
+		{"6h", 6 * time.Hour, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows := AggregateByDuration(records, tt.window, MetricsOptions{})
+			streamed, err := StreamAggregateByDuration(parser.SliceStream(records), tt.window, MetricsOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(windows) != tt.wantWindows || len(streamed) != tt.wantWindows {
+				t.Fatalf("%d windows, %d streamed, want %d", len(windows), len(streamed), tt.wantWindows)
+			}
+
+			var joules, seconds float64
+			points := 0
+			for i, w := range windows {
+				joules += w.TotalJoules
+				seconds += w.DurationSeconds
+				points += w.DataPoints
+				if streamed[i].TotalJoules != w.TotalJoules {
+					t.Errorf("window %d: streamed %v J, want %v", i, streamed[i].TotalJoules, w.TotalJoules)
+				}
+			}
+			if !approxEqual(joules, whole.TotalJoules, 1e-9) {
+				t.Errorf("windows add up to %v J, want %v", joules, whole.TotalJoules)
+			}
+			if !approxEqual(seconds, whole.DurationSeconds, 1e-9) || points != whole.DataPoints {
+				t.Errorf("windows add up to %v s and %d points, want %v s and %d", seconds, points, whole.DurationSeconds, whole.DataPoints)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"math"
+	"time"
+
+	"enemeter-data-processing/pkg/parser"
+)
+
+// DefaultAnomalyWindow is the number of preceding samples the local mean
+// and standard deviation are computed over
+const DefaultAnomalyWindow = 50
+
+// anomalyLevelShift is the number of consecutive flagged readings of a
+// channel after which they are taken as a new level rather than outliers
+const anomalyLevelShift = 3
+
+// channelResolution is one count of the record's units per channel, in V,
+// A and °C
+var channelResolution = [3]float64{1e-6, 1e-9, 1e-3}
+
+// Channels checked by the AnomalyDetector
+const (
+	ChannelVoltage     = "voltage"
+	ChannelCurrent     = "current"
+	ChannelTemperature = "temperature"
+)
+
+// AnomalyEvent is a reading that lies more than the configured number of
+// standard deviations away from the mean of the preceding window
+type AnomalyEvent struct {
+	RecordIndex int
+	Timestamp   time.Time
+	Channel     string
+	Value       float64 // in V, A or °C
+	LocalMean   float64
+	LocalStdDev float64
+	Sigma       float64 // distance from the mean in standard deviations of at least one count
+}
+
+// AnomalyDetector flags statistically improbable readings, such as bit
+// flips on the sensor bus, per channel. Only the last window samples are
+// kept, so it can run over a stream of any length.
+type AnomalyDetector struct {
+	sigma    float64
+	channels [3]*rollingWindow
+	streaks  [3]int // consecutive flagged readings per channel
+	index    int
+	events   []AnomalyEvent
+}
+
+// NewAnomalyDetector creates a detector flagging readings more than sigma
+// standard deviations from the mean of the last window samples. A window
+// of zero or less uses DefaultAnomalyWindow.
+func NewAnomalyDetector(window int, sigma float64) *AnomalyDetector {
+	if window <= 0 {
+		window = DefaultAnomalyWindow
+	}
+	d := &AnomalyDetector{sigma: sigma}
+	for i := range d.channels {
+		d.channels[i] = newRollingWindow(window)
+	}
+	return d
+}
+
+// Add checks one record against the preceding window of every channel and
+// adds the values that were not flagged, so a spike does not widen the
+// window it is judged against. A channel flagged anomalyLevelShift times in
+// a row has changed level, such as on a load step, and its window starts
+// over from the current reading. The deviation of a window is taken as at
+// least one count, so a one-count change after a constant stretch is not
+// flagged. It reports whether any channel was anomalous.
+func (d *AnomalyDetector) Add(record parser.EnemeterRecord) bool {
+	values := [3]float64{
+		float64(record.VoltageMicroV) / 1000000.0,
+		float64(record.CurrentNanoA) / 1000000000.0,
+		float64(record.TempMiliCelsius) / 1000.0,
+	}
+	names := [3]string{ChannelVoltage, ChannelCurrent, ChannelTemperature}
+
+	anomalous := false
+	for i, window := range d.channels {
+		// Judge only once the window is full so the statistics are settled
+		if window.full() {
+			mean, stdDev := window.stats()
+			deviation := math.Abs(values[i] - mean)
+			if deviation > d.sigma*max(stdDev, channelResolution[i]) {
+				d.events = append(d.events, AnomalyEvent{
+					RecordIndex: d.index,
+					Timestamp:   record.Timestamp,
+					Channel:     names[i],
+					Value:       values[i],
+					LocalMean:   mean,
+					LocalStdDev: stdDev,
+					Sigma:       deviation / max(stdDev, channelResolution[i]),
+				})
+				anomalous = true
+				d.streaks[i]++
+				if d.streaks[i] < anomalyLevelShift {
+					continue
+				}
+				window.reset()
+			}
+		}
+		d.streaks[i] = 0
+		window.add(values[i])
+	}
+
+	d.index++
+	return anomalous
+}
+
+// Detect runs the detector over records in memory and returns the events
+func (d *AnomalyDetector) Detect(records []parser.EnemeterRecord) []AnomalyEvent {
+	for _, record := range records {
+		d.Add(record)
+	}
+	return d.Events()
+}
+
+// Wrap returns a stream that passes every record of stream through
+// unchanged while checking it, for use in streaming mode
+func (d *AnomalyDetector) Wrap(stream parser.StreamFunc) parser.StreamFunc {
+	return func(callback func(record parser.EnemeterRecord) error) error {
+		return stream(func(record parser.EnemeterRecord) error {
+			d.Add(record)
+			return callback(record)
+		})
+	}
+}
+
+// Events returns the anomalies found so far in record order
+func (d *AnomalyDetector) Events() []AnomalyEvent {
+	return d.events
+}
+
+// rollingWindow is a ring buffer of the last size values
+type rollingWindow struct {
+	values []float64
+	next   int
+	count  int
+}
+
+func newRollingWindow(size int) *rollingWindow {
+	return &rollingWindow{values: make([]float64, size)}
+}
+
+func (w *rollingWindow) add(value float64) {
+	w.values[w.next] = value
+	w.next = (w.next + 1) % len(w.values)
+	if w.count < len(w.values) {
+		w.count++
+	}
+}
+
+func (w *rollingWindow) reset() {
+	w.next, w.count = 0, 0
+}
+
+func (w *rollingWindow) full() bool {
+	return w.count == len(w.values)
+}
+
+// stats returns the mean and population standard deviation of the window.
+// The window is small, so both are recomputed in two passes rather than
+// kept as running sums that would drift.
+func (w *rollingWindow) stats() (float64, float64) {
+	values := w.values[:w.count]
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	sumSq := 0.0
+	for _, v := range values {
+		sumSq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sumSq / float64(len(values)))
+}
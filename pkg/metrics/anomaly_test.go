@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnomalyDetector(t *testing.T) {
+	// Voltage alternating between 3.6 and 3.8 V with spikes at the given
+	// indices; current and temperature stay constant
+	withSpikes := func(n int, spikes map[int]float64) []reading {
+		readings := make([]reading, n)
+		for i := range readings {
+			volts := 3.6
+			if i%2 == 1 {
+				volts = 3.8
+			}
+			if spike, ok := spikes[i]; ok {
+				volts = spike
+			}
+			readings[i] = reading{1000, volts, 1, 25}
+		}
+		return readings
+	}
+
+	tests := []struct {
+		name        string
+		readings    []reading
+		wantIndices []int
+		wantSigma   []float64
+	}{
+		{"no spikes", withSpikes(40, nil), nil, nil},
+		{"single spike", withSpikes(40, map[int]float64{20: 4.7}), []int{20}, []float64{10}},
+		// The first spike stays out of the window, so the second one is
+		// judged against the same mean and deviation
+		{"consecutive spikes", withSpikes(40, map[int]float64{20: 4.7, 21: 4.7}), []int{20, 21}, []float64{10, 10}},
+		{"not judged before the window is full", withSpikes(40, map[int]float64{5: 4.7}), nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewAnomalyDetector(10, 3)
+			events := d.Detect(buildRecords(testStart, tt.readings))
+
+			var indices []int
+			var sigmas []float64
+			for _, event := range events {
+				if event.Channel != ChannelVoltage {
+					t.Errorf("unexpected %s anomaly at %d", event.Channel, event.RecordIndex)
+				}
+				indices = append(indices, event.RecordIndex)
+				sigmas = append(sigmas, event.Sigma)
+			}
+			if !reflect.DeepEqual(indices, tt.wantIndices) {
+				t.Fatalf("anomalies at %v, want %v", indices, tt.wantIndices)
+			}
+			for i, sigma := range sigmas {
+				if !approxEqual(sigma, tt.wantSigma[i], 1e-6) {
+					t.Errorf("event %d: sigma = %v, want %v", i, sigma, tt.wantSigma[i])
+				}
+				if !approxEqual(events[i].LocalMean, 3.7, 1e-9) || !approxEqual(events[i].LocalStdDev, 0.1, 1e-9) {
+					t.Errorf("event %d: window %v ± %v, want 3.7 ± 0.1", i, events[i].LocalMean, events[i].LocalStdDev)
+				}
+			}
+		})
+	}
+}
+
+func TestAnomalyDetectorChannels(t *testing.T) {
+	// A current spike must not keep the voltage of the same record out of
+	// the voltage window
+	readings := steadyReadings(20, 1000)
+	readings[12].amps = 50
+	readings[14].volts = 3.8
+
+	d := NewAnomalyDetector(10, 3)
+	events := d.Detect(buildRecords(testStart, readings))
+
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Channel)
+	}
+	if want := []string{ChannelCurrent, ChannelVoltage}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("channels = %v, want %v", got, want)
+	}
+	if events[1].LocalStdDev != 0 || !approxEqual(events[1].LocalMean, 3.7, 1e-9) {
+		t.Errorf("voltage window %v ± %v, want 3.7 ± 0", events[1].LocalMean, events[1].LocalStdDev)
+	}
+}
+
+func TestAnomalyDetectorLevels(t *testing.T) {
+	// A change from record 15 on after a constant stretch
+	changed := func(change func(r *reading)) []reading {
+		readings := steadyReadings(40, 1000)
+		for i := 15; i < len(readings); i++ {
+			change(&readings[i])
+		}
+		return readings
+	}
+
+	tests := []struct {
+		name        string
+		readings    []reading
+		wantChannel string
+		wantIndices []int
+	}{
+		{"one count", changed(func(r *reading) { r.volts += 1e-6 }), "", nil},
+		// Flagged until taken as the new level, then judged against it
+		{"small change", changed(func(r *reading) { r.volts += 1e-3 }), ChannelVoltage, []int{15, 16, 17}},
+		{"load step", changed(func(r *reading) { r.amps = 2 }), ChannelCurrent, []int{15, 16, 17}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewAnomalyDetector(10, 3)
+			events := d.Detect(buildRecords(testStart, tt.readings))
+
+			var indices []int
+			for _, event := range events {
+				if event.Channel != tt.wantChannel {
+					t.Errorf("unexpected %s anomaly at %d", event.Channel, event.RecordIndex)
+				}
+				indices = append(indices, event.RecordIndex)
+			}
+			if !reflect.DeepEqual(indices, tt.wantIndices) {
+				t.Errorf("anomalies at %v, want %v", indices, tt.wantIndices)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package metrics
+
+import "math"
+
+// MetricDelta is the change of one scalar metric from a baseline to a
+// candidate run
+type MetricDelta struct {
+	Name          string // field path in EnergyMetrics, e.g. "VoltageStats.MinVoltage"
+	Baseline      float64
+	Candidate     float64
+	AbsoluteDelta float64 // Candidate - Baseline
+	PercentDelta  float64 // relative to |Baseline|; ±100 when Baseline is zero
+	Regression    bool    // changed for the worse by more than the threshold
+}
+
+// DeltaMetrics compares two EnergyMetrics field by field
+type DeltaMetrics struct {
+	RegressionThresholdPercent float64
+	Fields                     []MetricDelta
+	Regressions                int
+}
+
+// Directions of the compared fields: whether an increase or a decrease is
+// a regression. Fields without a better direction are never regressions.
+const (
+	higherIsWorse = 1
+	lowerIsWorse  = -1
+	neutral       = 0
+)
+
+type comparedField struct {
+	name      string
+	direction int
+	value     func(m EnergyMetrics) float64
+}
+
+// comparedFields lists the scalars of EnergyMetrics in report order
+var comparedFields = []comparedField{
+	{"TotalJoules", higherIsWorse, func(m EnergyMetrics) float64 { return m.TotalJoules }},
+	{"AveragePowerWatts", higherIsWorse, func(m EnergyMetrics) float64 { return m.AveragePowerWatts }},
+	{"PeakPowerWatts", higherIsWorse, func(m EnergyMetrics) float64 { return m.PeakPowerWatts }},
+	{"JoulesPerDay", higherIsWorse, func(m EnergyMetrics) float64 { return m.JoulesPerDay }},
+	{"PeakToAveragePowerRatio", higherIsWorse, func(m EnergyMetrics) float64 { return m.PeakToAveragePowerRatio }},
+	{"CrestFactor", higherIsWorse, func(m EnergyMetrics) float64 { return m.CrestFactor }},
+	{"HourlyEnergyEntropy", neutral, func(m EnergyMetrics) float64 { return m.HourlyEnergyEntropy }},
+	{"DurationSeconds", neutral, func(m EnergyMetrics) float64 { return m.DurationSeconds }},
+	{"DataPoints", neutral, func(m EnergyMetrics) float64 { return float64(m.DataPoints) }},
+	{"DataCompletenessScore", lowerIsWorse, func(m EnergyMetrics) float64 { return m.DataCompletenessScore }},
+	{"MaxTimeDeltaMs", neutral, func(m EnergyMetrics) float64 { return float64(m.MaxTimeDeltaMs) }},
+
+	{"TemperatureStats.MinTempCelsius", neutral, func(m EnergyMetrics) float64 { return m.TemperatureStats.MinTempCelsius }},
+	{"TemperatureStats.MaxTempCelsius", higherIsWorse, func(m EnergyMetrics) float64 { return m.TemperatureStats.MaxTempCelsius }},
+	{"TemperatureStats.AvgTempCelsius", higherIsWorse, func(m EnergyMetrics) float64 { return m.TemperatureStats.AvgTempCelsius }},
+	{"TemperatureStats.TempRateOfChangePerSec", neutral, func(m EnergyMetrics) float64 { return m.TemperatureStats.TempRateOfChangePerSec }},
+	{"TemperatureStats.TempRateOfChangePeakPerSec", higherIsWorse, func(m EnergyMetrics) float64 { return m.TemperatureStats.TempRateOfChangePeakPerSec }},
+	{"TemperatureStats.StdDev", neutral, func(m EnergyMetrics) float64 { return m.TemperatureStats.StdDev }},
+	{"TemperatureStats.P25", higherIsWorse, func(m EnergyMetrics) float64 { return m.TemperatureStats.P25 }},
+	{"TemperatureStats.P50", higherIsWorse, func(m EnergyMetrics) float64 { return m.TemperatureStats.P50 }},
+	{"TemperatureStats.P75", higherIsWorse, func(m EnergyMetrics) float64 { return m.TemperatureStats.P75 }},
+	{"TemperatureStats.P95", higherIsWorse, func(m EnergyMetrics) float64 { return m.TemperatureStats.P95 }},
+	{"TemperatureStats.P99", higherIsWorse, func(m EnergyMetrics) float64 { return m.TemperatureStats.P99 }},
+
+	{"VoltageStats.MinVoltage", lowerIsWorse, func(m EnergyMetrics) float64 { return m.VoltageStats.MinVoltage }},
+	{"VoltageStats.MaxVoltage", neutral, func(m EnergyMetrics) float64 { return m.VoltageStats.MaxVoltage }},
+	{"VoltageStats.AvgVoltage", neutral, func(m EnergyMetrics) float64 { return m.VoltageStats.AvgVoltage }},
+	{"VoltageStats.StdDev", higherIsWorse, func(m EnergyMetrics) float64 { return m.VoltageStats.StdDev }},
+	{"VoltageStats.RippleAmplitudeV", higherIsWorse, func(m EnergyMetrics) float64 { return m.VoltageStats.RippleAmplitudeV }},
+	{"VoltageStats.RippleRmsV", higherIsWorse, func(m EnergyMetrics) float64 { return m.VoltageStats.RippleRmsV }},
+	{"VoltageStats.P25", neutral, func(m EnergyMetrics) float64 { return m.VoltageStats.P25 }},
+	{"VoltageStats.P50", neutral, func(m EnergyMetrics) float64 { return m.VoltageStats.P50 }},
+	{"VoltageStats.P75", neutral, func(m EnergyMetrics) float64 { return m.VoltageStats.P75 }},
+	{"VoltageStats.P95", neutral, func(m EnergyMetrics) float64 { return m.VoltageStats.P95 }},
+	{"VoltageStats.P99", neutral, func(m EnergyMetrics) float64 { return m.VoltageStats.P99 }},
+
+	{"CurrentStats.MinCurrent", neutral, func(m EnergyMetrics) float64 { return m.CurrentStats.MinCurrent }},
+	{"CurrentStats.MaxCurrent", neutral, func(m EnergyMetrics) float64 { return m.CurrentStats.MaxCurrent }},
+	{"CurrentStats.AvgCurrent", neutral, func(m EnergyMetrics) float64 { return m.CurrentStats.AvgCurrent }},
+	{"CurrentStats.MaxDischarge", higherIsWorse, func(m EnergyMetrics) float64 { return m.CurrentStats.MaxDischarge }},
+	{"CurrentStats.MaxCharging", neutral, func(m EnergyMetrics) float64 { return m.CurrentStats.MaxCharging }},
+	{"CurrentStats.StdDev", neutral, func(m EnergyMetrics) float64 { return m.CurrentStats.StdDev }},
+	{"CurrentStats.P25", neutral, func(m EnergyMetrics) float64 { return m.CurrentStats.P25 }},
+	{"CurrentStats.P50", neutral, func(m EnergyMetrics) float64 { return m.CurrentStats.P50 }},
+	{"CurrentStats.P75", neutral, func(m EnergyMetrics) float64 { return m.CurrentStats.P75 }},
+	{"CurrentStats.P95", neutral, func(m EnergyMetrics) float64 { return m.CurrentStats.P95 }},
+	{"CurrentStats.P99", neutral, func(m EnergyMetrics) float64 { return m.CurrentStats.P99 }},
+
+	{"BatteryStats.TotalDischargeTime", neutral, func(m EnergyMetrics) float64 { return m.BatteryStats.TotalDischargeTime }},
+	{"BatteryStats.TotalChargeTime", neutral, func(m EnergyMetrics) float64 { return m.BatteryStats.TotalChargeTime }},
+	{"BatteryStats.DischargeToChargeRatio", higherIsWorse, func(m EnergyMetrics) float64 { return m.BatteryStats.DischargeToChargeRatio }},
+	{"BatteryStats.AverageDischargeRate", higherIsWorse, func(m EnergyMetrics) float64 { return m.BatteryStats.AverageDischargeRate }},
+	{"BatteryStats.ChargePowerAvg", lowerIsWorse, func(m EnergyMetrics) float64 { return m.BatteryStats.ChargePowerAvg }},
+	{"BatteryStats.DischargePowerAvg", higherIsWorse, func(m EnergyMetrics) float64 { return m.BatteryStats.DischargePowerAvg }},
+	{"BatteryStats.PowerAsymmetryRatio", higherIsWorse, func(m EnergyMetrics) float64 { return m.BatteryStats.PowerAsymmetryRatio }},
+	{"BatteryStats.CycleCount", neutral, func(m EnergyMetrics) float64 { return float64(m.BatteryStats.CycleCount) }},
+
+	{"SolarStats.TotalEnergyProduced", lowerIsWorse, func(m EnergyMetrics) float64 { return m.SolarStats.TotalEnergyProduced }},
+	{"SolarStats.AverageOutput", lowerIsWorse, func(m EnergyMetrics) float64 { return m.SolarStats.AverageOutput }},
+	{"SolarStats.PeakOutput", lowerIsWorse, func(m EnergyMetrics) float64 { return m.SolarStats.PeakOutput }},
+	{"SolarStats.ContributionPercentage", lowerIsWorse, func(m EnergyMetrics) float64 { return m.SolarStats.ContributionPercentage }},
+
+	{"EfficiencyStats.InputEnergyJ", neutral, func(m EnergyMetrics) float64 { return m.EfficiencyStats.InputEnergyJ }},
+	{"EfficiencyStats.OutputEnergyJ", neutral, func(m EnergyMetrics) float64 { return m.EfficiencyStats.OutputEnergyJ }},
+	{"EfficiencyStats.EfficiencyPercent", lowerIsWorse, func(m EnergyMetrics) float64 { return m.EfficiencyStats.EfficiencyPercent }},
+	{"EfficiencyStats.LossesJ", higherIsWorse, func(m EnergyMetrics) float64 { return m.EfficiencyStats.LossesJ }},
+}
+
+// CompareMetrics computes the change of every scalar metric from baseline
+// to candidate. A field is a regression when it moved in its worse
+// direction (e.g. more energy, lower minimum voltage) by more than
+// thresholdPercent.
+func CompareMetrics(baseline, candidate EnergyMetrics, thresholdPercent float64) DeltaMetrics {
+	delta := DeltaMetrics{
+		RegressionThresholdPercent: thresholdPercent,
+		Fields:                     make([]MetricDelta, 0, len(comparedFields)),
+	}
+
+	for _, field := range comparedFields {
+		d := MetricDelta{
+			Name:      field.name,
+			Baseline:  field.value(baseline),
+			Candidate: field.value(candidate),
+		}
+		d.AbsoluteDelta = d.Candidate - d.Baseline
+		d.PercentDelta = percentChange(d.Baseline, d.Candidate)
+		d.Regression = float64(field.direction)*d.PercentDelta > thresholdPercent
+		if d.Regression {
+			delta.Regressions++
+		}
+		delta.Fields = append(delta.Fields, d)
+	}
+
+	return delta
+}
+
+// percentChange returns the change relative to |baseline|. A change from
+// zero has no finite percentage and counts as ±100%.
+func percentChange(baseline, candidate float64) float64 {
+	if baseline == 0 {
+		switch {
+		case candidate > 0:
+			return 100
+		case candidate < 0:
+			return -100
+		default:
+			return 0
+		}
+	}
+	return (candidate - baseline) / math.Abs(baseline) * 100
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import "math"
+
+// CorrelationMatrix holds the Pearson correlation coefficients between the
+// measurement channels, each between -1 and 1. A coefficient is 0 when one
+// of its channels never changed.
+type CorrelationMatrix struct {
+	VoltageCurrent     float64
+	VoltageTemperature float64
+	CurrentTemperature float64
+}
+
+// channelCorrelation accumulates the co-moments of voltage, current and
+// temperature in a single pass. Like distribution it uses Welford-style
+// updates around the running means rather than raw sums of products, which
+// would lose the small voltage variations to cancellation.
+type channelCorrelation struct {
+	count int
+
+	meanV, meanC, meanT float64
+	m2V, m2C, m2T       float64
+	coVC, coVT, coCT    float64
+}
+
+func (c *channelCorrelation) add(volts, amps, celsius float64) {
+	c.count++
+	n := float64(c.count)
+
+	dV := volts - c.meanV
+	dC := amps - c.meanC
+	dT := celsius - c.meanT
+
+	c.meanV += dV / n
+	c.meanC += dC / n
+	c.meanT += dT / n
+
+	// The products use the old deviation of one channel and the new
+	// deviation of the other
+	c.m2V += dV * (volts - c.meanV)
+	c.m2C += dC * (amps - c.meanC)
+	c.m2T += dT * (celsius - c.meanT)
+	c.coVC += dV * (amps - c.meanC)
+	c.coVT += dV * (celsius - c.meanT)
+	c.coCT += dC * (celsius - c.meanT)
+}
+
+func (c *channelCorrelation) matrix() CorrelationMatrix {
+	return CorrelationMatrix{
+		VoltageCurrent:     pearson(c.coVC, c.m2V, c.m2C),
+		VoltageTemperature: pearson(c.coVT, c.m2V, c.m2T),
+		CurrentTemperature: pearson(c.coCT, c.m2C, c.m2T),
+	}
+}
+
+func pearson(coMoment, m2X, m2Y float64) float64 {
+	if m2X <= 0 || m2Y <= 0 {
+		return 0
+	}
+	return coMoment / math.Sqrt(m2X*m2Y)
+}
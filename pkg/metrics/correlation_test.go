@@ -0,0 +1,51 @@
+package metrics
+
+import "testing"
+
+func TestChannelCorrelation(t *testing.T) {
+	// Signs of two sequences whose products cancel over every four samples
+	square := []float64{1, -1, 1, -1}
+	shifted := []float64{1, 1, -1, -1}
+
+	tests := []struct {
+		name   string
+		add    func(i int) (volts, amps, celsius float64)
+		wantVC float64
+		wantVT float64
+		wantCT float64
+	}{
+		{"linear", func(i int) (float64, float64, float64) {
+			return 3.6 + 0.001*float64(i), 0.5 * float64(i), 25 - 0.1*float64(i)
+		}, 1, -1, -1},
+		{"independent", func(i int) (float64, float64, float64) {
+			return 3.7 + 0.01*square[i%4], shifted[i%4], 25 + square[i%4]*shifted[i%4]
+		}, 0, 0, 0},
+		{"constant channel", func(i int) (float64, float64, float64) {
+			return 3.7, float64(i), float64(i)
+		}, 0, 0, 1},
+		// Microvolt variations on top of a large offset must not be lost
+		// to cancellation
+		{"small variations", func(i int) (float64, float64, float64) {
+			return 3.7 + 1e-6*float64(i%2), float64(i % 2), 25 - float64(i%2)
+		}, 1, -1, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c channelCorrelation
+			for i := 0; i < 1000; i++ {
+				c.add(tt.add(i))
+			}
+			m := c.matrix()
+			if !approxEqual(m.VoltageCurrent, tt.wantVC, 1e-6) {
+				t.Errorf("VoltageCurrent = %v, want %v", m.VoltageCurrent, tt.wantVC)
+			}
+			if !approxEqual(m.VoltageTemperature, tt.wantVT, 1e-6) {
+				t.Errorf("VoltageTemperature = %v, want %v", m.VoltageTemperature, tt.wantVT)
+			}
+			if !approxEqual(m.CurrentTemperature, tt.wantCT, 1e-6) {
+				t.Errorf("CurrentTemperature = %v, want %v", m.CurrentTemperature, tt.wantCT)
+			}
+		})
+	}
+}
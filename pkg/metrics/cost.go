@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+)
+
+const joulesPerKWh = 3600000.0
+
+// CostAnalysis prices the consumed energy at a flat rate in the currency of
+// the rate schedule, optionally converted into a target currency.
+type CostAnalysis struct {
+	EnergyKWh          float64
+	RatePerKWh         float64
+	BaseCurrency       string
+	TotalCostBase      float64
+	TargetCurrency     string
+	ExchangeRate       float64
+	TotalCostConverted float64
+}
+
+// CalculateCost prices the total energy of the metrics at ratePerKWh. The
+// target currency starts out equal to the base currency.
+func CalculateCost(metrics EnergyMetrics, ratePerKWh float64, currency string) CostAnalysis {
+	energyKWh := math.Abs(metrics.TotalJoules) / joulesPerKWh
+	totalCost := energyKWh * ratePerKWh
+
+	return CostAnalysis{
+		EnergyKWh:          energyKWh,
+		RatePerKWh:         ratePerKWh,
+		BaseCurrency:       currency,
+		TotalCostBase:      totalCost,
+		TargetCurrency:     currency,
+		ExchangeRate:       1,
+		TotalCostConverted: totalCost,
+	}
+}
+
+// ConvertTo expresses the cost in another currency using the given rate
+// (units of target currency per unit of base currency). Converting to the
+// base currency itself leaves the cost unchanged.
+func (c CostAnalysis) ConvertTo(currency string, exchangeRate float64) CostAnalysis {
+	if strings.EqualFold(currency, c.BaseCurrency) {
+		exchangeRate = 1
+	}
+
+	c.TargetCurrency = currency
+	c.ExchangeRate = exchangeRate
+	c.TotalCostConverted = c.TotalCostBase * exchangeRate
+	return c
+}
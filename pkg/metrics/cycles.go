@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"math"
+	"time"
+
+	"enemeter-data-processing/pkg/parser"
+)
+
+const (
+	CycleCharge    = "charge"
+	CycleDischarge = "discharge"
+)
+
+// CycleSegment is one uninterrupted charge or discharge episode
+type CycleSegment struct {
+	CycleType    string // CycleCharge or CycleDischarge
+	StartTime    time.Time
+	EndTime      time.Time
+	EnergyJoules float64
+	PeakCurrentA float64 // largest current magnitude in the segment
+}
+
+// SegmentCycles splits records into charge and discharge episodes by the
+// sign of the current. A new segment only starts once the current leaves
+// the ±deadbandNanoA band on the other side, so noise around zero does not
+// produce a flood of tiny cycles.
+func SegmentCycles(records []parser.EnemeterRecord, deadbandNanoA int64) []CycleSegment {
+	s := newCycleSegmenter(deadbandNanoA)
+	for _, record := range records {
+		s.add(record)
+	}
+	return s.segments
+}
+
+// cycleSegmenter builds the segments one record at a time so that the
+// streaming tracker can use it as well
+type cycleSegmenter struct {
+	deadband int64
+	segments []CycleSegment
+	started  bool // the first record's delta precedes the data and is not counted
+}
+
+func newCycleSegmenter(deadbandNanoA int64) *cycleSegmenter {
+	return &cycleSegmenter{deadband: deadbandNanoA}
+}
+
+// reset drops the segments; they may be held by an earlier result, so their
+// memory is not reused
+func (s *cycleSegmenter) reset(deadbandNanoA int64) {
+	*s = cycleSegmenter{deadband: deadbandNanoA}
+}
+
+func (s *cycleSegmenter) add(record parser.EnemeterRecord) {
+	defer func() { s.started = true }()
+
+	cycleType := ""
+	switch {
+	case record.CurrentNanoA > s.deadband:
+		cycleType = CycleCharge
+	case record.CurrentNanoA < -s.deadband:
+		cycleType = CycleDischarge
+	}
+
+	var current *CycleSegment
+	if len(s.segments) > 0 {
+		current = &s.segments[len(s.segments)-1]
+	}
+
+	// Readings inside the deadband belong to the running segment
+	if cycleType != "" && (current == nil || current.CycleType != cycleType) {
+		if current != nil {
+			current.EndTime = record.Timestamp
+		}
+		s.segments = append(s.segments, CycleSegment{
+			CycleType: cycleType,
+			StartTime: record.Timestamp,
+			EndTime:   record.Timestamp,
+		})
+		current = &s.segments[len(s.segments)-1]
+	}
+	if current == nil {
+		return
+	}
+
+	volts := math.Abs(float64(record.VoltageMicroV) / 1000000.0)
+	amps := float64(record.CurrentNanoA) / 1000000000.0
+
+	current.EndTime = record.Timestamp
+	if s.started {
+		current.EnergyJoules += math.Abs(volts*amps) * float64(record.TimeDeltaMs) / 1000.0
+	}
+	current.PeakCurrentA = math.Max(current.PeakCurrentA, math.Abs(amps))
+}
+
+// dischargeCount returns the number of discharge segments
+func (s *cycleSegmenter) dischargeCount() int {
+	count := 0
+	for _, segment := range s.segments {
+		if segment.CycleType == CycleDischarge {
+			count++
+		}
+	}
+	return count
+}
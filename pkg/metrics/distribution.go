@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// DefaultReservoirSize is the number of values kept per channel for the
+// percentile estimates by NewEnergyCalculator and NewRollingCalculator. Up
+// to this many records the percentiles are exact.
+const DefaultReservoirSize = 10000
+
+// minReservoirCapacity is the first allocation of a growing sample
+const minReservoirCapacity = 64
+
+// distribution accumulates the spread of one measurement channel in a single
+// pass: Welford's algorithm gives the exact standard deviation and a uniform
+// reservoir sample (Algorithm R) gives the percentiles with bounded memory.
+// A size of zero keeps no sample and leaves the percentiles at zero.
+type distribution struct {
+	count int
+	mean  float64
+	m2    float64
+
+	sample []float64
+	size   int
+	rng    *rand.Rand
+}
+
+func newDistribution(size int) *distribution {
+	return &distribution{
+		size: max(size, 0),
+		// A fixed seed keeps the estimates reproducible between runs
+		rng: rand.New(rand.NewSource(1)),
+	}
+}
+
+func (d *distribution) add(value float64) {
+	d.count++
+	delta := value - d.mean
+	d.mean += delta / float64(d.count)
+	d.m2 += delta * (value - d.mean)
+
+	if d.size == 0 {
+		return
+	}
+	if len(d.sample) < d.size {
+		// Grow by hand so that the capacity never exceeds the reservoir
+		// size, which append would round up
+		if len(d.sample) == cap(d.sample) {
+			grown := make([]float64, len(d.sample), min(max(2*cap(d.sample), minReservoirCapacity), d.size))
+			copy(grown, d.sample)
+			d.sample = grown
+		}
+		d.sample = append(d.sample, value)
+		return
+	}
+	if j := d.rng.Intn(d.count); j < d.size {
+		d.sample[j] = value
+	}
+}
+
+// reset forgets all values, keeping the sample's memory unless it is
+// larger than the new size
+func (d *distribution) reset(size int) {
+	size = max(size, 0)
+	d.count, d.mean, d.m2 = 0, 0, 0
+	d.size = size
+	if cap(d.sample) > size {
+		d.sample = nil
+	}
+	d.sample = d.sample[:0]
+	d.rng.Seed(1)
+}
+
+// stdDev returns the population standard deviation
+func (d *distribution) stdDev() float64 {
+	if d.count == 0 {
+		return 0
+	}
+	return math.Sqrt(d.m2 / float64(d.count))
+}
+
+// percentiles returns the requested percentiles (0-100) of the sample
+func (d *distribution) percentiles(ps ...float64) []float64 {
+	sorted := make([]float64, len(d.sample))
+	copy(sorted, d.sample)
+	sort.Float64s(sorted)
+
+	values := make([]float64, len(ps))
+	for i, p := range ps {
+		values[i] = percentile(sorted, p)
+	}
+	return values
+}
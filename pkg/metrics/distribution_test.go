@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"enemeter-data-processing/pkg/parser"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{nil, 50, 0},
+		{[]float64{7}, 99, 7},
+		{[]float64{1, 2, 3, 4}, 0, 1},
+		{[]float64{1, 2, 3, 4}, 100, 4},
+		{[]float64{1, 2, 3, 4}, 50, 2.5},
+		{[]float64{10, 20, 30, 40, 50}, 25, 20},
+		{[]float64{10, 20, 30, 40, 50}, 90, 46},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(tt.sorted, tt.p); !approxEqual(got, tt.want, 1e-9) {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.sorted, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestChannelSpread(t *testing.T) {
+	// 1 to 101 V in a scrambled order; 37 is coprime to 101
+	readings := make([]reading, 101)
+	for i := range readings {
+		readings[i] = reading{1000, float64(i*37%101 + 1), 1, 25}
+	}
+	records := buildRecords(testStart, readings)
+
+	calculations := []struct {
+		name      string
+		calculate func() (EnergyMetrics, error)
+	}{
+		{"in memory", func() (EnergyMetrics, error) {
+			return NewEnergyCalculator(records).WithOptions(MetricsOptions{ReservoirSize: DefaultReservoirSize}).CalculateMetrics(), nil
+		}},
+		{"streaming", func() (EnergyMetrics, error) {
+			return StreamCalculateMetricsFunc(parser.SliceStream(records), MetricsOptions{ReservoirSize: DefaultReservoirSize})
+		}},
+	}
+
+	for _, c := range calculations {
+		t.Run(c.name, func(t *testing.T) {
+			m, err := c.calculate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := m.VoltageStats
+
+			tests := []struct {
+				name      string
+				got, want float64
+			}{
+				{"average", v.AvgVoltage, 51},
+				{"standard deviation", v.StdDev, math.Sqrt(850)},
+				{"P25", v.P25, 26},
+				{"P50", v.P50, 51},
+				{"median", v.MedianVoltage, 51},
+				{"P75", v.P75, 76},
+				{"P95", v.P95, 96},
+				{"P99", v.P99, 100},
+				{"current standard deviation", m.CurrentStats.StdDev, 0},
+				{"current P99", m.CurrentStats.P99, 1},
+			}
+			for _, tt := range tests {
+				if !approxEqual(tt.got, tt.want, 1e-9) {
+					t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReservoirDisabled(t *testing.T) {
+	readings := make([]reading, 101)
+	for i := range readings {
+		readings[i] = reading{1000, float64(i + 1), 1, 25}
+	}
+	records := buildRecords(testStart, readings)
+
+	// ReservoirSize 0 keeps the standard deviation but no percentiles
+	m := NewEnergyCalculator(records).WithOptions(MetricsOptions{}).CalculateMetrics()
+	v := m.VoltageStats
+	if !approxEqual(v.StdDev, math.Sqrt(850), 1e-9) {
+		t.Errorf("StdDev = %v, want %v", v.StdDev, math.Sqrt(850))
+	}
+	if v.P25 != 0 || v.P50 != 0 || v.P75 != 0 || v.P95 != 0 || v.P99 != 0 || v.MedianVoltage != 0 {
+		t.Errorf("percentiles %+v, want none", v)
+	}
+
+	// The constructor default estimates them
+	if m := NewEnergyCalculator(records).CalculateMetrics(); m.VoltageStats.P50 != 51 {
+		t.Errorf("default P50 = %v, want 51", m.VoltageStats.P50)
+	}
+}
@@ -0,0 +1,5 @@
+// Package metrics calculates energy, power, battery and measurement
+// statistics from ENEMETER records. EnergyCalculator works on records in
+// memory, StreamCalculateMetrics on a parser without keeping the records,
+// and IncrementalCalculator and RollingCalculator on live data.
+package metrics
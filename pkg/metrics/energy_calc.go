@@ -0,0 +1,984 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"enemeter-data-processing/pkg/parser"
+)
+
+// MetricType names a single metric that GetSpecificMetric can extract
+type MetricType string
+
+const (
+	MetricTotalEnergy       MetricType = "total_energy"
+	MetricAveragePower      MetricType = "average_power"
+	MetricPeakPower         MetricType = "peak_power"
+	MetricTemperature       MetricType = "temperature"
+	MetricEnergyByHour      MetricType = "energy_by_hour"
+	MetricEnergyByMinute    MetricType = "energy_by_minute"
+	MetricVoltageStats      MetricType = "voltage_stats"
+	MetricCurrentStats      MetricType = "current_stats"
+	MetricBatteryDischarge  MetricType = "battery_discharge"
+	MetricSolarContribution MetricType = "solar_contribution"
+	MetricPAPR              MetricType = "papr"
+	MetricEfficiency        MetricType = "efficiency"
+)
+
+// EnergyMetrics is the result of a calculation over a set of records
+type EnergyMetrics struct {
+	TotalJoules               float64
+	AveragePowerWatts         float64
+	PeakPowerWatts            float64
+	JoulesPerDay              float64
+	DurationSeconds           float64
+	TemperatureStats          TemperatureStats
+	EnergyConsumptionByHour   map[int]float64
+	EnergyConsumptionByMinute MinuteEnergy
+	VoltageStats              VoltageStats
+	CurrentStats              CurrentStats
+	BatteryStats              BatteryStats
+	SolarStats                SolarStats
+	EfficiencyStats           EfficiencyStats
+	CostAnalysis              CostAnalysis
+	TimeRange                 TimeRange
+	DataPoints                int
+	SamplingMethod            string
+	DataCompletenessScore     float64 // 0.0-1.0, see dataCompleteness
+	DataQuality               string  // "excellent", "good", "fair" or "poor"
+	MaxTimeDeltaMs            int64   // longest interval between two records
+	PartialHoursExcluded      []int   // hours dropped from EnergyConsumptionByHour by RequireCompleteHours
+	PeakToAveragePowerRatio   float64 // PeakPowerWatts / |AveragePowerWatts|
+	CrestFactor               float64 // sqrt of PeakToAveragePowerRatio
+
+	HourlyEnergyEntropy           float64 // Shannon entropy of the hourly energy shares, in bits
+	HourlyEnergyEntropyNormalized float64 // HourlyEnergyEntropy / log2(24), 0.0-1.0
+
+	Correlations CorrelationMatrix
+
+	// Value distributions of the readings, see Histogram
+	VoltageHistogram     Histogram
+	CurrentHistogram     Histogram
+	TemperatureHistogram Histogram
+
+	// PeakEvents lists the runs of records above
+	// MetricsOptions.PeakThresholdWatts; empty when no threshold is set
+	PeakEvents []PowerEvent `json:",omitempty"`
+
+	// Anomalies is filled by the caller when an AnomalyDetector was run
+	Anomalies []AnomalyEvent `json:",omitempty"`
+
+	// FirstRecord and LastRecord are kept for debugging output only
+	FirstRecord parser.EnemeterRecord `json:"-"`
+	LastRecord  parser.EnemeterRecord `json:"-"`
+}
+
+// MinuteEnergy maps the minute of the day (0-1439) to the energy in joules
+// consumed during it. In JSON the keys are written as "HH:MM".
+type MinuteEnergy map[int]float64
+
+// MarshalJSON writes the minutes as "HH:MM" keys
+func (m MinuteEnergy) MarshalJSON() ([]byte, error) {
+	byLabel := make(map[string]float64, len(m))
+	for minute, joules := range m {
+		byLabel[fmt.Sprintf("%02d:%02d", minute/60, minute%60)] = joules
+	}
+	return json.Marshal(byLabel)
+}
+
+// TemperatureStats summarizes the temperature readings in °C
+type TemperatureStats struct {
+	MinTempCelsius float64
+	MaxTempCelsius float64
+	AvgTempCelsius float64
+
+	TempRateOfChangePerSec     float64 // time-weighted average rate, °C/s
+	TempRateOfChangePeakPerSec float64 // fastest rise between two records, °C/s
+	TempThermalRunawayRisk     bool    // peak rise exceeded MetricsOptions.ThermalRunawayThreshold
+
+	// Spread of the readings; percentiles are estimated from a bounded
+	// sample and are exact up to MetricsOptions.ReservoirSize records, or
+	// zero when it is zero
+	StdDev            float64
+	P25               float64
+	P50               float64
+	P75               float64
+	P95               float64
+	P99               float64
+	MedianTempCelsius float64 // same as P50
+
+	ExactPercentiles PercentileSet
+}
+
+// VoltageStats summarizes the voltage readings in volts
+type VoltageStats struct {
+	MinVoltage float64
+	MaxVoltage float64
+	AvgVoltage float64
+
+	// Ripple is the deviation of the readings from their moving average,
+	// see MetricsOptions.RippleEMAAlpha
+	RippleAmplitudeV float64 // peak-to-peak
+	RippleRmsV       float64
+
+	StdDev        float64
+	P25           float64
+	P50           float64
+	P75           float64
+	P95           float64
+	P99           float64
+	MedianVoltage float64 // same as P50
+
+	ExactPercentiles PercentileSet
+}
+
+// CurrentStats summarizes the current readings in amperes; negative
+// current is discharge
+type CurrentStats struct {
+	MinCurrent   float64
+	MaxCurrent   float64
+	AvgCurrent   float64
+	MaxDischarge float64
+	MaxCharging  float64
+
+	StdDev        float64
+	P25           float64
+	P50           float64
+	P75           float64
+	P95           float64
+	P99           float64
+	MedianCurrent float64 // same as P50
+
+	ExactPercentiles PercentileSet
+}
+
+// BatteryStats describes charge and discharge behavior. Times are in
+// seconds and rates in watts.
+type BatteryStats struct {
+	EstimatedCapacity      float64
+	AverageDischargeRate   float64
+	TotalDischargeTime     float64
+	TotalChargeTime        float64
+	DischargeToChargeRatio float64
+
+	ChargePowerAvg      float64 // watts while charging
+	DischargePowerAvg   float64 // watts while discharging
+	PowerAsymmetryRatio float64 // DischargePowerAvg / ChargePowerAvg, 0 without charging data
+
+	// Coulomb counting, only filled when MetricsOptions.NominalCapacityAh is
+	// set. The battery is assumed to be full at the start of the data.
+	ConsumedCapacityAh  float64 // net charge drawn, discharge minus charge
+	EstimatedSoCPercent float64
+
+	CycleCount int // number of discharge segments in Cycles
+	Cycles     []CycleSegment
+}
+
+// SolarStats describes the energy produced while charging
+type SolarStats struct {
+	TotalEnergyProduced    float64
+	AverageOutput          float64
+	PeakOutput             float64
+	ContributionPercentage float64
+}
+
+// EfficiencyStats compares the energy that came in while charging with the
+// energy that went out to the load, see the thresholds in MetricsOptions
+type EfficiencyStats struct {
+	InputEnergyJ      float64
+	OutputEnergyJ     float64
+	EfficiencyPercent float64 // OutputEnergyJ / InputEnergyJ; 0 without input
+	LossesJ           float64 // InputEnergyJ - OutputEnergyJ
+}
+
+// PAPRStats describes how peaky the load profile is
+type PAPRStats struct {
+	PAPR        float64
+	CrestFactor float64
+}
+
+// TimeRange is the span between the first and last record
+type TimeRange struct {
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+const (
+	SamplingSequential = "sequential"
+	SamplingRandom     = "random"
+)
+
+// MetricsOptions configures a calculation; the zero value is usable
+type MetricsOptions struct {
+	RequestedMetrics      []MetricType
+	TimeResolution        time.Duration
+	IncludeTimeSeriesData bool
+	SamplingMethod        string // "sequential" or "random"
+	ExactPercentiles      bool   // only honored by CalculateMetrics, which has all records in memory
+	DisableSolar          bool   // skip charging/solar statistics for devices without a charging source
+	DisableBattery        bool   // skip discharge/battery statistics
+	RequireCompleteHours  bool   // drop hours with less than an hour of data from EnergyConsumptionByHour
+
+	// ThermalRunawayThreshold is the temperature rise in °C/s above which
+	// TempThermalRunawayRisk is set; zero uses DefaultThermalRunawayThreshold
+	ThermalRunawayThreshold float64
+
+	// NominalCapacityAh enables the state-of-charge estimate in BatteryStats
+	NominalCapacityAh float64
+
+	// CycleDeadbandNanoA is the current magnitude a reading must exceed to
+	// switch between charge and discharge segments
+	CycleDeadbandNanoA int64
+
+	// HistogramBuckets is the number of buckets of the value histograms;
+	// zero uses DefaultHistogramBuckets
+	HistogramBuckets int
+
+	// PeakThresholdWatts enables EnergyMetrics.PeakEvents; zero disables it
+	PeakThresholdWatts float64
+
+	// RippleEMAAlpha is the smoothing factor (0-1] of the moving average
+	// the voltage ripple is measured against; zero uses
+	// DefaultRippleEMAAlpha. Smaller values follow the DC level more slowly.
+	RippleEMAAlpha float64
+
+	// LoadCurrentThresholdNanoA is the discharge current magnitude above
+	// which an interval counts as output to the load, and
+	// ChargeCurrentThresholdNanoA the charge current above which it counts
+	// as input, for EfficiencyStats. Intervals in between count as neither.
+	LoadCurrentThresholdNanoA   int64
+	ChargeCurrentThresholdNanoA int64
+
+	// Location is the time zone of the hourly and per-minute energy and of
+	// TimeRange; nil keeps the location of the record timestamps
+	Location *time.Location
+
+	// InvalidRows is the number of input rows that could not be parsed, such
+	// as the lines skipped by a parser.RecordScanner. They lower
+	// DataCompletenessScore.
+	InvalidRows int
+
+	// CountFirstInterval counts the interval ending at the first record, as
+	// given by its TimeDeltaMs, when the records continue earlier ones that
+	// are calculated separately, such as the next of several files
+	CountFirstInterval bool
+
+	// ReservoirSize is the number of readings per channel kept for the
+	// estimated percentiles (P25 to P99 and the medians); zero disables the
+	// estimates and leaves them at zero. Memory stays bounded by it for any
+	// input length.
+	ReservoirSize int
+
+	// ProgressFunc, if set, is called by the streaming calculation every
+	// ProgressInterval records (default DefaultProgressInterval).
+	// EstimatedRecords is passed through as the expected total; zero means
+	// unknown.
+	ProgressFunc     ProgressFunc
+	ProgressInterval int
+	EstimatedRecords int
+}
+
+// ProgressFunc reports how many records have been processed so far
+type ProgressFunc func(processed, estimated int)
+
+// DefaultProgressInterval is the number of records between progress calls
+const DefaultProgressInterval = 10000
+
+// DefaultThermalRunawayThreshold is the temperature rise in °C/s that flags a
+// thermal runaway risk when MetricsOptions leaves the threshold unset
+const DefaultThermalRunawayThreshold = 1.0
+
+// EnergyCalculator calculates metrics over records held in memory
+type EnergyCalculator struct {
+	records   []parser.EnemeterRecord
+	options   MetricsOptions
+	streaming bool
+
+	// tracker is kept between calls so that its memory is reused
+	tracker *metricsTracker
+}
+
+// NewEnergyCalculator creates a calculator for records, which must be in
+// time order
+func NewEnergyCalculator(records []parser.EnemeterRecord) *EnergyCalculator {
+	return &EnergyCalculator{
+		records:   records,
+		streaming: false,
+		options: MetricsOptions{
+			TimeResolution: time.Minute * 5,
+			ReservoirSize:  DefaultReservoirSize,
+		},
+	}
+}
+
+// WithOptions replaces the calculation options
+func (e *EnergyCalculator) WithOptions(options MetricsOptions) *EnergyCalculator {
+	e.options = options
+	return e
+}
+
+// WithRecords replaces the records, which must be in time order
+func (e *EnergyCalculator) WithRecords(records []parser.EnemeterRecord) *EnergyCalculator {
+	e.records = records
+	return e
+}
+
+// Reset drops the records and clears the accumulated state, keeping the
+// allocated memory, so that the calculator can be reused for another
+// dataset with WithRecords. The options are kept.
+func (e *EnergyCalculator) Reset() {
+	e.records = nil
+	if e.tracker != nil {
+		e.tracker.reset(e.options)
+	}
+}
+
+// CalculateMetrics processes all records in a single pass
+func (e *EnergyCalculator) CalculateMetrics() EnergyMetrics {
+	if len(e.records) == 0 {
+		return EnergyMetrics{}
+	}
+
+	if e.tracker == nil {
+		e.tracker = newMetricsTracker(e.options)
+	} else {
+		e.tracker.reset(e.options)
+	}
+	tracker := e.tracker
+
+	for i, record := range e.records {
+		tracker.processRecord(record, i)
+	}
+
+	metrics := tracker.finalizeMetrics()
+
+	if e.options.ExactPercentiles {
+		applyExactPercentiles(&metrics, e.records)
+	}
+
+	return metrics
+}
+
+// StreamCalculateMetrics calculates metrics while p reads its input, without
+// keeping the records in memory
+func StreamCalculateMetrics(p parser.RecordParser, options MetricsOptions) (EnergyMetrics, error) {
+	if options.ProgressFunc != nil && options.EstimatedRecords == 0 {
+		if estimated, err := p.GetRecordCount(); err == nil {
+			options.EstimatedRecords = estimated
+		}
+	}
+	return StreamCalculateMetricsFunc(p.StreamRecords, options)
+}
+
+// StreamCalculateMetricsFunc calculates metrics from any record stream, such
+// as several inputs merged with parser.MergeCSVParsers
+func StreamCalculateMetricsFunc(stream parser.StreamFunc, options MetricsOptions) (EnergyMetrics, error) {
+	tracker := newMetricsTracker(options)
+
+	recordIndex := 0
+
+	progressInterval := options.ProgressInterval
+	if progressInterval <= 0 {
+		progressInterval = DefaultProgressInterval
+	}
+
+	var processFunc = func(record parser.EnemeterRecord) error {
+		tracker.processRecord(record, recordIndex)
+		recordIndex++
+		if options.ProgressFunc != nil && recordIndex%progressInterval == 0 {
+			options.ProgressFunc(recordIndex, options.EstimatedRecords)
+		}
+		return nil
+	}
+
+	err := stream(processFunc)
+
+	// A final call so the caller sees the exact total
+	if options.ProgressFunc != nil && recordIndex%progressInterval != 0 {
+		options.ProgressFunc(recordIndex, options.EstimatedRecords)
+	}
+
+	if err != nil {
+		return EnergyMetrics{}, fmt.Errorf("streaming calculation error: %w", err)
+	}
+
+	return tracker.finalizeMetrics(), nil
+}
+
+type metricsTracker struct {
+	options MetricsOptions
+
+	totalJoules     float64
+	totalPower      float64
+	peakPower       float64
+	totalDurationMs int64
+	dataPoints      int
+
+	startTime      time.Time
+	endTime        time.Time
+	firstTimestamp bool
+
+	tempSum   float64
+	minTemp   float64
+	maxTemp   float64
+	tempCount int
+	tempDist  *distribution
+	tempHist  *histogramBuilder
+
+	// Sum of temperature changes over the intervals that have a duration,
+	// so that divided by their total time it is the time-weighted rate
+	tempChangeSum    float64
+	tempChangeTime   float64
+	peakTempRiseRate float64
+
+	voltSum   float64
+	minVolt   float64
+	maxVolt   float64
+	voltCount int
+	voltDist  *distribution
+	voltHist  *histogramBuilder
+	ripple    *rippleTracker
+
+	currentSum   float64
+	minCurrent   float64
+	maxCurrent   float64
+	maxDischarge float64
+	maxCharging  float64
+	currentCount int
+	currentDist  *distribution
+	currentHist  *histogramBuilder
+
+	correlation channelCorrelation
+
+	totalDischargeTime   float64
+	totalChargeTime      float64
+	totalDischargeEnergy float64
+	totalChargeEnergy    float64
+
+	dischargedAh float64
+	chargedAh    float64
+
+	efficiencyInputJ  float64
+	efficiencyOutputJ float64
+	cycles            *cycleSegmenter
+
+	peaks *peakDetector
+
+	energyByHour   map[int]float64
+	energyByMinute MinuteEnergy
+	durationByHour map[int]float64 // milliseconds of data per hour of day, summed exactly
+
+	deltaCount         int
+	deltaSumSq         float64
+	maxObservedDeltaMs int64
+	gapDurationMs      int64
+
+	firstRecord parser.EnemeterRecord
+	prevRecord  *parser.EnemeterRecord
+}
+
+func newMetricsTracker(options MetricsOptions) *metricsTracker {
+	return &metricsTracker{
+		options:        options,
+		energyByHour:   make(map[int]float64),
+		energyByMinute: make(MinuteEnergy),
+		durationByHour: make(map[int]float64),
+		firstTimestamp: true,
+		cycles:         newCycleSegmenter(options.CycleDeadbandNanoA),
+		peaks:          newPeakDetector(options.PeakThresholdWatts),
+		tempDist:       newDistribution(options.ReservoirSize),
+		voltDist:       newDistribution(options.ReservoirSize),
+		currentDist:    newDistribution(options.ReservoirSize),
+		tempHist:       newHistogramBuilder(options.HistogramBuckets),
+		voltHist:       newHistogramBuilder(options.HistogramBuckets),
+		ripple:         newRippleTracker(options.RippleEMAAlpha),
+		currentHist:    newHistogramBuilder(options.HistogramBuckets),
+		minTemp:        math.MaxFloat64,
+		maxTemp:        -math.MaxFloat64,
+		minVolt:        math.MaxFloat64,
+		maxVolt:        -math.MaxFloat64,
+		minCurrent:     math.MaxFloat64,
+		maxCurrent:     -math.MaxFloat64,
+	}
+}
+
+// reset returns the tracker to the state of newMetricsTracker(options)
+// while keeping its maps and buffers for the next dataset
+func (mt *metricsTracker) reset(options MetricsOptions) {
+	energyByHour, energyByMinute, durationByHour := mt.energyByHour, mt.energyByMinute, mt.durationByHour
+	tempDist, voltDist, currentDist := mt.tempDist, mt.voltDist, mt.currentDist
+	tempHist, voltHist, currentHist := mt.tempHist, mt.voltHist, mt.currentHist
+	cycles, peaks, ripple := mt.cycles, mt.peaks, mt.ripple
+
+	clear(energyByHour)
+	clear(energyByMinute)
+	clear(durationByHour)
+	for _, d := range []*distribution{tempDist, voltDist, currentDist} {
+		d.reset(options.ReservoirSize)
+	}
+	for _, h := range []*histogramBuilder{tempHist, voltHist, currentHist} {
+		h.reset(options.HistogramBuckets)
+	}
+	cycles.reset(options.CycleDeadbandNanoA)
+	peaks.reset(options.PeakThresholdWatts)
+	ripple.reset(options.RippleEMAAlpha)
+
+	*mt = metricsTracker{
+		options:        options,
+		energyByHour:   energyByHour,
+		energyByMinute: energyByMinute,
+		durationByHour: durationByHour,
+		firstTimestamp: true,
+		cycles:         cycles,
+		peaks:          peaks,
+		tempDist:       tempDist,
+		voltDist:       voltDist,
+		currentDist:    currentDist,
+		tempHist:       tempHist,
+		voltHist:       voltHist,
+		ripple:         ripple,
+		currentHist:    currentHist,
+		minTemp:        math.MaxFloat64,
+		maxTemp:        -math.MaxFloat64,
+		minVolt:        math.MaxFloat64,
+		maxVolt:        -math.MaxFloat64,
+		minCurrent:     math.MaxFloat64,
+		maxCurrent:     -math.MaxFloat64,
+	}
+}
+
+func (mt *metricsTracker) processRecord(record parser.EnemeterRecord, _ int) {
+	tempCelsius := float64(record.TempMiliCelsius) / 1000.0
+	volts := float64(record.VoltageMicroV) / 1000000.0
+	amps := float64(record.CurrentNanoA) / 1000000000.0
+
+	powerVolts := math.Abs(volts)
+
+	if mt.options.Location != nil {
+		record.Timestamp = record.Timestamp.In(mt.options.Location)
+	}
+
+	if mt.firstTimestamp {
+		mt.startTime = record.Timestamp
+		mt.firstRecord = record
+		mt.firstTimestamp = false
+	}
+
+	mt.endTime = record.Timestamp
+
+	mt.tempSum += tempCelsius
+	mt.tempCount++
+	mt.tempDist.add(tempCelsius)
+	mt.tempHist.add(tempCelsius)
+	if tempCelsius < mt.minTemp {
+		mt.minTemp = tempCelsius
+	}
+	if tempCelsius > mt.maxTemp {
+		mt.maxTemp = tempCelsius
+	}
+
+	mt.voltSum += volts
+	mt.voltCount++
+	mt.voltDist.add(volts)
+	mt.voltHist.add(volts)
+	mt.ripple.add(volts)
+	if volts < mt.minVolt {
+		mt.minVolt = volts
+	}
+	if volts > mt.maxVolt {
+		mt.maxVolt = volts
+	}
+
+	mt.currentSum += amps
+	mt.currentCount++
+	mt.currentDist.add(amps)
+	mt.currentHist.add(amps)
+	mt.correlation.add(volts, amps, tempCelsius)
+	if amps < mt.minCurrent {
+		mt.minCurrent = amps
+	}
+	if amps > mt.maxCurrent {
+		mt.maxCurrent = amps
+	}
+
+	if amps < 0 && !mt.options.DisableBattery && math.Abs(amps) > mt.maxDischarge {
+		mt.maxDischarge = math.Abs(amps)
+	} else if amps > 0 && !mt.options.DisableSolar && amps > mt.maxCharging {
+		mt.maxCharging = amps
+	}
+
+	instantPower := powerVolts * amps
+
+	if math.Abs(instantPower) > mt.peakPower {
+		mt.peakPower = math.Abs(instantPower)
+	}
+
+	if mt.prevRecord != nil || (mt.dataPoints == 0 && mt.options.CountFirstInterval) {
+		durationSecs := float64(record.TimeDeltaMs) / 1000.0
+		mt.totalDurationMs += record.TimeDeltaMs
+
+		mt.deltaCount++
+		mt.deltaSumSq += float64(record.TimeDeltaMs) * float64(record.TimeDeltaMs)
+		if record.TimeDeltaMs > mt.maxObservedDeltaMs {
+			mt.maxObservedDeltaMs = record.TimeDeltaMs
+		}
+		if record.TimeDeltaMs > gapThresholdMs {
+			mt.gapDurationMs += record.TimeDeltaMs
+		}
+
+		if durationSecs > 0 && mt.prevRecord != nil {
+			tempChange := tempCelsius - float64(mt.prevRecord.TempMiliCelsius)/1000.0
+			mt.tempChangeSum += tempChange
+			mt.tempChangeTime += durationSecs
+			if rate := tempChange / durationSecs; rate > mt.peakTempRiseRate {
+				mt.peakTempRiseRate = rate
+			}
+		}
+
+		joules := instantPower * durationSecs
+		mt.totalJoules += joules
+
+		mt.totalPower += instantPower
+
+		hourOfDay := record.Timestamp.Hour()
+		mt.energyByHour[hourOfDay] += joules
+		mt.energyByMinute[hourOfDay*60+record.Timestamp.Minute()] += joules
+		mt.durationByHour[hourOfDay] += float64(record.TimeDeltaMs)
+
+		if record.CurrentNanoA > mt.options.ChargeCurrentThresholdNanoA {
+			mt.efficiencyInputJ += math.Abs(joules)
+		} else if -record.CurrentNanoA > mt.options.LoadCurrentThresholdNanoA {
+			mt.efficiencyOutputJ += math.Abs(joules)
+		}
+
+		if amps < 0 {
+			if !mt.options.DisableBattery {
+				mt.totalDischargeTime += durationSecs
+				mt.totalDischargeEnergy += math.Abs(joules)
+				mt.dischargedAh += math.Abs(amps) * durationSecs / 3600
+			}
+		} else {
+			// Charge still counts towards the state of charge without solar stats
+			mt.chargedAh += amps * durationSecs / 3600
+			if !mt.options.DisableSolar {
+				mt.totalChargeTime += durationSecs
+				mt.totalChargeEnergy += joules
+			}
+		}
+	}
+
+	if !mt.options.DisableBattery {
+		mt.cycles.add(record)
+	}
+	mt.peaks.add(record)
+
+	mt.prevRecord = &record
+	mt.dataPoints++
+}
+
+// finalizeMetrics builds the result. The maps and slices are copies, so
+// the tracker can go on adding records or be reset afterwards.
+func (mt *metricsTracker) finalizeMetrics() EnergyMetrics {
+	metrics := EnergyMetrics{
+		EnergyConsumptionByHour:   maps.Clone(mt.energyByHour),
+		EnergyConsumptionByMinute: maps.Clone(mt.energyByMinute),
+		DataPoints:                mt.dataPoints,
+		SamplingMethod:            mt.options.SamplingMethod,
+		TimeRange: TimeRange{
+			StartTime: mt.startTime,
+			EndTime:   mt.endTime,
+		},
+	}
+
+	durationSeconds := float64(mt.totalDurationMs) / 1000.0
+	metrics.TotalJoules = mt.totalJoules
+	metrics.PeakPowerWatts = mt.peakPower
+	metrics.DurationSeconds = durationSeconds
+
+	if durationSeconds > 0 {
+		metrics.AveragePowerWatts = mt.totalJoules / durationSeconds
+	}
+
+	if metrics.AveragePowerWatts != 0 {
+		metrics.PeakToAveragePowerRatio = metrics.PeakPowerWatts / math.Abs(metrics.AveragePowerWatts)
+		metrics.CrestFactor = math.Sqrt(metrics.PeakToAveragePowerRatio)
+	}
+
+	if durationSeconds > 0 {
+		secondsPerDay := 24 * 60 * 60
+		metrics.JoulesPerDay = mt.totalJoules * (float64(secondsPerDay) / durationSeconds)
+	}
+
+	metrics.DataCompletenessScore = mt.dataCompleteness()
+	metrics.DataQuality = dataQualityLabel(metrics.DataCompletenessScore)
+	metrics.MaxTimeDeltaMs = mt.maxObservedDeltaMs
+	metrics.FirstRecord = mt.firstRecord
+	if mt.prevRecord != nil {
+		metrics.LastRecord = *mt.prevRecord
+	}
+
+	metrics.HourlyEnergyEntropy = hourlyEntropy(mt.energyByHour)
+	metrics.HourlyEnergyEntropyNormalized = metrics.HourlyEnergyEntropy / math.Log2(24)
+
+	metrics.Correlations = mt.correlation.matrix()
+	metrics.VoltageHistogram = mt.voltHist.histogram()
+	metrics.CurrentHistogram = mt.currentHist.histogram()
+	metrics.TemperatureHistogram = mt.tempHist.histogram()
+	metrics.PeakEvents = slices.Clone(mt.peaks.powerEvents())
+
+	if mt.options.RequireCompleteHours {
+		metrics.EnergyConsumptionByHour, metrics.PartialHoursExcluded = mt.completeHours()
+	}
+
+	if mt.tempCount > 0 {
+		metrics.TemperatureStats = TemperatureStats{
+			MinTempCelsius: mt.minTemp,
+			MaxTempCelsius: mt.maxTemp,
+			AvgTempCelsius: mt.tempSum / float64(mt.tempCount),
+
+			TempRateOfChangePeakPerSec: mt.peakTempRiseRate,
+		}
+
+		if mt.tempChangeTime > 0 {
+			metrics.TemperatureStats.TempRateOfChangePerSec = mt.tempChangeSum / mt.tempChangeTime
+		}
+
+		threshold := mt.options.ThermalRunawayThreshold
+		if threshold <= 0 {
+			threshold = DefaultThermalRunawayThreshold
+		}
+		metrics.TemperatureStats.TempThermalRunawayRisk = mt.peakTempRiseRate > threshold
+
+		p := mt.tempDist.percentiles(25, 50, 75, 95, 99)
+		metrics.TemperatureStats.StdDev = mt.tempDist.stdDev()
+		metrics.TemperatureStats.P25, metrics.TemperatureStats.P50, metrics.TemperatureStats.P75 = p[0], p[1], p[2]
+		metrics.TemperatureStats.P95, metrics.TemperatureStats.P99 = p[3], p[4]
+		metrics.TemperatureStats.MedianTempCelsius = p[1]
+	}
+
+	if mt.voltCount > 0 {
+		metrics.VoltageStats = VoltageStats{
+			MinVoltage: mt.minVolt,
+			MaxVoltage: mt.maxVolt,
+			AvgVoltage: mt.voltSum / float64(mt.voltCount),
+			StdDev:     mt.voltDist.stdDev(),
+
+			RippleAmplitudeV: mt.ripple.amplitude(),
+			RippleRmsV:       mt.ripple.rms(),
+		}
+
+		p := mt.voltDist.percentiles(25, 50, 75, 95, 99)
+		metrics.VoltageStats.P25, metrics.VoltageStats.P50, metrics.VoltageStats.P75 = p[0], p[1], p[2]
+		metrics.VoltageStats.P95, metrics.VoltageStats.P99 = p[3], p[4]
+		metrics.VoltageStats.MedianVoltage = p[1]
+	}
+
+	if mt.currentCount > 0 {
+		metrics.CurrentStats = CurrentStats{
+			MinCurrent:   mt.minCurrent,
+			MaxCurrent:   mt.maxCurrent,
+			AvgCurrent:   mt.currentSum / float64(mt.currentCount),
+			MaxDischarge: mt.maxDischarge,
+			MaxCharging:  mt.maxCharging,
+			StdDev:       mt.currentDist.stdDev(),
+		}
+
+		p := mt.currentDist.percentiles(25, 50, 75, 95, 99)
+		metrics.CurrentStats.P25, metrics.CurrentStats.P50, metrics.CurrentStats.P75 = p[0], p[1], p[2]
+		metrics.CurrentStats.P95, metrics.CurrentStats.P99 = p[3], p[4]
+		metrics.CurrentStats.MedianCurrent = p[1]
+	}
+
+	if !mt.options.DisableBattery {
+		metrics.BatteryStats = BatteryStats{
+			TotalDischargeTime: mt.totalDischargeTime,
+			TotalChargeTime:    mt.totalChargeTime,
+		}
+
+		totalTime := mt.totalDischargeTime + mt.totalChargeTime
+		if totalTime > 0 {
+			metrics.BatteryStats.DischargeToChargeRatio = mt.totalDischargeTime / totalTime
+		}
+
+		if mt.totalDischargeTime > 0 {
+			metrics.BatteryStats.AverageDischargeRate = mt.totalDischargeEnergy / mt.totalDischargeTime
+			metrics.BatteryStats.DischargePowerAvg = metrics.BatteryStats.AverageDischargeRate
+		}
+
+		if mt.options.NominalCapacityAh > 0 {
+			consumed := math.Max(0, mt.dischargedAh-mt.chargedAh)
+			metrics.BatteryStats.ConsumedCapacityAh = consumed
+			metrics.BatteryStats.EstimatedSoCPercent = math.Max(0, 100*(1-consumed/mt.options.NominalCapacityAh))
+		}
+
+		metrics.BatteryStats.Cycles = slices.Clone(mt.cycles.segments)
+		metrics.BatteryStats.CycleCount = mt.cycles.dischargeCount()
+
+		if mt.totalChargeTime > 0 && mt.totalChargeEnergy > 0 {
+			metrics.BatteryStats.ChargePowerAvg = mt.totalChargeEnergy / mt.totalChargeTime
+			metrics.BatteryStats.PowerAsymmetryRatio = metrics.BatteryStats.DischargePowerAvg / metrics.BatteryStats.ChargePowerAvg
+		}
+	}
+
+	metrics.EfficiencyStats = EfficiencyStats{
+		InputEnergyJ:  mt.efficiencyInputJ,
+		OutputEnergyJ: mt.efficiencyOutputJ,
+		LossesJ:       mt.efficiencyInputJ - mt.efficiencyOutputJ,
+	}
+	if mt.efficiencyInputJ > 0 {
+		metrics.EfficiencyStats.EfficiencyPercent = mt.efficiencyOutputJ / mt.efficiencyInputJ * 100
+	}
+
+	if !mt.options.DisableSolar {
+		metrics.SolarStats = SolarStats{
+			TotalEnergyProduced: mt.totalChargeEnergy,
+		}
+
+		if mt.totalChargeTime > 0 {
+			metrics.SolarStats.AverageOutput = mt.totalChargeEnergy / mt.totalChargeTime
+		}
+
+		metrics.SolarStats.PeakOutput = mt.maxCharging
+
+		totalEnergy := mt.totalDischargeEnergy + mt.totalChargeEnergy
+		if totalEnergy > 0 {
+			metrics.SolarStats.ContributionPercentage = (mt.totalChargeEnergy / totalEnergy) * 100
+		}
+	}
+
+	return metrics
+}
+
+// completeHours returns a copy of the hourly energy map without the hours
+// that hold less than an hour of data, plus the excluded hours in order.
+// The tracker's own map is left intact for dataCompleteness.
+func (mt *metricsTracker) completeHours() (map[int]float64, []int) {
+	complete := make(map[int]float64, len(mt.energyByHour))
+	var excluded []int
+
+	for hour, joules := range mt.energyByHour {
+		if mt.durationByHour[hour] < 60*60*1000 {
+			excluded = append(excluded, hour)
+			continue
+		}
+		complete[hour] = joules
+	}
+
+	sort.Ints(excluded)
+	return complete, excluded
+}
+
+// hourlyEntropy returns the Shannon entropy in bits of the share of energy
+// spent in each hour of day: 0 when everything happens in one hour and
+// log2(24) when all hours consume the same. Magnitudes are used so charging
+// hours do not cancel out discharging ones.
+func hourlyEntropy(energyByHour map[int]float64) float64 {
+	// Sum in hour order; map order would make the last bits vary between runs
+	total := 0.0
+	for hour := 0; hour < 24; hour++ {
+		total += math.Abs(energyByHour[hour])
+	}
+	if total == 0 {
+		return 0
+	}
+
+	entropy := 0.0
+	for hour := 0; hour < 24; hour++ {
+		p := math.Abs(energyByHour[hour]) / total
+		if p > 0 {
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+// gapThresholdMs is the time delta above which an interval counts as a gap
+// in the data rather than a regular sample
+const gapThresholdMs = 60 * 1000
+
+// dataCompleteness scores how representative the data is as a weighted
+// combination of hour-of-day coverage (only for sessions of a day or more),
+// the share of time not spent in gaps, the share of rows without parse
+// errors (MetricsOptions.InvalidRows) and the uniformity of the sample
+// spacing.
+func (mt *metricsTracker) dataCompleteness() float64 {
+	if mt.deltaCount == 0 || mt.totalDurationMs <= 0 {
+		return 0
+	}
+
+	hourCoverage := 1.0
+	if mt.totalDurationMs >= 24*60*60*1000 {
+		hourCoverage = float64(len(mt.energyByHour)) / 24
+	}
+
+	gapFree := 1 - float64(mt.gapDurationMs)/float64(mt.totalDurationMs)
+
+	errorFree := 1.0
+	if invalid := max(mt.options.InvalidRows, 0); invalid > 0 {
+		errorFree = float64(mt.dataPoints) / float64(mt.dataPoints+invalid)
+	}
+
+	// Coefficient of variation of the time deltas; 0 for perfectly even spacing
+	meanDelta := float64(mt.totalDurationMs) / float64(mt.deltaCount)
+	variance := mt.deltaSumSq/float64(mt.deltaCount) - meanDelta*meanDelta
+	uniformity := 1.0
+	if variance > 0 {
+		uniformity = 1 / (1 + math.Sqrt(variance)/meanDelta)
+	}
+
+	score := 0.25*hourCoverage + 0.35*gapFree + 0.15*errorFree + 0.25*uniformity
+	return math.Max(0, math.Min(1, score))
+}
+
+func dataQualityLabel(score float64) string {
+	switch {
+	case score >= 0.9:
+		return "excellent"
+	case score >= 0.7:
+		return "good"
+	case score >= 0.5:
+		return "fair"
+	default:
+		return "poor"
+	}
+}
+
+// GetSpecificMetric returns the part of metrics named by metricType
+func GetSpecificMetric(metrics EnergyMetrics, metricType MetricType) (interface{}, error) {
+	switch metricType {
+	case MetricTotalEnergy:
+		return metrics.TotalJoules, nil
+	case MetricAveragePower:
+		return metrics.AveragePowerWatts, nil
+	case MetricPeakPower:
+		return metrics.PeakPowerWatts, nil
+	case MetricTemperature:
+		return metrics.TemperatureStats, nil
+	case MetricEnergyByHour:
+		return metrics.EnergyConsumptionByHour, nil
+	case MetricEnergyByMinute:
+		return metrics.EnergyConsumptionByMinute, nil
+	case MetricVoltageStats:
+		return metrics.VoltageStats, nil
+	case MetricCurrentStats:
+		return metrics.CurrentStats, nil
+	case MetricBatteryDischarge:
+		return metrics.BatteryStats, nil
+	case MetricSolarContribution:
+		return metrics.SolarStats, nil
+	case MetricPAPR:
+		return PAPRStats{
+			PAPR:        metrics.PeakToAveragePowerRatio,
+			CrestFactor: metrics.CrestFactor,
+		}, nil
+	case MetricEfficiency:
+		return metrics.EfficiencyStats, nil
+	default:
+		return nil, fmt.Errorf("unknown metric type: %s", metricType)
+	}
+}
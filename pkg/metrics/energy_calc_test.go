@@ -0,0 +1,378 @@
+package metrics
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"enemeter-data-processing/pkg/parser"
+)
+
+var testStart = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+// reading is one record in SI units: V, A and °C
+type reading struct {
+	deltaMs int64
+	volts   float64
+	amps    float64
+	celsius float64
+}
+
+// buildRecords converts readings into records with their timestamps
+// accumulated from start
+func buildRecords(start time.Time, readings []reading) []parser.EnemeterRecord {
+	records := make([]parser.EnemeterRecord, len(readings))
+	timestamp := start
+	for i, r := range readings {
+		timestamp = timestamp.Add(time.Duration(r.deltaMs) * time.Millisecond)
+		records[i] = parser.EnemeterRecord{
+			TimeDeltaMs:     r.deltaMs,
+			VoltageMicroV:   int64(math.Round(r.volts * 1e6)),
+			CurrentNanoA:    int64(math.Round(r.amps * 1e9)),
+			TempMiliCelsius: int64(math.Round(r.celsius * 1e3)),
+			Timestamp:       timestamp,
+		}
+	}
+	return records
+}
+
+// steadyReadings returns n readings deltaMs apart at 3.7 V, 1 A and 25 °C
+func steadyReadings(n int, deltaMs int64) []reading {
+	readings := make([]reading, n)
+	for i := range readings {
+		readings[i] = reading{deltaMs, 3.7, 1, 25}
+	}
+	return readings
+}
+
+func calculate(readings []reading, options MetricsOptions) EnergyMetrics {
+	return NewEnergyCalculator(buildRecords(testStart, readings)).WithOptions(options).CalculateMetrics()
+}
+
+func approxEqual(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestDataCompleteness(t *testing.T) {
+	withGaps := func(gaps int) []reading {
+		readings := steadyReadings(600, 1000)
+		for i := 0; i < gaps; i++ {
+			readings[100*(i+1)].deltaMs = 5 * 60 * 1000
+		}
+		return readings
+	}
+
+	// Every case scores lower than the one before it
+	tests := []struct {
+		name     string
+		readings []reading
+		invalid  int
+	}{
+		{"even spacing", steadyReadings(600, 1000), 0},
+		{"invalid rows", steadyReadings(600, 1000), 60},
+		{"one gap", withGaps(1), 0},
+		{"three gaps", withGaps(3), 0},
+		{"three gaps and invalid rows", withGaps(3), 60},
+	}
+
+	previous := math.Inf(1)
+	for _, tt := range tests {
+		m := calculate(tt.readings, MetricsOptions{InvalidRows: tt.invalid})
+		if m.DataCompletenessScore >= previous {
+			t.Errorf("%s: score %.4f does not decrease from %.4f", tt.name, m.DataCompletenessScore, previous)
+		}
+		if m.DataCompletenessScore < 0 || m.DataCompletenessScore > 1 {
+			t.Errorf("%s: score %.4f out of range", tt.name, m.DataCompletenessScore)
+		}
+		previous = m.DataCompletenessScore
+	}
+
+	if m := calculate(steadyReadings(600, 1000), MetricsOptions{}); m.DataCompletenessScore != 1 || m.DataQuality != "excellent" {
+		t.Errorf("even spacing scores %.4f (%s), want 1 (excellent)", m.DataCompletenessScore, m.DataQuality)
+	}
+}
+
+func TestRequireCompleteHours(t *testing.T) {
+	// A reading every minute from start to end
+	session := func(start, end time.Time) []parser.EnemeterRecord {
+		readings := []reading{{0, 3.7, 1, 25}}
+		readings = append(readings, steadyReadings(int(end.Sub(start)/time.Minute), 60*1000)...)
+		return buildRecords(start, readings)
+	}
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name         string
+		records      []parser.EnemeterRecord
+		require      bool
+		wantHours    []int
+		wantExcluded []int
+	}{
+		{"90 minutes kept", session(at(10, 15), at(11, 45)), false, []int{10, 11}, nil},
+		{"90 minutes excluded", session(at(10, 15), at(11, 45)), true, nil, []int{10, 11}},
+		{"complete middle hour", session(at(10, 15), at(12, 45)), true, []int{11}, []int{10, 12}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewEnergyCalculator(tt.records).WithOptions(MetricsOptions{RequireCompleteHours: tt.require}).CalculateMetrics()
+
+			var hours []int
+			for hour := 0; hour < 24; hour++ {
+				if _, ok := m.EnergyConsumptionByHour[hour]; ok {
+					hours = append(hours, hour)
+				}
+			}
+			if !reflect.DeepEqual(hours, tt.wantHours) {
+				t.Errorf("hours = %v, want %v", hours, tt.wantHours)
+			}
+			if !reflect.DeepEqual(m.PartialHoursExcluded, tt.wantExcluded) {
+				t.Errorf("PartialHoursExcluded = %v, want %v", m.PartialHoursExcluded, tt.wantExcluded)
+			}
+		})
+	}
+}
+
+func TestPowerAsymmetry(t *testing.T) {
+	// Alternating charge and discharge readings, one second each
+	alternating := func(chargeA, dischargeA float64) []reading {
+		readings := []reading{{0, 3.7, chargeA, 25}}
+		for i := 0; i < 100; i++ {
+			readings = append(readings, reading{1000, 3.7, -dischargeA, 25}, reading{1000, 3.7, chargeA, 25})
+		}
+		return readings
+	}
+
+	tests := []struct {
+		name          string
+		readings      []reading
+		wantRatio     float64
+		wantDischarge float64
+	}{
+		{"symmetric", alternating(1, 1), 1, 3.7},
+		{"fast discharge", alternating(0.5, 2), 4, 7.4},
+		{"charge only", steadyReadings(10, 1000), 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := calculate(tt.readings, MetricsOptions{}).BatteryStats
+			if !approxEqual(b.PowerAsymmetryRatio, tt.wantRatio, 1e-9) {
+				t.Errorf("PowerAsymmetryRatio = %v, want %v", b.PowerAsymmetryRatio, tt.wantRatio)
+			}
+			if tt.wantDischarge > 0 && !approxEqual(b.DischargePowerAvg, tt.wantDischarge, 1e-9) {
+				t.Errorf("DischargePowerAvg = %v, want %v", b.DischargePowerAvg, tt.wantDischarge)
+			}
+		})
+	}
+}
+
+func TestPeakToAveragePowerRatio(t *testing.T) {
+	// One second at 10 W and nine seconds without load average to 1 W
+	burst := func(amps float64) []reading {
+		readings := []reading{{0, 10, 0, 25}}
+		for i := 0; i < 9; i++ {
+			readings = append(readings, reading{1000, 10, 0, 25})
+		}
+		return append(readings, reading{1000, 10, amps, 25})
+	}
+
+	tests := []struct {
+		name      string
+		readings  []reading
+		wantPAPR  float64
+		wantCrest float64
+	}{
+		{"constant power", steadyReadings(100, 1000), 1, 1},
+		{"peak 10x average", burst(1), 10, math.Sqrt(10)},
+		{"discharge peak 10x average", burst(-1), 10, math.Sqrt(10)},
+		{"no power", burst(0), 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := calculate(tt.readings, MetricsOptions{})
+			if !approxEqual(m.PeakToAveragePowerRatio, tt.wantPAPR, 1e-9) {
+				t.Errorf("PeakToAveragePowerRatio = %v, want %v", m.PeakToAveragePowerRatio, tt.wantPAPR)
+			}
+			if !approxEqual(m.CrestFactor, tt.wantCrest, 1e-9) {
+				t.Errorf("CrestFactor = %v, want %v", m.CrestFactor, tt.wantCrest)
+			}
+
+			papr, err := GetSpecificMetric(m, MetricPAPR)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if papr != (PAPRStats{PAPR: m.PeakToAveragePowerRatio, CrestFactor: m.CrestFactor}) {
+				t.Errorf("MetricPAPR = %+v", papr)
+			}
+		})
+	}
+}
+
+func TestHourlyEnergyEntropy(t *testing.T) {
+	midnight := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	minutes := func(n int) []reading {
+		return append([]reading{{0, 3.7, 1, 25}}, steadyReadings(n, 60*1000)...)
+	}
+
+	tests := []struct {
+		name           string
+		start          time.Time
+		readings       []reading
+		wantEntropy    float64
+		wantNormalized float64
+	}{
+		{"single hour", testStart, minutes(30), 0, 0},
+		{"uniform day", midnight, minutes(24 * 60), math.Log2(24), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewEnergyCalculator(buildRecords(tt.start, tt.readings)).CalculateMetrics()
+			if !approxEqual(m.HourlyEnergyEntropy, tt.wantEntropy, 1e-9) {
+				t.Errorf("HourlyEnergyEntropy = %v, want %v", m.HourlyEnergyEntropy, tt.wantEntropy)
+			}
+			if !approxEqual(m.HourlyEnergyEntropyNormalized, tt.wantNormalized, 1e-9) {
+				t.Errorf("HourlyEnergyEntropyNormalized = %v, want %v", m.HourlyEnergyEntropyNormalized, tt.wantNormalized)
+			}
+		})
+	}
+}
+
+func TestThermalRunawayRisk(t *testing.T) {
+	// Ten seconds at 25 °C, then a ramp of ratePerSec for five seconds
+	ramp := func(ratePerSec float64) []reading {
+		readings := steadyReadings(10, 1000)
+		for i := 1; i <= 5; i++ {
+			readings = append(readings, reading{1000, 3.7, 1, 25 + ratePerSec*float64(i)})
+		}
+		return readings
+	}
+
+	tests := []struct {
+		name      string
+		readings  []reading
+		threshold float64
+		wantPeak  float64
+		wantRisk  bool
+	}{
+		{"steady", steadyReadings(10, 1000), 0, 0, false},
+		{"slow rise", ramp(0.5), 0, 0.5, false},
+		{"5 °C/s ramp", ramp(5), 0, 5, true},
+		{"5 °C/s ramp below threshold", ramp(5), 10, 5, false},
+		{"falling", ramp(-5), 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			temp := calculate(tt.readings, MetricsOptions{ThermalRunawayThreshold: tt.threshold}).TemperatureStats
+			if !approxEqual(temp.TempRateOfChangePeakPerSec, tt.wantPeak, 1e-9) {
+				t.Errorf("TempRateOfChangePeakPerSec = %v, want %v", temp.TempRateOfChangePeakPerSec, tt.wantPeak)
+			}
+			if temp.TempThermalRunawayRisk != tt.wantRisk {
+				t.Errorf("TempThermalRunawayRisk = %v, want %v", temp.TempThermalRunawayRisk, tt.wantRisk)
+			}
+		})
+	}
+}
+
+func TestStateOfCharge(t *testing.T) {
+	// Hours at a constant current each, one reading per minute
+	hours := func(amps ...float64) []reading {
+		readings := []reading{{0, 3.7, 0, 25}}
+		for _, a := range amps {
+			for i := 0; i < 60; i++ {
+				readings = append(readings, reading{60 * 1000, 3.7, a, 25})
+			}
+		}
+		return readings
+	}
+
+	tests := []struct {
+		name         string
+		readings     []reading
+		options      MetricsOptions
+		wantConsumed float64
+		wantSoC      float64
+	}{
+		{"disabled", hours(-1), MetricsOptions{}, 0, 0},
+		{"quarter discharged", hours(-0.5), MetricsOptions{NominalCapacityAh: 2}, 0.5, 75},
+		{"charge given back", hours(-1, 0.5), MetricsOptions{NominalCapacityAh: 2}, 0.5, 75},
+		{"charge given back without solar stats", hours(-1, 0.5), MetricsOptions{NominalCapacityAh: 2, DisableSolar: true}, 0.5, 75},
+		{"never above full", hours(-0.5, 1), MetricsOptions{NominalCapacityAh: 2}, 0, 100},
+		{"never below empty", hours(-3), MetricsOptions{NominalCapacityAh: 2}, 3, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := calculate(tt.readings, tt.options).BatteryStats
+			if !approxEqual(b.ConsumedCapacityAh, tt.wantConsumed, 1e-9) {
+				t.Errorf("ConsumedCapacityAh = %v, want %v", b.ConsumedCapacityAh, tt.wantConsumed)
+			}
+			if !approxEqual(b.EstimatedSoCPercent, tt.wantSoC, 1e-9) {
+				t.Errorf("EstimatedSoCPercent = %v, want %v", b.EstimatedSoCPercent, tt.wantSoC)
+			}
+		})
+	}
+}
+
+func TestEnergyCalculatorReuse(t *testing.T) {
+	// A day of charge and discharge cycles with drifting temperature
+	cycling := func(n int, deltaMs int64) []reading {
+		readings := make([]reading, n)
+		for i := range readings {
+			amps := 0.8
+			if i/50%2 == 1 {
+				amps = -1.5
+			}
+			readings[i] = reading{deltaMs, 3.5 + float64(i%40)*0.01, amps, 20 + float64(i%90)*0.1}
+		}
+		readings[0].deltaMs = 0
+		return readings
+	}
+	large := buildRecords(testStart, cycling(2000, 45000))
+	small := buildRecords(testStart.Add(-3*time.Hour), steadyReadings(30, 1000))
+
+	options := MetricsOptions{
+		TimeResolution:    time.Minute,
+		NominalCapacityAh: 2,
+		HistogramBuckets:  8,
+		ReservoirSize:     DefaultReservoirSize,
+	}
+	otherOptions := options
+	otherOptions.HistogramBuckets = 4
+	otherOptions.DisableSolar = true
+
+	tests := []struct {
+		name          string
+		first, second []parser.EnemeterRecord
+		secondOptions MetricsOptions
+	}{
+		{"large then small", large, small, options},
+		{"small then large", small, large, options},
+		{"same data twice", large, large, options},
+		{"other options", large, small, otherOptions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calculator := NewEnergyCalculator(tt.first).WithOptions(options)
+			calculator.CalculateMetrics()
+
+			calculator.Reset()
+			if m := calculator.CalculateMetrics(); !reflect.DeepEqual(m, EnergyMetrics{}) {
+				t.Errorf("metrics after Reset = %+v, want none", m)
+			}
+
+			got := calculator.WithRecords(tt.second).WithOptions(tt.secondOptions).CalculateMetrics()
+			want := NewEnergyCalculator(tt.second).WithOptions(tt.secondOptions).CalculateMetrics()
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("reused calculator gives\n%+v\nwant\n%+v", got, want)
+			}
+		})
+	}
+}
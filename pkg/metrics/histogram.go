@@ -0,0 +1,139 @@
+package metrics
+
+// DefaultHistogramBuckets is the number of histogram buckets used when
+// MetricsOptions leaves HistogramBuckets unset
+const DefaultHistogramBuckets = 20
+
+// Histogram counts how many readings fall into each of a set of equal-width
+// buckets. Bucket i covers [Edges[i], Edges[i+1]); the last bucket also
+// includes its upper edge.
+type Histogram struct {
+	Edges  []float64
+	Counts []int
+}
+
+// histogramBuilder fills a histogram in a single pass without keeping the
+// values. The range starts out fitted to the first two distinct values and
+// doubles whenever a value falls outside it, merging neighbouring buckets,
+// so the final buckets cover at most twice the observed range.
+type histogramBuilder struct {
+	counts []int
+	lower  float64
+	width  float64
+
+	// Until a second distinct value arrives the width is unknown and the
+	// values are only counted
+	first        float64
+	pendingCount int
+}
+
+func newHistogramBuilder(buckets int) *histogramBuilder {
+	if buckets <= 0 {
+		buckets = DefaultHistogramBuckets
+	}
+	return &histogramBuilder{counts: make([]int, buckets)}
+}
+
+func (b *histogramBuilder) add(value float64) {
+	if b.width == 0 {
+		if b.pendingCount == 0 || value == b.first {
+			b.first = value
+			b.pendingCount++
+			return
+		}
+
+		// Fit the range to the two values seen so far
+		b.lower = b.first
+		if value < b.lower {
+			b.lower = value
+		}
+		diff := value - b.first
+		if diff < 0 {
+			diff = -diff
+		}
+		b.width = diff / float64(len(b.counts))
+		b.counts[b.index(b.first)] += b.pendingCount
+		b.pendingCount = 0
+	}
+
+	for value < b.lower {
+		b.growDown()
+	}
+	for value > b.upper() {
+		b.growUp()
+	}
+	b.counts[b.index(value)]++
+}
+
+// reset forgets all values and sets the number of buckets
+func (b *histogramBuilder) reset(buckets int) {
+	if buckets <= 0 {
+		buckets = DefaultHistogramBuckets
+	}
+	if cap(b.counts) >= buckets {
+		b.counts = b.counts[:buckets]
+		clear(b.counts)
+	} else {
+		b.counts = make([]int, buckets)
+	}
+	b.lower, b.width, b.first, b.pendingCount = 0, 0, 0, 0
+}
+
+func (b *histogramBuilder) upper() float64 {
+	return b.lower + b.width*float64(len(b.counts))
+}
+
+func (b *histogramBuilder) index(value float64) int {
+	i := int((value - b.lower) / b.width)
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(b.counts) {
+		i = len(b.counts) - 1
+	}
+	return i
+}
+
+// growUp doubles the bucket width keeping the lower edge in place
+func (b *histogramBuilder) growUp() {
+	merged := make([]int, len(b.counts))
+	for i, count := range b.counts {
+		merged[i/2] += count
+	}
+	b.counts = merged
+	b.width *= 2
+}
+
+// growDown doubles the bucket width keeping the upper edge in place
+func (b *histogramBuilder) growDown() {
+	upper := b.upper()
+	last := len(b.counts) - 1
+	merged := make([]int, len(b.counts))
+	for i, count := range b.counts {
+		merged[last-(last-i)/2] += count
+	}
+	b.counts = merged
+	b.width *= 2
+	b.lower = upper - b.width*float64(len(b.counts))
+}
+
+// histogram returns the result; when all values were equal it has a single
+// bucket of zero width
+func (b *histogramBuilder) histogram() Histogram {
+	if b.width == 0 {
+		if b.pendingCount == 0 {
+			return Histogram{}
+		}
+		return Histogram{Edges: []float64{b.first, b.first}, Counts: []int{b.pendingCount}}
+	}
+
+	h := Histogram{
+		Edges:  make([]float64, len(b.counts)+1),
+		Counts: make([]int, len(b.counts)),
+	}
+	copy(h.Counts, b.counts)
+	for i := range h.Edges {
+		h.Edges[i] = b.lower + b.width*float64(i)
+	}
+	return h
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHistogramBuilder(t *testing.T) {
+	tests := []struct {
+		name       string
+		values     []float64
+		wantEdges  []float64
+		wantCounts []int
+	}{
+		{"empty", nil, nil, nil},
+		{"constant", []float64{3, 3, 3}, []float64{3, 3}, []int{3}},
+		{"fitted to the first two values", []float64{0, 4, 1, 2, 3}, []float64{0, 1, 2, 3, 4}, []int{1, 1, 1, 2}},
+		{"repeated first value", []float64{2, 2, 0}, []float64{0, 0.5, 1, 1.5, 2}, []int{1, 0, 0, 2}},
+		{"grown up", []float64{0, 4, 1, 2, 3, 6}, []float64{0, 2, 4, 6, 8}, []int{2, 3, 0, 1}},
+		{"grown down", []float64{0, 4, -4}, []float64{-4, -2, 0, 2, 4}, []int{1, 0, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newHistogramBuilder(4)
+			for _, value := range tt.values {
+				b.add(value)
+			}
+			h := b.histogram()
+			if !reflect.DeepEqual(h.Edges, tt.wantEdges) {
+				t.Errorf("Edges = %v, want %v", h.Edges, tt.wantEdges)
+			}
+			if !reflect.DeepEqual(h.Counts, tt.wantCounts) {
+				t.Errorf("Counts = %v, want %v", h.Counts, tt.wantCounts)
+			}
+
+			// A reset builder gives the same result again
+			b.reset(4)
+			for _, value := range tt.values {
+				b.add(value)
+			}
+			if again := b.histogram(); !reflect.DeepEqual(again, h) {
+				t.Errorf("after reset %+v, want %+v", again, h)
+			}
+		})
+	}
+}
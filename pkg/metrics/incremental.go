@@ -0,0 +1,35 @@
+package metrics
+
+import "enemeter-data-processing/pkg/parser"
+
+// IncrementalCalculator keeps a single metricsTracker across calls, so
+// records can be added as they arrive and the metrics read at any point
+// without reprocessing what came before
+type IncrementalCalculator struct {
+	tracker *metricsTracker
+	count   int
+}
+
+// NewIncrementalCalculator creates an empty calculator
+func NewIncrementalCalculator(options MetricsOptions) *IncrementalCalculator {
+	return &IncrementalCalculator{tracker: newMetricsTracker(options)}
+}
+
+// Add processes the next record, which must not be older than the last
+func (c *IncrementalCalculator) Add(record parser.EnemeterRecord) {
+	c.tracker.processRecord(record, c.count)
+	c.count++
+}
+
+// Len returns the number of records added so far
+func (c *IncrementalCalculator) Len() int {
+	return c.count
+}
+
+// CalculateMetrics returns the metrics of all records added so far
+func (c *IncrementalCalculator) CalculateMetrics() EnergyMetrics {
+	if c.count == 0 {
+		return EnergyMetrics{}
+	}
+	return c.tracker.finalizeMetrics()
+}
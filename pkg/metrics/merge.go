@@ -0,0 +1,235 @@
+package metrics
+
+import (
+	"math"
+	"slices"
+	"sort"
+)
+
+// MergeMetrics combines the metrics of separate runs, such as one per input
+// file, into the metrics of all of them. Energies, durations, counts and
+// the hourly maps are added up, the time range is the union and extrema are
+// the global ones; averages and completeness are weighted by data points or
+// duration, and the standard deviations and correlations are pooled.
+// Percentiles, medians, histograms and the Coulomb-counting state of charge
+// depend on the order of all records and are left at zero when there is
+// more than one run.
+func MergeMetrics(runs []EnergyMetrics) EnergyMetrics {
+	switch len(runs) {
+	case 0:
+		return EnergyMetrics{}
+	case 1:
+		return runs[0]
+	}
+
+	merged := EnergyMetrics{
+		EnergyConsumptionByHour:   make(map[int]float64),
+		EnergyConsumptionByMinute: make(MinuteEnergy),
+		SamplingMethod:            runs[0].SamplingMethod,
+	}
+
+	var (
+		points      float64 // total data points, the weight of per-record averages
+		deltaWeight float64 // total duration, the weight of completeness
+		temp        pooledStats
+		volt        pooledStats
+		current     pooledStats
+		rippleSq    float64
+		tempRate    float64
+
+		dischargeEnergy float64
+		chargeEnergy    float64
+		seen            bool // a run with data points has been merged
+	)
+
+	for i, m := range runs {
+		merged.TotalJoules += m.TotalJoules
+		merged.DurationSeconds += m.DurationSeconds
+		merged.DataPoints += m.DataPoints
+		merged.PeakPowerWatts = max(merged.PeakPowerWatts, m.PeakPowerWatts)
+		merged.MaxTimeDeltaMs = max(merged.MaxTimeDeltaMs, m.MaxTimeDeltaMs)
+
+		for hour, joules := range m.EnergyConsumptionByHour {
+			merged.EnergyConsumptionByHour[hour] += joules
+		}
+		for minute, joules := range m.EnergyConsumptionByMinute {
+			merged.EnergyConsumptionByMinute[minute] += joules
+		}
+		merged.PartialHoursExcluded = append(merged.PartialHoursExcluded, m.PartialHoursExcluded...)
+		merged.PeakEvents = append(merged.PeakEvents, m.PeakEvents...)
+		merged.Anomalies = append(merged.Anomalies, m.Anomalies...)
+
+		if i == 0 || m.TimeRange.StartTime.Before(merged.TimeRange.StartTime) {
+			merged.TimeRange.StartTime = m.TimeRange.StartTime
+			merged.FirstRecord = m.FirstRecord
+		}
+		if i == 0 || m.TimeRange.EndTime.After(merged.TimeRange.EndTime) {
+			merged.TimeRange.EndTime = m.TimeRange.EndTime
+			merged.LastRecord = m.LastRecord
+		}
+
+		n := float64(m.DataPoints)
+		points += n
+		deltaWeight += m.DurationSeconds
+		merged.DataCompletenessScore += m.DataCompletenessScore * m.DurationSeconds
+
+		if m.DataPoints > 0 {
+			t, v, c := m.TemperatureStats, m.VoltageStats, m.CurrentStats
+			if !seen {
+				merged.TemperatureStats.MinTempCelsius, merged.TemperatureStats.MaxTempCelsius = t.MinTempCelsius, t.MaxTempCelsius
+				merged.VoltageStats.MinVoltage, merged.VoltageStats.MaxVoltage = v.MinVoltage, v.MaxVoltage
+				merged.CurrentStats.MinCurrent, merged.CurrentStats.MaxCurrent = c.MinCurrent, c.MaxCurrent
+				seen = true
+			}
+
+			merged.TemperatureStats.MinTempCelsius = min(merged.TemperatureStats.MinTempCelsius, t.MinTempCelsius)
+			merged.TemperatureStats.MaxTempCelsius = max(merged.TemperatureStats.MaxTempCelsius, t.MaxTempCelsius)
+			merged.TemperatureStats.TempRateOfChangePeakPerSec = max(merged.TemperatureStats.TempRateOfChangePeakPerSec, t.TempRateOfChangePeakPerSec)
+			merged.TemperatureStats.TempThermalRunawayRisk = merged.TemperatureStats.TempThermalRunawayRisk || t.TempThermalRunawayRisk
+			tempRate += t.TempRateOfChangePerSec * m.DurationSeconds
+			temp.add(n, t.AvgTempCelsius, t.StdDev)
+
+			merged.VoltageStats.MinVoltage = min(merged.VoltageStats.MinVoltage, v.MinVoltage)
+			merged.VoltageStats.MaxVoltage = max(merged.VoltageStats.MaxVoltage, v.MaxVoltage)
+			merged.VoltageStats.RippleAmplitudeV = max(merged.VoltageStats.RippleAmplitudeV, v.RippleAmplitudeV)
+			rippleSq += v.RippleRmsV * v.RippleRmsV * n
+			volt.add(n, v.AvgVoltage, v.StdDev)
+
+			merged.CurrentStats.MinCurrent = min(merged.CurrentStats.MinCurrent, c.MinCurrent)
+			merged.CurrentStats.MaxCurrent = max(merged.CurrentStats.MaxCurrent, c.MaxCurrent)
+			merged.CurrentStats.MaxDischarge = max(merged.CurrentStats.MaxDischarge, c.MaxDischarge)
+			merged.CurrentStats.MaxCharging = max(merged.CurrentStats.MaxCharging, c.MaxCharging)
+			current.add(n, c.AvgCurrent, c.StdDev)
+		}
+
+		b := m.BatteryStats
+		merged.BatteryStats.TotalDischargeTime += b.TotalDischargeTime
+		merged.BatteryStats.TotalChargeTime += b.TotalChargeTime
+		merged.BatteryStats.CycleCount += b.CycleCount
+		merged.BatteryStats.Cycles = append(merged.BatteryStats.Cycles, b.Cycles...)
+		dischargeEnergy += b.AverageDischargeRate * b.TotalDischargeTime
+		chargeEnergy += b.ChargePowerAvg * b.TotalChargeTime
+
+		merged.SolarStats.TotalEnergyProduced += m.SolarStats.TotalEnergyProduced
+		merged.SolarStats.PeakOutput = max(merged.SolarStats.PeakOutput, m.SolarStats.PeakOutput)
+
+		merged.EfficiencyStats.InputEnergyJ += m.EfficiencyStats.InputEnergyJ
+		merged.EfficiencyStats.OutputEnergyJ += m.EfficiencyStats.OutputEnergyJ
+	}
+
+	if merged.DurationSeconds > 0 {
+		merged.AveragePowerWatts = merged.TotalJoules / merged.DurationSeconds
+		merged.JoulesPerDay = merged.TotalJoules * (24 * 60 * 60 / merged.DurationSeconds)
+	}
+	if merged.AveragePowerWatts != 0 {
+		merged.PeakToAveragePowerRatio = merged.PeakPowerWatts / math.Abs(merged.AveragePowerWatts)
+		merged.CrestFactor = math.Sqrt(merged.PeakToAveragePowerRatio)
+	}
+	merged.HourlyEnergyEntropy = hourlyEntropy(merged.EnergyConsumptionByHour)
+	merged.HourlyEnergyEntropyNormalized = merged.HourlyEnergyEntropy / math.Log2(24)
+	sort.Ints(merged.PartialHoursExcluded)
+	merged.PartialHoursExcluded = slices.Compact(merged.PartialHoursExcluded)
+
+	if deltaWeight > 0 {
+		merged.DataCompletenessScore /= deltaWeight
+		merged.TemperatureStats.TempRateOfChangePerSec = tempRate / deltaWeight
+	}
+	merged.DataQuality = dataQualityLabel(merged.DataCompletenessScore)
+
+	if points > 0 {
+		merged.VoltageStats.RippleRmsV = math.Sqrt(rippleSq / points)
+		merged.TemperatureStats.AvgTempCelsius, merged.TemperatureStats.StdDev = temp.mean(), temp.stdDev()
+		merged.VoltageStats.AvgVoltage, merged.VoltageStats.StdDev = volt.mean(), volt.stdDev()
+		merged.CurrentStats.AvgCurrent, merged.CurrentStats.StdDev = current.mean(), current.stdDev()
+		merged.Correlations = mergeCorrelations(runs, merged)
+	}
+
+	b := &merged.BatteryStats
+	sort.SliceStable(b.Cycles, func(i, j int) bool { return b.Cycles[i].StartTime.Before(b.Cycles[j].StartTime) })
+	if totalTime := b.TotalDischargeTime + b.TotalChargeTime; totalTime > 0 {
+		b.DischargeToChargeRatio = b.TotalDischargeTime / totalTime
+	}
+	if b.TotalDischargeTime > 0 {
+		b.AverageDischargeRate = dischargeEnergy / b.TotalDischargeTime
+		b.DischargePowerAvg = b.AverageDischargeRate
+	}
+	if b.TotalChargeTime > 0 && chargeEnergy > 0 {
+		b.ChargePowerAvg = chargeEnergy / b.TotalChargeTime
+		b.PowerAsymmetryRatio = b.DischargePowerAvg / b.ChargePowerAvg
+	}
+
+	s := &merged.SolarStats
+	if b.TotalChargeTime > 0 {
+		s.AverageOutput = s.TotalEnergyProduced / b.TotalChargeTime
+	}
+	if totalEnergy := dischargeEnergy + s.TotalEnergyProduced; totalEnergy > 0 {
+		s.ContributionPercentage = s.TotalEnergyProduced / totalEnergy * 100
+	}
+
+	e := &merged.EfficiencyStats
+	e.LossesJ = e.InputEnergyJ - e.OutputEnergyJ
+	if e.InputEnergyJ > 0 {
+		e.EfficiencyPercent = e.OutputEnergyJ / e.InputEnergyJ * 100
+	}
+
+	return merged
+}
+
+// mergeCorrelations pools the correlations of the runs around the means of
+// merged. The covariance of every run follows from its coefficient and
+// standard deviations, so the result is exact.
+func mergeCorrelations(runs []EnergyMetrics, merged EnergyMetrics) CorrelationMatrix {
+	var m2V, m2C, m2T, coVC, coVT, coCT float64
+	for _, m := range runs {
+		if m.DataPoints == 0 {
+			continue
+		}
+		n := float64(m.DataPoints)
+		v, c, t := m.VoltageStats, m.CurrentStats, m.TemperatureStats
+		dV := v.AvgVoltage - merged.VoltageStats.AvgVoltage
+		dC := c.AvgCurrent - merged.CurrentStats.AvgCurrent
+		dT := t.AvgTempCelsius - merged.TemperatureStats.AvgTempCelsius
+
+		m2V += n * (v.StdDev*v.StdDev + dV*dV)
+		m2C += n * (c.StdDev*c.StdDev + dC*dC)
+		m2T += n * (t.StdDev*t.StdDev + dT*dT)
+		coVC += n * (m.Correlations.VoltageCurrent*v.StdDev*c.StdDev + dV*dC)
+		coVT += n * (m.Correlations.VoltageTemperature*v.StdDev*t.StdDev + dV*dT)
+		coCT += n * (m.Correlations.CurrentTemperature*c.StdDev*t.StdDev + dC*dT)
+	}
+	return CorrelationMatrix{
+		VoltageCurrent:     pearson(coVC, m2V, m2C),
+		VoltageTemperature: pearson(coVT, m2V, m2T),
+		CurrentTemperature: pearson(coCT, m2C, m2T),
+	}
+}
+
+// pooledStats combines the count, mean and standard deviation of several
+// samples
+type pooledStats struct {
+	n     float64
+	sum   float64
+	sumSq float64 // of the values, recovered from mean and variance
+}
+
+func (s *pooledStats) add(n, mean, stdDev float64) {
+	s.n += n
+	s.sum += n * mean
+	s.sumSq += n * (stdDev*stdDev + mean*mean)
+}
+
+func (s *pooledStats) mean() float64 {
+	if s.n == 0 {
+		return 0
+	}
+	return s.sum / s.n
+}
+
+// stdDev is the population standard deviation of all samples together
+func (s *pooledStats) stdDev() float64 {
+	if s.n == 0 {
+		return 0
+	}
+	mean := s.mean()
+	return math.Sqrt(math.Max(0, s.sumSq/s.n-mean*mean))
+}
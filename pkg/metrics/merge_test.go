@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMergeMetrics(t *testing.T) {
+	var readings []reading
+	for i := 0; i < 300; i++ {
+		x := float64(i)
+		readings = append(readings, reading{1000, 3.6 + 0.2*math.Sin(x/7), 1 + math.Cos(x/11) + x/300, 20 + x/30})
+	}
+	records := buildRecords(testStart, readings)
+	whole := NewEnergyCalculator(records).CalculateMetrics()
+
+	// Runs of different lengths with different means
+	var runs []EnergyMetrics
+	for _, bounds := range [][2]int{{0, 40}, {40, 190}, {190, 300}} {
+		runs = append(runs, NewEnergyCalculator(records[bounds[0]:bounds[1]]).CalculateMetrics())
+	}
+	merged := MergeMetrics(runs)
+
+	tests := []struct {
+		name      string
+		got, want float64
+	}{
+		{"data points", float64(merged.DataPoints), float64(whole.DataPoints)},
+		{"average voltage", merged.VoltageStats.AvgVoltage, whole.VoltageStats.AvgVoltage},
+		{"voltage std dev", merged.VoltageStats.StdDev, whole.VoltageStats.StdDev},
+		{"current std dev", merged.CurrentStats.StdDev, whole.CurrentStats.StdDev},
+		{"temperature std dev", merged.TemperatureStats.StdDev, whole.TemperatureStats.StdDev},
+		{"voltage-current correlation", merged.Correlations.VoltageCurrent, whole.Correlations.VoltageCurrent},
+		{"voltage-temperature correlation", merged.Correlations.VoltageTemperature, whole.Correlations.VoltageTemperature},
+		{"current-temperature correlation", merged.Correlations.CurrentTemperature, whole.Correlations.CurrentTemperature},
+		// Need every record and are not estimated from the runs
+		{"voltage median", merged.VoltageStats.MedianVoltage, 0},
+		{"current P95", merged.CurrentStats.P95, 0},
+		{"consumed capacity", merged.BatteryStats.ConsumedCapacityAh, 0},
+		{"state of charge", merged.BatteryStats.EstimatedSoCPercent, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !approxEqual(tt.got, tt.want, 1e-9) {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
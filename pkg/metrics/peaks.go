@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"math"
+	"time"
+
+	"enemeter-data-processing/pkg/parser"
+)
+
+// PowerEvent is one uninterrupted run of records whose power magnitude is
+// above MetricsOptions.PeakThresholdWatts
+type PowerEvent struct {
+	Timestamp  time.Time // first record of the run
+	DurationMs int64     // until the first record back under the threshold
+	PeakWatts  float64   // largest power magnitude in the run
+	VoltageV   float64   // voltage of the peak record
+	CurrentA   float64   // current of the peak record
+}
+
+// peakDetector collects the power events one record at a time
+type peakDetector struct {
+	thresholdWatts float64
+	events         []PowerEvent
+	open           *PowerEvent // the run still above the threshold, if any
+}
+
+func newPeakDetector(thresholdWatts float64) *peakDetector {
+	return &peakDetector{thresholdWatts: thresholdWatts}
+}
+
+// reset drops the events; like the cycle segments they may be held by an
+// earlier result
+func (d *peakDetector) reset(thresholdWatts float64) {
+	*d = peakDetector{thresholdWatts: thresholdWatts}
+}
+
+func (d *peakDetector) add(record parser.EnemeterRecord) {
+	if d.thresholdWatts <= 0 {
+		return
+	}
+
+	volts := float64(record.VoltageMicroV) / 1000000.0
+	amps := float64(record.CurrentNanoA) / 1000000000.0
+	watts := math.Abs(volts * amps)
+
+	if watts <= d.thresholdWatts {
+		if d.open != nil {
+			d.open.DurationMs = record.Timestamp.Sub(d.open.Timestamp).Milliseconds()
+			d.events = append(d.events, *d.open)
+			d.open = nil
+		}
+		return
+	}
+
+	if d.open == nil {
+		d.open = &PowerEvent{Timestamp: record.Timestamp}
+	}
+	// A run still open at the end of the data lasts until its last record
+	d.open.DurationMs = record.Timestamp.Sub(d.open.Timestamp).Milliseconds()
+	if watts > d.open.PeakWatts {
+		d.open.PeakWatts = watts
+		d.open.VoltageV = volts
+		d.open.CurrentA = amps
+	}
+}
+
+// powerEvents returns the events so far, including a run that has not ended
+// yet, without closing it so that more records can still be added
+func (d *peakDetector) powerEvents() []PowerEvent {
+	if d.open == nil {
+		return d.events
+	}
+	events := make([]PowerEvent, len(d.events), len(d.events)+1)
+	copy(events, d.events)
+	return append(events, *d.open)
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+
+	"enemeter-data-processing/pkg/parser"
+)
+
+// PercentileSet holds the exact percentiles of one channel
+type PercentileSet struct {
+	P5  float64
+	P25 float64
+	P50 float64
+	P75 float64
+	P95 float64
+}
+
+// percentile returns the p-th percentile (0-100) of an ascending slice using
+// linear interpolation between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+
+	weight := rank - float64(lower)
+	return sorted[lower]*(1-weight) + sorted[upper]*weight
+}
+
+func newPercentileSet(values []float64) PercentileSet {
+	sort.Float64s(values)
+	return PercentileSet{
+		P5:  percentile(values, 5),
+		P25: percentile(values, 25),
+		P50: percentile(values, 50),
+		P75: percentile(values, 75),
+		P95: percentile(values, 95),
+	}
+}
+
+// applyExactPercentiles makes a second pass over in-memory records and fills
+// the exact percentiles of each channel.
+func applyExactPercentiles(metrics *EnergyMetrics, records []parser.EnemeterRecord) {
+	volts := make([]float64, len(records))
+	amps := make([]float64, len(records))
+	temps := make([]float64, len(records))
+
+	for i, record := range records {
+		volts[i] = float64(record.VoltageMicroV) / 1000000.0
+		amps[i] = float64(record.CurrentNanoA) / 1000000000.0
+		temps[i] = float64(record.TempMiliCelsius) / 1000.0
+	}
+
+	metrics.VoltageStats.ExactPercentiles = newPercentileSet(volts)
+	metrics.CurrentStats.ExactPercentiles = newPercentileSet(amps)
+	metrics.TemperatureStats.ExactPercentiles = newPercentileSet(temps)
+}
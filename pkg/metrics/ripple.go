@@ -0,0 +1,73 @@
+package metrics
+
+import "math"
+
+// DefaultRippleEMAAlpha is the smoothing factor of the moving average the
+// voltage ripple is measured against
+const DefaultRippleEMAAlpha = 0.05
+
+// rippleTracker measures the AC component of the voltage as the deviation
+// of every reading from an exponential moving average of the readings
+// before it
+type rippleTracker struct {
+	alpha   float64
+	ema     float64
+	started bool
+
+	count  int
+	sumSq  float64
+	minDev float64
+	maxDev float64
+}
+
+func newRippleTracker(alpha float64) *rippleTracker {
+	r := &rippleTracker{}
+	r.reset(alpha)
+	return r
+}
+
+// reset forgets all readings; an alpha outside (0, 1] uses
+// DefaultRippleEMAAlpha
+func (r *rippleTracker) reset(alpha float64) {
+	if alpha <= 0 || alpha > 1 {
+		alpha = DefaultRippleEMAAlpha
+	}
+	*r = rippleTracker{alpha: alpha}
+}
+
+func (r *rippleTracker) add(volts float64) {
+	// The first reading only seeds the average
+	if !r.started {
+		r.ema = volts
+		r.started = true
+		return
+	}
+
+	deviation := volts - r.ema
+	r.ema += r.alpha * deviation
+
+	if r.count == 0 || deviation < r.minDev {
+		r.minDev = deviation
+	}
+	if r.count == 0 || deviation > r.maxDev {
+		r.maxDev = deviation
+	}
+	r.sumSq += deviation * deviation
+	r.count++
+}
+
+// amplitude returns the peak-to-peak deviation in volts
+func (r *rippleTracker) amplitude() float64 {
+	if r.count == 0 {
+		return 0
+	}
+	return r.maxDev - r.minDev
+}
+
+// rms returns the root mean square deviation in volts
+func (r *rippleTracker) rms() float64 {
+	if r.count == 0 {
+		return 0
+	}
+	return math.Sqrt(r.sumSq / float64(r.count))
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRippleTracker(t *testing.T) {
+	tests := []struct {
+		name          string
+		alpha         float64
+		volts         []float64
+		wantAmplitude float64
+		wantRms       float64
+	}{
+		{"no readings", 0.5, nil, 0, 0},
+		{"single reading", 0.5, []float64{3.7}, 0, 0},
+		{"constant", 0.5, []float64{3.7, 3.7, 3.7}, 0, 0},
+		// Deviations -2 from 4 and +1 from the average of 3
+		{"hand computed", 0.5, []float64{4, 2, 4}, 3, math.Sqrt(2.5)},
+		// Alpha 1 follows the previous reading, so the deviations are the
+		// steps between readings
+		{"alpha 1", 1, []float64{3.6, 3.8, 3.6, 3.8}, 0.4, 0.2},
+		{"invalid alpha uses the default", 2, []float64{4, 2, 4}, 2 + 2*DefaultRippleEMAAlpha, math.Sqrt((4 + math.Pow(2*DefaultRippleEMAAlpha, 2)) / 2)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRippleTracker(tt.alpha)
+			for _, volts := range tt.volts {
+				r.add(volts)
+			}
+			if !approxEqual(r.amplitude(), tt.wantAmplitude, 1e-9) {
+				t.Errorf("amplitude = %v, want %v", r.amplitude(), tt.wantAmplitude)
+			}
+			if !approxEqual(r.rms(), tt.wantRms, 1e-9) {
+				t.Errorf("rms = %v, want %v", r.rms(), tt.wantRms)
+			}
+		})
+	}
+}
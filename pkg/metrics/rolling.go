@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"time"
+
+	"enemeter-data-processing/pkg/parser"
+)
+
+// RollingCalculator computes metrics over the most recent records of an
+// unbounded stream. Records older than the window (measured back from the
+// newest record) are discarded so memory stays bounded in long sessions.
+type RollingCalculator struct {
+	window  time.Duration
+	options MetricsOptions
+	records []parser.EnemeterRecord
+	start   int // index of the oldest record still inside the window
+}
+
+// NewRollingCalculator creates a calculator keeping the given window of
+// records. A zero window keeps every record.
+func NewRollingCalculator(window time.Duration) *RollingCalculator {
+	return &RollingCalculator{
+		window: window,
+		options: MetricsOptions{
+			TimeResolution: time.Minute * 5,
+			ReservoirSize:  DefaultReservoirSize,
+		},
+	}
+}
+
+// WithOptions replaces the calculation options
+func (r *RollingCalculator) WithOptions(options MetricsOptions) *RollingCalculator {
+	r.options = options
+	return r
+}
+
+// SetInvalidRows sets how many input lines were skipped as invalid so far,
+// see MetricsOptions.InvalidRows
+func (r *RollingCalculator) SetInvalidRows(n int) {
+	r.options.InvalidRows = n
+}
+
+// Add appends a record and drops the records that left the window
+func (r *RollingCalculator) Add(record parser.EnemeterRecord) {
+	r.records = append(r.records, record)
+
+	if r.window <= 0 {
+		return
+	}
+
+	cutoff := record.Timestamp.Add(-r.window)
+	for r.start < len(r.records) && r.records[r.start].Timestamp.Before(cutoff) {
+		r.start++
+	}
+
+	// Compact once half of the buffer has expired to keep appends amortized
+	if r.start > len(r.records)/2 {
+		n := copy(r.records, r.records[r.start:])
+		r.records = r.records[:n]
+		r.start = 0
+	}
+}
+
+// Len returns the number of records currently inside the window
+func (r *RollingCalculator) Len() int {
+	return len(r.records) - r.start
+}
+
+// CalculateMetrics runs a fresh metricsTracker over the records in the window
+func (r *RollingCalculator) CalculateMetrics() EnergyMetrics {
+	if r.Len() == 0 {
+		return EnergyMetrics{}
+	}
+
+	tracker := newMetricsTracker(r.options)
+	for i, record := range r.records[r.start:] {
+		tracker.processRecord(record, i)
+	}
+
+	return tracker.finalizeMetrics()
+}
@@ -0,0 +1,682 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// EnemeterRecord is one reading in the raw units of the device: milliseconds,
+// millicelsius, microvolts and nanoamperes. Timestamp is reconstructed by the
+// parser.
+type EnemeterRecord struct {
+	TimeDeltaMs     int64
+	TempMiliCelsius int64
+	VoltageMicroV   int64
+	CurrentNanoA    int64
+	Timestamp       time.Time
+}
+
+// FilterOptions selects which records a parser passes on. StartTime is
+// required unless TimestampIsAbsoluteEpochMs is set.
+type FilterOptions struct {
+	StartTime      *time.Time
+	EndTime        *time.Time
+	SampleRate     int
+	MaxRecords     int
+	TempThreshold  *int64
+	VoltageRange   *[2]int64
+	CurrentRange   *[2]int64
+	SelectedFields []string
+
+	// RandomizeSampleOrder replaces every-Nth sampling with a uniform random
+	// sample of filteredRecords / SampleRate records, rounded up so that a
+	// sample of a few records is not empty. RandomSeed makes the
+	// selection reproducible; zero means a time-based seed.
+	RandomizeSampleOrder bool
+	RandomSeed           int64
+
+	// ExcludeZeroPower skips records whose voltage or current is exactly
+	// zero, which usually indicates a sensor dropout
+	ExcludeZeroPower bool
+
+	// MaxCurrentChangeRateAPerSec skips records whose current differs from
+	// the previous accepted record by more than this many amperes per
+	// second. Zero disables the filter.
+	MaxCurrentChangeRateAPerSec float64
+
+	// DropNonPositiveDelta skips records with a time delta of zero or less,
+	// and MaxTimeDeltaMs (when positive) records with a larger delta. Such
+	// deltas come from corrupted rows; a skipped record does not advance the
+	// reconstructed time of the records after it.
+	DropNonPositiveDelta bool
+	MaxTimeDeltaMs       int64
+
+	// TimestampIsAbsoluteEpochMs reads column 0 as milliseconds since the
+	// Unix epoch instead of a delta. TimeDeltaMs is derived from consecutive
+	// rows, and StartTime is ignored.
+	TimestampIsAbsoluteEpochMs bool
+
+	// Location is the time zone of the reconstructed timestamps; nil means
+	// UTC for epoch timestamps and the location of StartTime otherwise
+	Location *time.Location
+
+	// Compressed forces gzip decompression for files without a .gz
+	// extension; files ending in .gz are always decompressed
+	Compressed bool
+
+	// VoltageScaleFactor, CurrentScaleFactor and TempScaleFactor convert
+	// the raw column values of firmware that logs other units into µV, nA
+	// and m°C, e.g. 1000 for millivolts. They are applied before any
+	// filter; zero means 1.
+	VoltageScaleFactor float64
+	CurrentScaleFactor float64
+	TempScaleFactor    float64
+
+	// ColumnMapping maps the column names of a CSV header row to the
+	// CSVHeader names, e.g. "v_mv" to "voltage_uv", or to "" to ignore a
+	// column. Names are matched ignoring case. Without a header row the
+	// columns are read in CSVHeader order; with one, CSVHeader names and
+	// common aliases are recognized without a mapping and any other name
+	// is an error. A first row is a header if it has a non-numeric field
+	// and at least one name that is known or a key of the mapping.
+	ColumnMapping map[string]string
+
+	// GapCallback is called for every row whose time delta exceeds
+	// GapThresholdMs (when positive). Rows skipped by sequential sampling,
+	// MaxRecords or the time delta checks are not seen, while the time range
+	// and value filters only apply after the callback
+	GapThresholdMs int64
+	GapCallback    func(GapEvent)
+}
+
+// GapEvent describes a hole in the time series, usually a lost connection
+// or a reboot of the device
+type GapEvent struct {
+	RecordIndex int // 0-based row in the file of the record ending the gap
+	GapMs       int64
+	Start       time.Time
+	End         time.Time
+}
+
+// ParseStats counts the records dropped by filters during the last Parse or
+// StreamRecords call
+type ParseStats struct {
+	DroppedByZeroPower int
+	DroppedBySlew      int
+	DroppedByTimeDelta int
+}
+
+// CountMode selects how GetRecordCount counts the rows of a file
+type CountMode int
+
+const (
+	// CountModeEstimate extrapolates from the length of the first rows
+	CountModeEstimate CountMode = iota
+	// CountModeExact counts the lines of the whole file without parsing them
+	CountModeExact
+)
+
+// countBufferSize is the read size of the exact line count
+const countBufferSize = 8 * 1024
+
+// fileParser holds what CSVParser and JSONLParser share: reading a file
+// row by row and applying the FilterOptions. Only decoding the rows
+// differs between the formats.
+type fileParser struct {
+	filePath  string
+	options   FilterOptions
+	reader    io.Reader // set instead of filePath for stream input
+	readDone  bool      // reader has been consumed
+	stats     ParseStats
+	countMode CountMode
+	rows      func(r io.Reader, options FilterOptions) rowReader
+
+	// origin replaces StartTime as the time the deltas are accumulated
+	// from, and end is the reconstructed time of the last row read; both
+	// let ChainStreams continue one file where the previous one ended
+	origin *time.Time
+	end    *time.Time
+}
+
+// rowReader returns the next row of the input with the timestamp left for
+// the caller to reconstruct, or io.EOF at the end
+type rowReader func() (EnemeterRecord, error)
+
+func newFileParser(filePath string, rows func(r io.Reader, options FilterOptions) rowReader) fileParser {
+	return fileParser{
+		filePath: filePath,
+		options: FilterOptions{
+			SampleRate: 1,
+		},
+		rows: rows,
+	}
+}
+
+// ErrNotAFile is returned by GetFileSize and GetRecordCount of a parser
+// created from a reader, which has no size to look at
+var ErrNotAFile = errors.New("input is a stream, not a file")
+
+// CSVParser reads the four-column ENEMETER CSV format:
+// time delta in ms, voltage in µV, current in nA and temperature in m°C
+type CSVParser struct {
+	fileParser
+}
+
+// NewCSVParser creates a parser for the file at filePath. Set at least
+// FilterOptions.StartTime with WithFilterOptions before reading.
+func NewCSVParser(filePath string) *CSVParser {
+	return &CSVParser{newFileParser(filePath, csvRows)}
+}
+
+// NewCSVParserFromReader creates a parser that reads r, e.g. os.Stdin,
+// with startTime as the start time. r can only be read once; replacing the
+// filter options with WithFilterOptions replaces the start time as well.
+func NewCSVParserFromReader(r io.Reader, startTime time.Time) *CSVParser {
+	p := &CSVParser{newFileParser("", csvRows)}
+	p.reader = r
+	p.options.StartTime = &startTime
+	return p
+}
+
+// WithFilterOptions replaces the filter options
+func (p *CSVParser) WithFilterOptions(options FilterOptions) *CSVParser {
+	p.options = options
+	return p
+}
+
+// WithCountMode sets how GetRecordCount counts the rows
+func (p *CSVParser) WithCountMode(mode CountMode) *CSVParser {
+	p.countMode = mode
+	return p
+}
+
+// csvRows reads the four comma-separated columns of every row. A first
+// row with a non-numeric field and a known column name is a header: its
+// column names select the columns by name, see FilterOptions.ColumnMapping.
+func csvRows(r io.Reader, options FilterOptions) rowReader {
+	reader := csv.NewReader(r)
+	firstRow := true
+	var order []int // positions of the CSVHeader columns, nil without a header
+	fields := make([]string, len(CSVHeader))
+	return func() (EnemeterRecord, error) {
+		row, err := reader.Read()
+		if firstRow && err == nil && isHeaderRow(row, options.ColumnMapping) {
+			if order, err = columnOrder(row, options.ColumnMapping); err != nil {
+				return EnemeterRecord{}, err
+			}
+			row, err = reader.Read()
+		}
+		firstRow = false
+		if err == io.EOF {
+			return EnemeterRecord{}, err
+		}
+		if err != nil {
+			return EnemeterRecord{}, fmt.Errorf("error reading CSV row: %w", err)
+		}
+		if order != nil {
+			row = reorderRow(fields, row, order)
+		}
+		return parseRow(row)
+	}
+}
+
+// Parse returns all records that pass the filters
+func (p *fileParser) Parse() ([]EnemeterRecord, error) {
+	var records []EnemeterRecord
+
+	collect := func(record EnemeterRecord) error {
+		records = append(records, record)
+		return nil
+	}
+
+	if p.options.RandomizeSampleOrder && p.options.SampleRate > 1 {
+		if err := p.readRecords(false, collect); err != nil {
+			return nil, err
+		}
+		return reservoirSample(records, p.randomSampleSize(len(records)), p.newRand()), nil
+	}
+
+	if err := p.readRecords(true, collect); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// randomSampleSize returns the size of the random sample of filtered records
+func (p *fileParser) randomSampleSize(filtered int) int {
+	return (filtered + p.options.SampleRate - 1) / p.options.SampleRate
+}
+
+// Stats returns the filter statistics of the last Parse or StreamRecords
+func (p *fileParser) Stats() ParseStats {
+	return p.stats
+}
+
+// GetFileSize returns the size of the input file in bytes, or -1 and
+// ErrNotAFile for a reader
+func (p *fileParser) GetFileSize() (int64, error) {
+	if p.reader != nil {
+		return -1, ErrNotAFile
+	}
+	fileInfo, err := os.Stat(p.filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get file info: %w", err)
+	}
+	return fileInfo.Size(), nil
+}
+
+// GetRecordCount returns the number of rows of the file, estimated or
+// counted depending on the CountMode. A reader cannot be counted without
+// consuming it, so it returns -1 and ErrNotAFile.
+func (p *fileParser) GetRecordCount() (int, error) {
+	if p.reader != nil {
+		return -1, ErrNotAFile
+	}
+
+	// The compressed size says little about the number of rows, so
+	// compressed input is counted in full instead of estimated
+	if p.countMode == CountModeExact || isCompressed(p.filePath, p.options.Compressed) {
+		return p.countRecords()
+	}
+
+	file, err := os.Open(p.filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			if err == nil {
+				err = closeErr
+			}
+		}
+	}()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get file info: %w", err)
+	}
+	fileSize := fileInfo.Size()
+
+	// Average the length of the first rows; blank lines are not rows
+	scanner := bufio.NewScanner(file)
+	lineCount := 0
+	bytesRead := int64(0)
+
+	for lineCount < 100 && scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		bytesRead += int64(len(scanner.Bytes()) + 1)
+		lineCount++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("error reading file: %w", err)
+	}
+
+	if lineCount == 0 {
+		return 0, nil
+	}
+
+	avgLineSize := bytesRead / int64(lineCount)
+	estimatedRecords := fileSize / avgLineSize
+
+	return int(estimatedRecords), nil
+}
+
+// countRecords returns the number of lines of the whole input, counting
+// newline bytes instead of parsing rows. A last line without a trailing
+// newline is counted too.
+func (p *fileParser) countRecords() (int, error) {
+	input, err := openInput(p.filePath, p.options.Compressed)
+	if err != nil {
+		return 0, err
+	}
+	defer input.Close()
+
+	buf := make([]byte, countBufferSize)
+	count := 0
+	var last byte = '\n'
+	for {
+		n, err := input.Read(buf)
+		if n > 0 {
+			count += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error reading file: %w", err)
+		}
+	}
+	if last != '\n' {
+		count++
+	}
+
+	return count, nil
+}
+
+// StreamRecords passes the records that pass the filters to callback one at
+// a time, without keeping them in memory
+func (p *fileParser) StreamRecords(callback func(record EnemeterRecord) error) error {
+	if !p.options.RandomizeSampleOrder || p.options.SampleRate <= 1 {
+		return p.readRecords(true, callback)
+	}
+
+	// Without a record count to size the reservoir a reader is sampled
+	// the way Parse does it, with every record in memory
+	if p.reader != nil {
+		records, err := p.Parse()
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := callback(record); err != nil {
+				return fmt.Errorf("callback error: %w", err)
+			}
+		}
+		return nil
+	}
+
+	// A reservoir needs its size up front. A first pass counts the records
+	// that pass the filters, so the sample has the size Parse gives it and
+	// memory stays bounded by the sample size.
+	filtered := 0
+	if err := p.readRecords(false, func(EnemeterRecord) error {
+		filtered++
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	sampler := newReservoir(p.randomSampleSize(filtered), p.newRand())
+	if err := p.readRecords(false, func(record EnemeterRecord) error {
+		sampler.add(record)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, record := range sampler.sorted() {
+		if err := callback(record); err != nil {
+			return fmt.Errorf("callback error: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readRecords reads the file row by row, applies the configured filters and
+// passes every accepted record to emit. Sequential sampling (every Nth row)
+// is only applied when sequential is true.
+func (p *fileParser) readRecords(sequential bool, emit func(record EnemeterRecord) error) error {
+	input, err := p.open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := input.Close(); closeErr != nil {
+			if err == nil {
+				err = fmt.Errorf("error closing file: %w", closeErr)
+			}
+		}
+	}()
+
+	return p.scanRecords(input, sequential, emit)
+}
+
+// open opens the input file, or hands out the reader the first time
+func (p *fileParser) open() (io.ReadCloser, error) {
+	if p.reader == nil {
+		return openInput(p.filePath, p.options.Compressed)
+	}
+	if p.readDone {
+		return nil, fmt.Errorf("input stream has already been read")
+	}
+	p.readDone = true
+
+	if !p.options.Compressed {
+		return io.NopCloser(p.reader), nil
+	}
+	gz, err := gzip.NewReader(p.reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+	}
+	return gz, nil
+}
+
+// scanRecords does the work of readRecords on an already opened input
+func (p *fileParser) scanRecords(input io.Reader, sequential bool, emit func(record EnemeterRecord) error) error {
+	next := p.rows(CRLFStrip(input), p.options)
+
+	epochMs := p.options.TimestampIsAbsoluteEpochMs
+	if p.options.StartTime == nil && !epochMs {
+		return fmt.Errorf("start time must be provided")
+	}
+
+	// Use the provided start time since it's required
+	var startTime time.Time
+	if p.options.StartTime != nil && !epochMs {
+		startTime = *p.options.StartTime
+	}
+	if p.origin != nil {
+		startTime = *p.origin
+	}
+
+	location := time.UTC
+	if p.options.Location != nil {
+		location = p.options.Location
+	}
+
+	accumulatedTimeMs := int64(0)
+	rowIndex := -1
+	prevEpochMs := int64(-1)
+	var prevAccepted *EnemeterRecord
+	recordCount := 0
+	sampleCounter := 0
+	p.stats = ParseStats{}
+	p.end = nil
+
+	for {
+		record, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rowIndex++
+		p.scaleUnits(&record)
+
+		if sequential {
+			sampleCounter++
+			if sampleCounter < p.options.SampleRate {
+				continue
+			}
+			sampleCounter = 0
+		}
+
+		if p.options.MaxRecords > 0 && recordCount >= p.options.MaxRecords {
+			break
+		}
+
+		if epochMs {
+			timestampMs := record.TimeDeltaMs
+			record.TimeDeltaMs = 0
+			if prevEpochMs >= 0 {
+				record.TimeDeltaMs = timestampMs - prevEpochMs
+				if p.badTimeDelta(record.TimeDeltaMs) {
+					p.stats.DroppedByTimeDelta++
+					continue
+				}
+			}
+			prevEpochMs = timestampMs
+			record.Timestamp = time.UnixMilli(timestampMs).In(location)
+		} else {
+			if p.badTimeDelta(record.TimeDeltaMs) {
+				p.stats.DroppedByTimeDelta++
+				continue
+			}
+			accumulatedTimeMs += record.TimeDeltaMs
+			record.Timestamp = startTime.Add(time.Duration(accumulatedTimeMs) * time.Millisecond)
+			if p.options.Location != nil {
+				record.Timestamp = record.Timestamp.In(location)
+			}
+			end := record.Timestamp
+			p.end = &end
+		}
+
+		if p.options.GapCallback != nil && p.options.GapThresholdMs > 0 && record.TimeDeltaMs > p.options.GapThresholdMs {
+			p.options.GapCallback(GapEvent{
+				RecordIndex: rowIndex,
+				GapMs:       record.TimeDeltaMs,
+				Start:       record.Timestamp.Add(-time.Duration(record.TimeDeltaMs) * time.Millisecond),
+				End:         record.Timestamp,
+			})
+		}
+
+		if !epochMs && p.options.StartTime != nil && record.Timestamp.Before(*p.options.StartTime) {
+			continue
+		}
+		if p.options.EndTime != nil && record.Timestamp.After(*p.options.EndTime) {
+			break
+		}
+
+		if p.options.TempThreshold != nil && record.TempMiliCelsius < *p.options.TempThreshold {
+			continue
+		}
+
+		if p.options.VoltageRange != nil && (record.VoltageMicroV < p.options.VoltageRange[0] || record.VoltageMicroV > p.options.VoltageRange[1]) {
+			continue
+		}
+
+		if p.options.CurrentRange != nil && (record.CurrentNanoA < p.options.CurrentRange[0] || record.CurrentNanoA > p.options.CurrentRange[1]) {
+			continue
+		}
+
+		// Compare the raw integers so exact zero needs no float tolerance
+		if p.options.ExcludeZeroPower && (record.VoltageMicroV == 0 || record.CurrentNanoA == 0) {
+			p.stats.DroppedByZeroPower++
+			continue
+		}
+
+		// Compare against the last accepted record so a single spike does
+		// not also reject the normal record that follows it
+		if p.options.MaxCurrentChangeRateAPerSec > 0 && prevAccepted != nil {
+			durationSec := record.Timestamp.Sub(prevAccepted.Timestamp).Seconds()
+			changeA := math.Abs(float64(record.CurrentNanoA-prevAccepted.CurrentNanoA)) / 1e9
+			if durationSec > 0 && changeA/durationSec > p.options.MaxCurrentChangeRateAPerSec {
+				p.stats.DroppedBySlew++
+				continue
+			}
+		}
+		accepted := record
+		prevAccepted = &accepted
+
+		if err := emit(record); err != nil {
+			return fmt.Errorf("callback error: %w", err)
+		}
+
+		recordCount++
+	}
+
+	return nil
+}
+
+// lastTimestamp returns the reconstructed time of the last row that
+// StreamRecords reads, or nil if there is none, without calling
+// GapCallback or changing Stats
+func (p *fileParser) lastTimestamp() (*time.Time, error) {
+	scan := *p
+	scan.options.GapCallback = nil
+	sequential := !p.options.RandomizeSampleOrder || p.options.SampleRate <= 1
+	if err := scan.readRecords(sequential, func(EnemeterRecord) error { return nil }); err != nil {
+		return nil, err
+	}
+	return scan.end, nil
+}
+
+// badTimeDelta reports whether the time delta filters reject a delta
+func (p *fileParser) badTimeDelta(deltaMs int64) bool {
+	if p.options.DropNonPositiveDelta && deltaMs <= 0 {
+		return true
+	}
+	return p.options.MaxTimeDeltaMs > 0 && deltaMs > p.options.MaxTimeDeltaMs
+}
+
+// scaleUnits applies the configured unit scale factors to a raw record
+func (p *fileParser) scaleUnits(record *EnemeterRecord) {
+	record.VoltageMicroV = scaleValue(record.VoltageMicroV, p.options.VoltageScaleFactor)
+	record.CurrentNanoA = scaleValue(record.CurrentNanoA, p.options.CurrentScaleFactor)
+	record.TempMiliCelsius = scaleValue(record.TempMiliCelsius, p.options.TempScaleFactor)
+}
+
+func scaleValue(value int64, factor float64) int64 {
+	if factor == 0 || factor == 1 {
+		return value
+	}
+	return int64(math.Round(float64(value) * factor))
+}
+
+// parseRow converts the four raw CSV fields into a record. The timestamp is
+// left for the caller to reconstruct.
+func parseRow(row []string) (EnemeterRecord, error) {
+	const (
+		timeCol    = 0
+		voltageCol = 1
+		currentCol = 2
+		tempCol    = 3
+	)
+
+	if len(row) != 4 {
+		return EnemeterRecord{}, fmt.Errorf("invalid row format, expected 4 fields but got %d", len(row))
+	}
+
+	timeDelta, err := strconv.ParseInt(row[timeCol], 10, 64)
+	if err != nil {
+		return EnemeterRecord{}, fmt.Errorf("failed to parse time delta: %w", err)
+	}
+
+	voltageMicroV, err := strconv.ParseInt(row[voltageCol], 10, 64)
+	if err != nil {
+		return EnemeterRecord{}, fmt.Errorf("failed to parse voltage: %w", err)
+	}
+
+	currentNanoA, err := strconv.ParseInt(row[currentCol], 10, 64)
+	if err != nil {
+		return EnemeterRecord{}, fmt.Errorf("failed to parse current: %w", err)
+	}
+
+	tempMiliCelsius, err := strconv.ParseInt(row[tempCol], 10, 64)
+	if err != nil {
+		return EnemeterRecord{}, fmt.Errorf("failed to parse temperature: %w", err)
+	}
+
+	return EnemeterRecord{
+		TimeDeltaMs:     timeDelta,
+		TempMiliCelsius: tempMiliCelsius,
+		VoltageMicroV:   voltageMicroV,
+		CurrentNanoA:    currentNanoA,
+	}, nil
+}
+
+// newRand returns the random source used for randomized sampling. A zero
+// seed picks a time-based one so that unseeded runs differ.
+func (p *fileParser) newRand() *rand.Rand {
+	seed := p.options.RandomSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
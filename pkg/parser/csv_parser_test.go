@@ -0,0 +1,184 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	// The time zone tests must not depend on the system database
+	_ "time/tzdata"
+)
+
+// parseRows parses rows with the given options, starting at testStart
+func parseRows(t *testing.T, rows []string, options FilterOptions) ([]EnemeterRecord, ParseStats) {
+	t.Helper()
+	if options.StartTime == nil && !options.TimestampIsAbsoluteEpochMs {
+		options.StartTime = &testStart
+	}
+	p := NewCSVParser(writeTestCSV(t, rows)).WithFilterOptions(options)
+	records, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records, p.Stats()
+}
+
+func TestExcludeZeroPower(t *testing.T) {
+	rows := []string{
+		"1000,3700000,1000000,25000",
+		"1000,0,1000000,25000",
+		"1000,3700000,0,25000",
+		"1000,0,0,25000",
+		"1000,3600000,-500000,25000",
+	}
+
+	tests := []struct {
+		name         string
+		exclude      bool
+		wantVoltages []int64
+		wantDropped  int
+	}{
+		{"kept by default", false, []int64{3700000, 0, 3700000, 0, 3600000}, 0},
+		{"zero voltage or current skipped", true, []int64{3700000, 3600000}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, stats := parseRows(t, rows, FilterOptions{ExcludeZeroPower: tt.exclude})
+			if got := voltages(records); !reflect.DeepEqual(got, tt.wantVoltages) {
+				t.Errorf("voltages = %v, want %v", got, tt.wantVoltages)
+			}
+			if stats.DroppedByZeroPower != tt.wantDropped {
+				t.Errorf("DroppedByZeroPower = %d, want %d", stats.DroppedByZeroPower, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestEpochTimestamps(t *testing.T) {
+	rows := []string{
+		"1704103200000,3700000,1000000,25000",
+		"1704103201000,3700000,1000000,25000",
+		"1704103201250,3700000,1000000,25000",
+		"1704103211250,3700000,1000000,25000",
+	}
+	first := time.UnixMilli(1704103200000)
+	later := first.Add(time.Hour)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		options  FilterOptions
+		wantZone string
+	}{
+		{"without start", FilterOptions{}, "UTC"},
+		{"start is ignored", FilterOptions{StartTime: &later}, "UTC"},
+		{"location", FilterOptions{Location: berlin}, "CET"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.options.TimestampIsAbsoluteEpochMs = true
+			records, _ := parseRows(t, rows, tt.options)
+
+			var deltas []int64
+			for _, record := range records {
+				deltas = append(deltas, record.TimeDeltaMs)
+			}
+			if want := []int64{0, 1000, 250, 10000}; !reflect.DeepEqual(deltas, want) {
+				t.Fatalf("deltas = %v, want %v", deltas, want)
+			}
+			if !records[0].Timestamp.Equal(first) || !records[3].Timestamp.Equal(first.Add(11250*time.Millisecond)) {
+				t.Errorf("timestamps %v to %v", records[0].Timestamp, records[3].Timestamp)
+			}
+			if zone, _ := records[0].Timestamp.Zone(); zone != tt.wantZone {
+				t.Errorf("zone = %s, want %s", zone, tt.wantZone)
+			}
+		})
+	}
+}
+
+func TestMaxCurrentChangeRate(t *testing.T) {
+	// Currents in A, one second apart
+	rows := []string{
+		"1000,3700000,1000000000,25000",
+		"1000,3700000,1000000000,25000",
+		"1000,3700000,1001000000000,25000",
+		"1000,3700000,1000000000,25000",
+		"1000,3700000,6000000000,25000",
+		"1000,3700000,6000000000,25000",
+	}
+
+	tests := []struct {
+		name         string
+		maxRate      float64
+		wantCurrents []int64
+		wantDropped  int
+	}{
+		{"disabled", 0, []int64{1e9, 1e9, 1001e9, 1e9, 6e9, 6e9}, 0},
+		{"spike dropped", 10, []int64{1e9, 1e9, 1e9, 6e9, 6e9}, 1},
+		// The second reading after the step is compared with the last
+		// accepted one, two seconds earlier
+		{"step dropped once", 4, []int64{1e9, 1e9, 1e9, 6e9}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, stats := parseRows(t, rows, FilterOptions{MaxCurrentChangeRateAPerSec: tt.maxRate})
+			var currents []int64
+			for _, record := range records {
+				currents = append(currents, record.CurrentNanoA)
+			}
+			if !reflect.DeepEqual(currents, tt.wantCurrents) {
+				t.Errorf("currents = %v, want %v", currents, tt.wantCurrents)
+			}
+			if stats.DroppedBySlew != tt.wantDropped {
+				t.Errorf("DroppedBySlew = %d, want %d", stats.DroppedBySlew, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestGapCallback(t *testing.T) {
+	rows := []string{
+		"1000,3700000,1000000,20000",
+		"90000,3700000,1000000,20000",
+		"1000,3700000,1000000,30000",
+		"-5000,3700000,1000000,30000",
+		"120000,3700000,1000000,20000",
+		"1000,3700000,1000000,30000",
+	}
+	threshold := int64(25000)
+
+	tests := []struct {
+		name     string
+		options  FilterOptions
+		wantRows []int
+	}{
+		{"all gaps", FilterOptions{}, []int{1, 4}},
+		{"before the value filters", FilterOptions{TempThreshold: &threshold}, []int{1, 4}},
+		{"after the time delta checks", FilterOptions{MaxTimeDeltaMs: 100000}, []int{1}},
+		{"after sequential sampling", FilterOptions{SampleRate: 2}, []int{1}},
+		{"after MaxRecords", FilterOptions{MaxRecords: 3}, []int{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gapRows []int
+			tt.options.GapThresholdMs = 60000
+			tt.options.GapCallback = func(gap GapEvent) {
+				gapRows = append(gapRows, gap.RecordIndex)
+				if gap.End.Sub(gap.Start) != time.Duration(gap.GapMs)*time.Millisecond {
+					t.Errorf("gap from %v to %v is not %d ms", gap.Start, gap.End, gap.GapMs)
+				}
+			}
+			parseRows(t, rows, tt.options)
+			if !reflect.DeepEqual(gapRows, tt.wantRows) {
+				t.Errorf("gaps at rows %v, want %v", gapRows, tt.wantRows)
+			}
+		})
+	}
+}
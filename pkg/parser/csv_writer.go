@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// CSVWriter writes records back out in the ENEMETER input column order
+// (time delta, voltage, current, temperature) so the result can be parsed again.
+type CSVWriter struct {
+	writer             *csv.Writer
+	absoluteTimestamps bool
+}
+
+// CSVHeader names the columns of the ENEMETER CSV format. The parser reads
+// a first row with these names as the header.
+var CSVHeader = []string{"time_delta_ms", "voltage_uv", "current_na", "temp_mc"}
+
+// TimestampColumn names the extra column added by WithAbsoluteTimestamps
+const TimestampColumn = "timestamp"
+
+// NewCSVWriter creates a writer of the ENEMETER CSV format
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{
+		writer: csv.NewWriter(w),
+	}
+}
+
+// WithAbsoluteTimestamps adds each record's timestamp in ISO-8601 format as
+// a fifth column. The parser ignores it when reading such files back.
+func (w *CSVWriter) WithAbsoluteTimestamps() *CSVWriter {
+	w.absoluteTimestamps = true
+	return w
+}
+
+// WriteHeader writes the column names
+func (w *CSVWriter) WriteHeader() error {
+	header := CSVHeader
+	if w.absoluteTimestamps {
+		header = append(append([]string(nil), CSVHeader...), TimestampColumn)
+	}
+	if err := w.writer.Write(header); err != nil {
+		return fmt.Errorf("error writing CSV header: %w", err)
+	}
+	return nil
+}
+
+// Write writes a single record
+func (w *CSVWriter) Write(record EnemeterRecord) error {
+	row := []string{
+		strconv.FormatInt(record.TimeDeltaMs, 10),
+		strconv.FormatInt(record.VoltageMicroV, 10),
+		strconv.FormatInt(record.CurrentNanoA, 10),
+		strconv.FormatInt(record.TempMiliCelsius, 10),
+	}
+	if w.absoluteTimestamps {
+		row = append(row, record.Timestamp.Format("2006-01-02T15:04:05.000Z07:00"))
+	}
+	if err := w.writer.Write(row); err != nil {
+		return fmt.Errorf("error writing CSV row: %w", err)
+	}
+	return nil
+}
+
+// WriteAll writes all records and flushes
+func (w *CSVWriter) WriteAll(records []EnemeterRecord) error {
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// Flush writes any buffered data to the underlying writer
+func (w *CSVWriter) Flush() error {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		return fmt.Errorf("error flushing CSV: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,4 @@
+// Package parser reads ENEMETER measurement files. CSVParser and JSONLParser
+// reconstruct the timestamps from the time deltas, apply FilterOptions and
+// either return all records or stream them one at a time.
+package parser
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+var errFollowStopped = errors.New("follow stopped")
+
+// followReader reads a file that is still being written. At the end of the
+// data it calls idle and polls again after interval instead of returning
+// io.EOF, so a row that is only half written is completed by a later read.
+// Closing stop ends the stream.
+type followReader struct {
+	r        io.Reader
+	stop     <-chan struct{}
+	interval time.Duration
+	idle     func()
+}
+
+func (f *followReader) Read(p []byte) (int, error) {
+	for {
+		select {
+		case <-f.stop:
+			return 0, errFollowStopped
+		default:
+		}
+
+		n, err := f.r.Read(p)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		if f.idle != nil {
+			f.idle()
+		}
+		select {
+		case <-f.stop:
+			return 0, errFollowStopped
+		case <-time.After(f.interval):
+		}
+	}
+}
+
+// FollowRecords passes every record of the file to callback like
+// StreamRecords, then keeps polling every pollInterval for rows appended to
+// the file until stop is closed. idle, if set, is called whenever all rows
+// written so far have been passed on. Random sampling is not supported and
+// compressed files cannot be followed.
+func (p *fileParser) FollowRecords(stop <-chan struct{}, pollInterval time.Duration, idle func(), callback func(record EnemeterRecord) error) error {
+	if p.reader != nil {
+		return fmt.Errorf("only files can be followed")
+	}
+	if isCompressed(p.filePath, p.options.Compressed) {
+		return fmt.Errorf("cannot follow compressed file %s", p.filePath)
+	}
+	if pollInterval <= 0 {
+		return fmt.Errorf("poll interval must be positive")
+	}
+
+	file, err := os.Open(p.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	input := &followReader{r: file, stop: stop, interval: pollInterval, idle: idle}
+	err = p.scanRecords(input, true, callback)
+	if errors.Is(err, errFollowStopped) {
+		return nil
+	}
+	return err
+}
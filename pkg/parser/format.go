@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Input formats understood by NewRecordParser
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// RecordParser is implemented by CSVParser and JSONLParser
+type RecordParser interface {
+	Parse() ([]EnemeterRecord, error)
+	StreamRecords(callback func(record EnemeterRecord) error) error
+	FollowRecords(stop <-chan struct{}, pollInterval time.Duration, idle func(), callback func(record EnemeterRecord) error) error
+	GetFileSize() (int64, error)
+	GetRecordCount() (int, error)
+	Stats() ParseStats
+}
+
+// DetectFormat picks the input format from the file name: .jsonl (also
+// gzipped) is JSON Lines, everything else CSV
+func DetectFormat(filePath string) string {
+	name := strings.TrimSuffix(strings.ToLower(filePath), ".gz")
+	if strings.HasSuffix(name, ".jsonl") {
+		return FormatJSONL
+	}
+	return FormatCSV
+}
+
+// NewRecordParser creates the parser for format, or for the format detected
+// from the file name when format is empty
+func NewRecordParser(filePath, format string, options FilterOptions, countMode CountMode) (RecordParser, error) {
+	if format == "" {
+		format = DetectFormat(filePath)
+	}
+
+	switch format {
+	case FormatCSV:
+		return NewCSVParser(filePath).WithFilterOptions(options).WithCountMode(countMode), nil
+	case FormatJSONL:
+		return NewJSONLParser(filePath).WithFilterOptions(options).WithCountMode(countMode), nil
+	default:
+		return nil, fmt.Errorf("unknown input format: %s", format)
+	}
+}
+
+// NewRecordParserFromReader creates the parser for format reading r, such
+// as os.Stdin. An empty format means CSV, since there is no file name.
+func NewRecordParserFromReader(r io.Reader, format string, options FilterOptions) (RecordParser, error) {
+	switch format {
+	case FormatCSV, "":
+		p := &CSVParser{newFileParser("", csvRows)}
+		p.reader = r
+		p.options = options
+		return p, nil
+	case FormatJSONL:
+		p := &JSONLParser{newFileParser("", jsonlRows)}
+		p.reader = r
+		p.options = options
+		return p, nil
+	default:
+		return nil, fmt.Errorf("unknown input format: %s", format)
+	}
+}
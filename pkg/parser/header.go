@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// columnAliases lists the header names the CSV parser recognizes for each
+// column, keyed by the CSVHeader name it maps to
+var columnAliases = map[string][]string{
+	"time_delta_ms": {"time_delta", "delta_ms", "dt_ms", "time_ms", "time", "timestamp"},
+	"voltage_uv":    {"voltage", "v_uv", "volt_uv", "voltage_microv"},
+	"current_na":    {"current", "i_na", "curr_na", "current_nanoa"},
+	"temp_mc":       {"temperature", "temp", "t_mc", "temp_millic", "temperature_mc"},
+}
+
+// isHeaderRow reports whether a first row holds column names: it needs a
+// field that is not an integer and at least one field that is a CSVHeader
+// name, an alias or a key of mapping. Any other row is left to the parser,
+// which reports it as a bad data row.
+func isHeaderRow(row []string, mapping map[string]string) bool {
+	numeric := true
+	known := false
+	for _, field := range row {
+		if _, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64); err != nil {
+			numeric = false
+		}
+		name := strings.ToLower(strings.TrimSpace(field))
+		if canonicalColumn(name) != "" {
+			known = true
+		}
+		for key := range mapping {
+			if strings.ToLower(strings.TrimSpace(key)) == name {
+				known = true
+			}
+		}
+	}
+	return !numeric && known
+}
+
+// columnOrder maps the names of a header row to the position of every
+// CSVHeader column in it. Names are looked up in mapping first, then in
+// CSVHeader and columnAliases, ignoring case. A name mapped to "" is an
+// ignored column, and so is an unmapped TimestampColumn next to a column
+// for the time deltas, as CSVWriter.WithAbsoluteTimestamps writes it.
+func columnOrder(header []string, mapping map[string]string) ([]int, error) {
+	// Lower-case the mapping keys once so that lookups ignore case
+	lowered := make(map[string]string, len(mapping))
+	for name, column := range mapping {
+		lowered[strings.ToLower(strings.TrimSpace(name))] = strings.ToLower(strings.TrimSpace(column))
+	}
+
+	columns := make([]string, len(header))
+	timestamp := -1 // position of an unmapped TimestampColumn
+	hasDelta := false
+	for i, field := range header {
+		name := strings.ToLower(strings.TrimSpace(field))
+
+		column, mapped := lowered[name]
+		if !mapped {
+			column = canonicalColumn(name)
+			if column == "" {
+				return nil, fmt.Errorf("unrecognized CSV column %q in header %v; add it to the column mapping as one of %v, or as \"\" to ignore it",
+					field, header, CSVHeader)
+			}
+		}
+		if !mapped && name == TimestampColumn {
+			timestamp = i
+		} else if column == CSVHeader[0] {
+			hasDelta = true
+		}
+		columns[i] = column
+	}
+	if hasDelta && timestamp >= 0 {
+		columns[timestamp] = ""
+	}
+
+	order := make([]int, len(CSVHeader))
+	for i := range order {
+		order[i] = -1
+	}
+
+	for i, field := range header {
+		column := columns[i]
+		if column == "" {
+			continue
+		}
+
+		target := headerIndex(column)
+		if target < 0 {
+			return nil, fmt.Errorf("column %q is mapped to %q, which is not one of %v", field, column, CSVHeader)
+		}
+		if order[target] >= 0 {
+			return nil, fmt.Errorf("CSV columns %q and %q both map to %s", header[order[target]], field, column)
+		}
+		order[target] = i
+	}
+
+	for target, position := range order {
+		if position < 0 {
+			return nil, fmt.Errorf("CSV header %v has no column for %s", header, CSVHeader[target])
+		}
+	}
+	return order, nil
+}
+
+// canonicalColumn returns the CSVHeader name of a lower-case header name,
+// or "" if it is not known
+func canonicalColumn(name string) string {
+	if headerIndex(name) >= 0 {
+		return name
+	}
+	for column, aliases := range columnAliases {
+		for _, alias := range aliases {
+			if name == alias {
+				return column
+			}
+		}
+	}
+	return ""
+}
+
+// headerIndex returns the position of a column in CSVHeader, or -1
+func headerIndex(column string) int {
+	for i, name := range CSVHeader {
+		if name == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// reorderRow picks the fields of a row into fields in CSVHeader order
+func reorderRow(fields, row []string, order []int) []string {
+	for i, position := range order {
+		fields[i] = row[position]
+	}
+	return fields
+}
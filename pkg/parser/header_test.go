@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsHeaderRow(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     []string
+		mapping map[string]string
+		want    bool
+	}{
+		{"data", []string{"1000", "3700000", "1000000", "25000"}, nil, false},
+		{"standard names", CSVHeader, nil, true},
+		{"aliases", []string{"time", "Voltage", " current ", "temp"}, nil, true},
+		{"one known name", []string{"delta", "voltage", "x", "y"}, nil, true},
+		{"mapped names", []string{"dt", "v_mv", "i_ma", "t_c"}, map[string]string{"V_MV": "voltage_uv"}, true},
+		{"corrupted data", []string{"1000", "3.7", "1000000", "25000"}, nil, false},
+		{"unknown names", []string{"a", "b", "c", "d"}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isHeaderRow(tt.row, tt.mapping); got != tt.want {
+				t.Errorf("isHeaderRow(%v) = %v, want %v", tt.row, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumnOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []string
+		mapping map[string]string
+		want    []int
+		wantErr bool
+	}{
+		{"standard", CSVHeader, nil, []int{0, 1, 2, 3}, false},
+		{"reordered aliases", []string{"temp", "current", "voltage", "time"}, nil, []int{3, 2, 1, 0}, false},
+		{"timestamp as the deltas", []string{"timestamp", "voltage_uv", "current_na", "temp_mc"}, nil, []int{0, 1, 2, 3}, false},
+		{"absolute timestamps skipped", append(append([]string(nil), CSVHeader...), TimestampColumn), nil, []int{0, 1, 2, 3}, false},
+		{"timestamp first and skipped", []string{"timestamp", "temp_mc", "current_na", "voltage_uv", "delta_ms"}, nil, []int{4, 3, 2, 1}, false},
+		{"mapped timestamp", []string{"timestamp", "time_delta_ms", "voltage_uv", "current_na", "temp_mc"}, map[string]string{"timestamp": "time_delta_ms"}, nil, true},
+		{"ignored column", []string{"note", "time_delta_ms", "voltage_uv", "current_na", "temp_mc"}, map[string]string{"note": ""}, []int{1, 2, 3, 4}, false},
+		{"duplicate", []string{"time", "delta_ms", "voltage_uv", "current_na", "temp_mc"}, nil, nil, true},
+		{"unknown column", []string{"time_delta_ms", "voltage_uv", "current_na", "temp_mc", "note"}, nil, nil, true},
+		{"missing column", []string{"time_delta_ms", "voltage_uv", "current_na"}, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := columnOrder(tt.header, tt.mapping)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("columnOrder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("columnOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
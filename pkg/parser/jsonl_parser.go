@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// JSONLParser reads JSON Lines input, one object per line with the fields
+// time_delta_ms, voltage_uv, current_na and temp_mc. It supports the same
+// FilterOptions as CSVParser.
+type JSONLParser struct {
+	fileParser
+}
+
+// NewJSONLParser creates a parser for the JSON Lines file at filePath
+func NewJSONLParser(filePath string) *JSONLParser {
+	return &JSONLParser{newFileParser(filePath, jsonlRows)}
+}
+
+// NewJSONLParserFromReader creates a parser that reads JSON Lines from r,
+// with startTime as the start time. See NewCSVParserFromReader.
+func NewJSONLParserFromReader(r io.Reader, startTime time.Time) *JSONLParser {
+	p := &JSONLParser{newFileParser("", jsonlRows)}
+	p.reader = r
+	p.options.StartTime = &startTime
+	return p
+}
+
+// WithFilterOptions replaces the filter options
+func (p *JSONLParser) WithFilterOptions(options FilterOptions) *JSONLParser {
+	p.options = options
+	return p
+}
+
+// WithCountMode sets how GetRecordCount counts the rows
+func (p *JSONLParser) WithCountMode(mode CountMode) *JSONLParser {
+	p.countMode = mode
+	return p
+}
+
+// jsonlRow uses pointers so that a missing field can be told from a zero
+type jsonlRow struct {
+	TimeDeltaMs *int64 `json:"time_delta_ms"`
+	VoltageUV   *int64 `json:"voltage_uv"`
+	CurrentNA   *int64 `json:"current_na"`
+	TempMC      *int64 `json:"temp_mc"`
+}
+
+// jsonlRows decodes one object per non-blank line
+func jsonlRows(r io.Reader, _ FilterOptions) rowReader {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	return func() (EnemeterRecord, error) {
+		for scanner.Scan() {
+			line++
+			data := bytes.TrimSpace(scanner.Bytes())
+			if len(data) == 0 {
+				continue
+			}
+			return parseJSONLRow(data, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return EnemeterRecord{}, fmt.Errorf("error reading JSONL line: %w", err)
+		}
+		return EnemeterRecord{}, io.EOF
+	}
+}
+
+func parseJSONLRow(data []byte, line int) (EnemeterRecord, error) {
+	var row jsonlRow
+	if err := json.Unmarshal(data, &row); err != nil {
+		return EnemeterRecord{}, fmt.Errorf("invalid JSON on line %d: %w", line, err)
+	}
+
+	fields := []struct {
+		name  string
+		value *int64
+	}{
+		{"time_delta_ms", row.TimeDeltaMs},
+		{"voltage_uv", row.VoltageUV},
+		{"current_na", row.CurrentNA},
+		{"temp_mc", row.TempMC},
+	}
+	for _, field := range fields {
+		if field.value == nil {
+			return EnemeterRecord{}, fmt.Errorf("line %d is missing field %s", line, field.name)
+		}
+	}
+
+	return EnemeterRecord{
+		TimeDeltaMs:     *row.TimeDeltaMs,
+		VoltageMicroV:   *row.VoltageUV,
+		CurrentNanoA:    *row.CurrentNA,
+		TempMiliCelsius: *row.TempMC,
+	}, nil
+}
@@ -0,0 +1,212 @@
+package parser
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// StreamFunc passes records one at a time to callback, like
+// RecordParser.StreamRecords
+type StreamFunc func(callback func(record EnemeterRecord) error) error
+
+// mergeBufferSize is the number of records read ahead from each input
+const mergeBufferSize = 256
+
+var errMergeStopped = errors.New("merge stopped")
+
+// MergeCSVParsers returns a stream of the records of all parsers in timestamp
+// order. Records that appear in more than one input with the same timestamp
+// and readings are passed on once; records that share a timestamp but
+// differ are all kept. TimeDeltaMs is recomputed from the merged timestamps
+// so that energy integration stays correct across inputs.
+func MergeCSVParsers(parsers []RecordParser) StreamFunc {
+	streams := make([]StreamFunc, len(parsers))
+	for i, p := range parsers {
+		streams[i] = p.StreamRecords
+	}
+	return MergeStreams(streams)
+}
+
+// ChainParsers returns a stream of the records of all parsers for inputs
+// with relative time deltas that continue each other, such as daily dumps:
+// every parser after the first accumulates its deltas from where the
+// previous one ended instead of from FilterOptions.StartTime, which remains
+// a filter. The inputs are then merged like MergeCSVParsers, so a dump that
+// repeats the last readings of the one before is counted once.
+func ChainParsers(parsers []RecordParser) StreamFunc {
+	return func(callback func(record EnemeterRecord) error) error {
+		streams, err := ChainStreams(parsers)
+		if err != nil {
+			return err
+		}
+		return mergeStreams(streams, callback)
+	}
+}
+
+// ChainStreams returns a stream per parser that continues from where the
+// previous parsers ended, like ChainParsers, while keeping the records of
+// every input apart. A first pass over every input but the last finds where
+// it ends, so the streams can then run in any order or concurrently.
+// Standard input can only be read once and must be the last input.
+func ChainStreams(parsers []RecordParser) ([]StreamFunc, error) {
+	streams := make([]StreamFunc, len(parsers))
+	var origin *time.Time
+	for i, p := range parsers {
+		streams[i] = p.StreamRecords
+
+		fp := chainedFileParser(p)
+		if fp == nil {
+			continue
+		}
+		fp.origin = origin
+		if i == len(parsers)-1 {
+			break
+		}
+		if fp.reader != nil {
+			return nil, fmt.Errorf("standard input must be the last of several inputs with time deltas")
+		}
+		end, err := fp.lastTimestamp()
+		if err != nil {
+			return nil, err
+		}
+		if end != nil {
+			origin = end
+		}
+	}
+	return streams, nil
+}
+
+// chainedFileParser returns the fileParser behind p, or nil for parsers
+// that cannot be chained
+func chainedFileParser(p RecordParser) *fileParser {
+	switch p := p.(type) {
+	case *CSVParser:
+		return &p.fileParser
+	case *JSONLParser:
+		return &p.fileParser
+	}
+	return nil
+}
+
+// MergeStreams merges already time-ordered streams, see MergeCSVParsers
+func MergeStreams(streams []StreamFunc) StreamFunc {
+	return func(callback func(record EnemeterRecord) error) error {
+		return mergeStreams(streams, callback)
+	}
+}
+
+type mergeHead struct {
+	record EnemeterRecord
+	input  int
+}
+
+// mergeHeap orders the next record of every input by timestamp, then by
+// input position so the merge is deterministic
+type mergeHeap []mergeHead
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].record.Timestamp.Equal(h[j].record.Timestamp) {
+		return h[i].input < h[j].input
+	}
+	return h[i].record.Timestamp.Before(h[j].record.Timestamp)
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeHead)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	head := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return head
+}
+
+func mergeStreams(streams []StreamFunc, callback func(record EnemeterRecord) error) error {
+	// Closing done unblocks the readers when the merge ends early
+	done := make(chan struct{})
+	defer close(done)
+
+	inputs := make([]chan EnemeterRecord, len(streams))
+	errs := make([]chan error, len(streams))
+	for i, stream := range streams {
+		inputs[i] = make(chan EnemeterRecord, mergeBufferSize)
+		errs[i] = make(chan error, 1)
+
+		go func(stream StreamFunc, out chan<- EnemeterRecord, errc chan<- error) {
+			err := stream(func(record EnemeterRecord) error {
+				select {
+				case out <- record:
+					return nil
+				case <-done:
+					return errMergeStopped
+				}
+			})
+			close(out)
+			errc <- err
+		}(stream, inputs[i], errs[i])
+	}
+
+	// next reads the following record of input i onto the heap, or reports
+	// the input's error once it is exhausted
+	h := &mergeHeap{}
+	next := func(i int) error {
+		record, ok := <-inputs[i]
+		if !ok {
+			return <-errs[i]
+		}
+		heap.Push(h, mergeHead{record: record, input: i})
+		return nil
+	}
+
+	for i := range streams {
+		if err := next(i); err != nil {
+			return err
+		}
+	}
+
+	type readings struct {
+		voltage, current, temp int64
+	}
+	seen := make(map[readings]bool)
+
+	var prev *EnemeterRecord
+	for h.Len() > 0 {
+		head := heap.Pop(h).(mergeHead)
+		record := head.record
+
+		if prev == nil || !record.Timestamp.Equal(prev.Timestamp) {
+			seen = make(map[readings]bool)
+		}
+		key := readings{record.VoltageMicroV, record.CurrentNanoA, record.TempMiliCelsius}
+
+		if !seen[key] {
+			seen[key] = true
+			if prev != nil {
+				record.TimeDeltaMs = record.Timestamp.Sub(prev.Timestamp).Milliseconds()
+			}
+			if err := callback(record); err != nil {
+				return err
+			}
+			prev = &record
+		}
+
+		if err := next(head.input); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MergedStats adds up the filter statistics of several parsers
+func MergedStats(parsers []RecordParser) ParseStats {
+	var total ParseStats
+	for _, p := range parsers {
+		stats := p.Stats()
+		total.DroppedByZeroPower += stats.DroppedByZeroPower
+		total.DroppedBySlew += stats.DroppedBySlew
+		total.DroppedByTimeDelta += stats.DroppedByTimeDelta
+	}
+	return total
+}
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// collect reads every record of stream
+func collect(t *testing.T, stream StreamFunc) []EnemeterRecord {
+	t.Helper()
+	var records []EnemeterRecord
+	err := stream(func(record EnemeterRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestChainParsers(t *testing.T) {
+	files := [][]string{
+		{"0,3700000,1000000,25000", "1000,3700000,1000000,25000", "2000,3700000,1000000,25000"},
+		{"500,3600000,1000000,25000", "1000,3600000,1000000,25000"},
+		{"250,3500000,1000000,25000"},
+	}
+	var parsers []RecordParser
+	for _, rows := range files {
+		parsers = append(parsers, NewCSVParser(writeTestCSV(t, rows)).WithFilterOptions(FilterOptions{StartTime: &testStart}))
+	}
+
+	records := collect(t, ChainParsers(parsers))
+
+	var deltas []int64
+	var offsets []time.Duration
+	for _, record := range records {
+		deltas = append(deltas, record.TimeDeltaMs)
+		offsets = append(offsets, record.Timestamp.Sub(testStart))
+	}
+	if want := []int64{0, 1000, 2000, 500, 1000, 250}; !reflect.DeepEqual(deltas, want) {
+		t.Errorf("deltas = %v, want %v", deltas, want)
+	}
+	wantOffsets := []time.Duration{0, time.Second, 3 * time.Second, 3500 * time.Millisecond, 4500 * time.Millisecond, 4750 * time.Millisecond}
+	if !reflect.DeepEqual(offsets, wantOffsets) {
+		t.Errorf("offsets = %v, want %v", offsets, wantOffsets)
+	}
+
+	// A second pass starts over instead of continuing from the last file
+	if again := collect(t, ChainParsers(parsers)); !reflect.DeepEqual(again, records) {
+		t.Errorf("second pass = %v, want %v", again, records)
+	}
+
+	// The streams of ChainStreams continue the same way in any order
+	streams, err := ChainStreams(parsers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var separate []EnemeterRecord
+	for i := len(streams) - 1; i >= 0; i-- {
+		separate = append(collect(t, streams[i]), separate...)
+	}
+	if !reflect.DeepEqual(separate, records) {
+		t.Errorf("ChainStreams = %v, want %v", separate, records)
+	}
+}
+
+func TestChainParsersOverlap(t *testing.T) {
+	// Every dump repeats the last reading of the one before it, and the
+	// second also has a different reading at that time
+	files := [][]string{
+		{"0,3700000,1000000,25000", "1000,3700000,1000000,25000", "1000,3600000,2000000,25000"},
+		{"0,3600000,2000000,25000", "0,3500000,2000000,25000", "1000,3500000,2000000,25000"},
+		{"0,3500000,2000000,25000", "2000,3400000,1000000,25000"},
+	}
+	var parsers []RecordParser
+	for _, rows := range files {
+		parsers = append(parsers, NewCSVParser(writeTestCSV(t, rows)).WithFilterOptions(FilterOptions{StartTime: &testStart}))
+	}
+
+	records := collect(t, ChainParsers(parsers))
+
+	var deltas []int64
+	var offsets []time.Duration
+	for _, record := range records {
+		deltas = append(deltas, record.TimeDeltaMs)
+		offsets = append(offsets, record.Timestamp.Sub(testStart))
+	}
+	if want := []int64{3700000, 3700000, 3600000, 3500000, 3500000, 3400000}; !reflect.DeepEqual(voltages(records), want) {
+		t.Errorf("voltages = %v, want %v", voltages(records), want)
+	}
+	if want := []int64{0, 1000, 1000, 0, 1000, 2000}; !reflect.DeepEqual(deltas, want) {
+		t.Errorf("deltas = %v, want %v", deltas, want)
+	}
+	wantOffsets := []time.Duration{0, time.Second, 2 * time.Second, 2 * time.Second, 3 * time.Second, 5 * time.Second}
+	if !reflect.DeepEqual(offsets, wantOffsets) {
+		t.Errorf("offsets = %v, want %v", offsets, wantOffsets)
+	}
+}
+
+func TestMergeCSVParsers(t *testing.T) {
+	files := [][]string{
+		{"1704103200000,3700000,1000000,25000", "1704103202000,3700000,1000000,25000", "1704103204000,3700000,1000000,25000"},
+		{"1704103201000,3600000,1000000,25000", "1704103202000,3700000,1000000,25000", "1704103203000,3600000,1000000,25000"},
+	}
+	var parsers []RecordParser
+	for _, rows := range files {
+		parsers = append(parsers, NewCSVParser(writeTestCSV(t, rows)).WithFilterOptions(FilterOptions{TimestampIsAbsoluteEpochMs: true}))
+	}
+
+	records := collect(t, MergeCSVParsers(parsers))
+
+	var deltas []int64
+	for _, record := range records {
+		deltas = append(deltas, record.TimeDeltaMs)
+	}
+	// The record at 2 s appears in both files and is counted once
+	if want := []int64{0, 1000, 1000, 1000, 1000}; !reflect.DeepEqual(deltas, want) {
+		t.Errorf("deltas = %v, want %v", deltas, want)
+	}
+	if want := []int64{3700000, 3600000, 3700000, 3600000, 3700000}; !reflect.DeepEqual(voltages(records), want) {
+		t.Errorf("voltages = %v, want %v", voltages(records), want)
+	}
+}
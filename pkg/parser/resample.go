@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"time"
+)
+
+// Resample converts irregularly spaced records into records spaced exactly
+// intervalMs apart by linearly interpolating voltage, current and temperature
+// between neighbouring records. The first output record lies one interval
+// after the first input record, so every output TimeDeltaMs equals intervalMs
+// and a session of duration D yields D / intervalMs records. Records that do
+// not advance the timestamp are skipped; ResamplingReader counts them.
+func Resample(records []EnemeterRecord, intervalMs int64) []EnemeterRecord {
+	if intervalMs <= 0 {
+		return records
+	}
+
+	var resampled []EnemeterRecord
+	r := newResampler(intervalMs)
+	for _, record := range records {
+		r.add(record, func(record EnemeterRecord) error {
+			resampled = append(resampled, record)
+			return nil
+		})
+	}
+
+	return resampled
+}
+
+// ResamplingReader resamples a record stream on the fly, see Resample. It
+// only keeps the previous record in memory, so it works with streaming mode.
+type ResamplingReader struct {
+	stream     StreamFunc
+	intervalMs int64
+	skipped    int
+}
+
+// NewResamplingReader resamples stream onto a grid of intervalMs
+func NewResamplingReader(stream StreamFunc, intervalMs int64) *ResamplingReader {
+	return &ResamplingReader{
+		stream:     stream,
+		intervalMs: intervalMs,
+	}
+}
+
+// StreamRecords passes the resampled records to callback. It has the
+// signature of StreamFunc so readers can be chained.
+func (r *ResamplingReader) StreamRecords(callback func(record EnemeterRecord) error) error {
+	rs := newResampler(r.intervalMs)
+	err := r.stream(func(record EnemeterRecord) error {
+		return rs.add(record, callback)
+	})
+	r.skipped = rs.skipped
+	return err
+}
+
+// Skipped returns how many input records were dropped by the last
+// StreamRecords call because their timestamp did not advance
+func (r *ResamplingReader) Skipped() int {
+	return r.skipped
+}
+
+// SliceStream returns a StreamFunc over records already in memory
+func SliceStream(records []EnemeterRecord) StreamFunc {
+	return func(callback func(record EnemeterRecord) error) error {
+		for _, record := range records {
+			if err := callback(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// resampler holds the state shared by Resample and ResamplingReader
+type resampler struct {
+	interval time.Duration
+	prev     *EnemeterRecord
+	next     time.Time // timestamp of the next output record
+	skipped  int
+}
+
+func newResampler(intervalMs int64) *resampler {
+	return &resampler{interval: time.Duration(intervalMs) * time.Millisecond}
+}
+
+// add consumes one input record and emits every output record up to it
+func (r *resampler) add(record EnemeterRecord, emit func(record EnemeterRecord) error) error {
+	if r.prev == nil {
+		r.prev = &record
+		r.next = record.Timestamp.Add(r.interval)
+		return nil
+	}
+
+	// Interpolation needs strictly increasing timestamps
+	if !record.Timestamp.After(r.prev.Timestamp) {
+		r.skipped++
+		return nil
+	}
+
+	for !r.next.After(record.Timestamp) {
+		if err := emit(interpolate(*r.prev, record, r.next, r.interval.Milliseconds())); err != nil {
+			return err
+		}
+		r.next = r.next.Add(r.interval)
+	}
+
+	r.prev = &record
+	return nil
+}
+
+// interpolate returns the record at target on the straight line between a
+// and b, with the given time delta
+func interpolate(a, b EnemeterRecord, target time.Time, timeDeltaMs int64) EnemeterRecord {
+	span := b.Timestamp.Sub(a.Timestamp)
+	frac := 0.0
+	if span > 0 {
+		frac = float64(target.Sub(a.Timestamp)) / float64(span)
+	}
+
+	lerp := func(from, to int64) int64 {
+		return from + int64(float64(to-from)*frac)
+	}
+
+	return EnemeterRecord{
+		TimeDeltaMs:     timeDeltaMs,
+		TempMiliCelsius: lerp(a.TempMiliCelsius, b.TempMiliCelsius),
+		VoltageMicroV:   lerp(a.VoltageMicroV, b.VoltageMicroV),
+		CurrentNanoA:    lerp(a.CurrentNanoA, b.CurrentNanoA),
+		Timestamp:       target,
+	}
+}
@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// reservoir keeps a uniform random sample of fixed size from a stream of
+// records of unknown length (Algorithm R).
+type reservoir struct {
+	size    int
+	seen    int
+	records []EnemeterRecord
+	rng     *rand.Rand
+}
+
+func newReservoir(size int, rng *rand.Rand) *reservoir {
+	if size < 0 {
+		size = 0
+	}
+	return &reservoir{
+		size:    size,
+		records: make([]EnemeterRecord, 0, size),
+		rng:     rng,
+	}
+}
+
+func (r *reservoir) add(record EnemeterRecord) {
+	r.seen++
+	if len(r.records) < r.size {
+		r.records = append(r.records, record)
+		return
+	}
+	if j := r.rng.Intn(r.seen); j < r.size {
+		r.records[j] = record
+	}
+}
+
+// sorted returns the sampled records back in chronological order.
+func (r *reservoir) sorted() []EnemeterRecord {
+	sort.SliceStable(r.records, func(i, j int) bool {
+		return r.records[i].Timestamp.Before(r.records[j].Timestamp)
+	})
+	return r.records
+}
+
+func reservoirSample(records []EnemeterRecord, size int, rng *rand.Rand) []EnemeterRecord {
+	sampler := newReservoir(size, rng)
+	for _, record := range records {
+		sampler.add(record)
+	}
+	return sampler.sorted()
+}
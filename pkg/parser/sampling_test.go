@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// writeTestCSV writes rows as a CSV file in a temporary directory and
+// returns its path
+func writeTestCSV(t *testing.T, rows []string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(path, []byte(strings.Join(rows, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// rampRows returns n rows one second apart whose voltage is the row index,
+// so every record can be told apart by its voltage
+func rampRows(n int) []string {
+	rows := make([]string, n)
+	for i := range rows {
+		rows[i] = fmt.Sprintf("1000,%d,1000000,25000", i)
+	}
+	return rows
+}
+
+func voltages(records []EnemeterRecord) []int64 {
+	v := make([]int64, len(records))
+	for i, r := range records {
+		v[i] = r.VoltageMicroV
+	}
+	return v
+}
+
+func TestRandomSampling(t *testing.T) {
+	path := writeTestCSV(t, rampRows(1000))
+	maxVoltage := [2]int64{0, 499}
+
+	tests := []struct {
+		name        string
+		options     FilterOptions
+		wantRecords int
+	}{
+		{"sequential", FilterOptions{SampleRate: 10}, 100},
+		{"random", FilterOptions{SampleRate: 10, RandomizeSampleOrder: true, RandomSeed: 42}, 100},
+		{"random other seed", FilterOptions{SampleRate: 10, RandomizeSampleOrder: true, RandomSeed: 7}, 100},
+		// The sample is a fraction of the records that pass the filters
+		{"random filtered", FilterOptions{SampleRate: 10, RandomizeSampleOrder: true, RandomSeed: 42, VoltageRange: &maxVoltage}, 50},
+	}
+
+	results := make(map[string][]int64)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.options
+			options.StartTime = &testStart
+
+			parse := func() []int64 {
+				records, err := NewCSVParser(path).WithFilterOptions(options).Parse()
+				if err != nil {
+					t.Fatal(err)
+				}
+				return voltages(records)
+			}
+
+			first := parse()
+			if len(first) != tt.wantRecords {
+				t.Fatalf("got %d records, want %d", len(first), tt.wantRecords)
+			}
+			if again := parse(); !reflect.DeepEqual(first, again) {
+				t.Errorf("repeated run with the same seed differs")
+			}
+
+			var streamed []EnemeterRecord
+			err := NewCSVParser(path).WithFilterOptions(options).StreamRecords(func(r EnemeterRecord) error {
+				streamed = append(streamed, r)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := voltages(streamed); !reflect.DeepEqual(first, got) {
+				t.Errorf("StreamRecords differs from Parse")
+			}
+
+			results[tt.name] = first
+		})
+	}
+
+	if reflect.DeepEqual(results["sequential"], results["random"]) {
+		t.Errorf("random sample equals the sequential one")
+	}
+	if reflect.DeepEqual(results["random"], results["random other seed"]) {
+		t.Errorf("different seeds give the same sample")
+	}
+}
+
+func TestRandomSampleSize(t *testing.T) {
+	tests := []struct {
+		name        string
+		rows        int
+		wantRecords int
+	}{
+		{"fewer records than the rate", 5, 1},
+		{"rounded up", 15, 2},
+		{"multiple of the rate", 20, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := FilterOptions{StartTime: &testStart, SampleRate: 10, RandomizeSampleOrder: true, RandomSeed: 42}
+			p := NewCSVParser(writeTestCSV(t, rampRows(tt.rows))).WithFilterOptions(options)
+
+			records, err := p.Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != tt.wantRecords {
+				t.Errorf("Parse gave %d records, want %d", len(records), tt.wantRecords)
+			}
+
+			streamed := 0
+			if err := p.StreamRecords(func(EnemeterRecord) error {
+				streamed++
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if streamed != tt.wantRecords {
+				t.Errorf("StreamRecords gave %d records, want %d", streamed, tt.wantRecords)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// RecordScanner reads records line by line from a stream that may never end,
+// such as a pipe from socat or netcat. Unlike CSVParser it does not need a
+// file on disk, and malformed lines are counted and skipped instead of
+// aborting the stream.
+type RecordScanner struct {
+	scanner           *bufio.Scanner
+	startTime         time.Time
+	accumulatedTimeMs int64
+	record            EnemeterRecord
+	invalidLines      int
+}
+
+// NewRecordScanner reads records from r, accumulating the time deltas from
+// startTime
+func NewRecordScanner(r io.Reader, startTime time.Time) *RecordScanner {
+	return &RecordScanner{
+		scanner:   bufio.NewScanner(CRLFStrip(r)),
+		startTime: startTime,
+	}
+}
+
+// Scan advances to the next valid record. It returns false at the end of the
+// stream or on a read error, which Err reports.
+func (s *RecordScanner) Scan() bool {
+	for s.scanner.Scan() {
+		line := strings.TrimSpace(s.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		record, err := parseRow(fields)
+		if err != nil {
+			s.invalidLines++
+			continue
+		}
+
+		s.accumulatedTimeMs += record.TimeDeltaMs
+		record.Timestamp = s.startTime.Add(time.Duration(s.accumulatedTimeMs) * time.Millisecond)
+		s.record = record
+		return true
+	}
+	return false
+}
+
+// Record returns the record found by the last Scan
+func (s *RecordScanner) Record() EnemeterRecord {
+	return s.record
+}
+
+// Err returns the read error that stopped Scan, if any
+func (s *RecordScanner) Err() error {
+	return s.scanner.Err()
+}
+
+// InvalidLines returns how many non-empty lines could not be parsed so far
+func (s *RecordScanner) InvalidLines() int {
+	return s.invalidLines
+}
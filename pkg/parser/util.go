@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// gzipFile closes both the decompressor and the underlying file
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	gzErr := g.Reader.Close()
+	if err := g.file.Close(); err != nil {
+		return err
+	}
+	return gzErr
+}
+
+// openInput opens path for reading, transparently decompressing it when it
+// has a .gz extension or compressed is set
+func openInput(path string, compressed bool) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	if !isCompressed(path, compressed) {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+	}
+	return &gzipFile{Reader: gz, file: file}, nil
+}
+
+// isCompressed reports whether openInput will decompress path
+func isCompressed(path string, compressed bool) bool {
+	return compressed || strings.HasSuffix(strings.ToLower(path), ".gz")
+}
+
+// crlfReader rewrites "\r\n" to "\n" as data passes through. A trailing
+// '\r' is held back until the next chunk shows whether a '\n' follows it.
+type crlfReader struct {
+	r       io.Reader
+	buf     []byte
+	pending []byte
+	err     error
+}
+
+// CRLFStrip wraps r so that Windows-style line endings reach line-based
+// readers as plain "\n". A lone '\r' not followed by '\n' is kept.
+func CRLFStrip(r io.Reader) io.Reader {
+	return &crlfReader{r: r, buf: make([]byte, 32*1024)}
+}
+
+func (c *crlfReader) Read(p []byte) (int, error) {
+	for {
+		// Everything but a trailing '\r' is safe to hand out while more data
+		// may follow; once the source is done the '\r' is final too
+		ready := len(c.pending)
+		if c.err == nil && ready > 0 && c.pending[ready-1] == '\r' {
+			ready--
+		}
+		if ready > 0 {
+			n := copy(p, c.pending[:ready])
+			c.pending = c.pending[n:]
+			return n, nil
+		}
+		if c.err != nil {
+			return 0, c.err
+		}
+
+		n, err := c.r.Read(c.buf)
+		c.err = err
+		c.pending = bytes.ReplaceAll(append(c.pending, c.buf[:n]...), []byte("\r\n"), []byte("\n"))
+	}
+}
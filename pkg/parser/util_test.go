@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestCRLFStrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"CRLF", "field1\r\nfield2\r\n", "field1\nfield2\n"},
+		{"LF untouched", "field1\nfield2\n", "field1\nfield2\n"},
+		{"lone CR kept", "a\rb\r\n", "a\rb\n"},
+		{"trailing CR kept", "field1\r", "field1\r"},
+		{"mixed", "a\r\nb\nc\r\n", "a\nb\nc\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// One byte per read splits every "\r\n" across two reads
+			for _, r := range []io.Reader{strings.NewReader(tt.input), iotest.OneByteReader(strings.NewReader(tt.input))} {
+				got, err := io.ReadAll(CRLFStrip(r))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tt.want {
+					t.Errorf("got %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCRLFRecords(t *testing.T) {
+	rows := []string{
+		"time_delta_ms,voltage_uv,current_na,temp_mc\r",
+		"1000,3700000,1000000,25000\r",
+		"1000,3690000,-2000000,25100\r",
+	}
+	want := []EnemeterRecord{
+		{TimeDeltaMs: 1000, VoltageMicroV: 3700000, CurrentNanoA: 1000000, TempMiliCelsius: 25000, Timestamp: testStart.Add(time.Second)},
+		{TimeDeltaMs: 1000, VoltageMicroV: 3690000, CurrentNanoA: -2000000, TempMiliCelsius: 25100, Timestamp: testStart.Add(2 * time.Second)},
+	}
+
+	t.Run("CSVParser", func(t *testing.T) {
+		records, _ := parseRows(t, rows, FilterOptions{})
+		if !reflect.DeepEqual(records, want) {
+			t.Errorf("got %v, want %v", records, want)
+		}
+	})
+
+	t.Run("RecordScanner", func(t *testing.T) {
+		scanner := NewRecordScanner(strings.NewReader(strings.Join(rows[1:], "\n")+"\n"), testStart)
+		var records []EnemeterRecord
+		for scanner.Scan() {
+			records = append(records, scanner.Record())
+		}
+		if scanner.InvalidLines() != 0 {
+			t.Errorf("%d invalid lines", scanner.InvalidLines())
+		}
+		if !reflect.DeepEqual(records, want) {
+			t.Errorf("got %v, want %v", records, want)
+		}
+	})
+}